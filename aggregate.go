@@ -0,0 +1,271 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Aggregate describes an aggregate expression like COUNT(*) AS total. Func is
+// one of COUNT, SUM, MIN, MAX or AVG and Column may be "*" for COUNT only. The
+// Alias must match a db tag of the destination struct.
+type Aggregate struct {
+	Func   string
+	Column string
+	Alias  string
+}
+
+// Having filters grouped rows by comparing an aggregate against Value
+type Having struct {
+	Aggregate Aggregate
+	Op        string
+	Value     interface{}
+}
+
+// Grouping holds the GROUP BY columns, the aggregates to select and optional
+// HAVING conditions of a grouped query
+type Grouping struct {
+	Columns    []string
+	Aggregates []Aggregate
+	Having     []Having
+}
+
+// aggFuncs lists supported aggregate functions
+var aggFuncs = []string{"COUNT", "SUM", "MIN", "MAX", "AVG"}
+
+// havingOps lists supported comparison operators for HAVING
+var havingOps = []string{"=", "<>", "<", "<=", ">", ">="}
+
+// GroupBy runs a grouped aggregate query and scans the rows into dest, which
+// must be a pointer to a slice of structs.
+func (g *Gateway) GroupBy(dest interface{}, grouping Grouping, params Condition, orderby Orderer) error {
+	return g.GroupByContext(context.Background(), dest, grouping, params, orderby)
+}
+
+// GroupByContext is like GroupBy but runs with given context
+func (g *Gateway) GroupByContext(ctx context.Context, dest interface{}, grouping Grouping, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	// Rows of dest hold groups, not necessarily the filtered columns
+	if err := checkCondition(params, nil); err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	if !validIdent(grouping.Columns...) {
+		return ErrIdentifier
+	}
+
+	cols := quoteIdents(grouping.Columns)
+	for _, a := range grouping.Aggregates {
+		expr, err := a.expr()
+		if err != nil {
+			return err
+		}
+		if !validIdent(a.Alias) {
+			return ErrIdentifier
+		}
+		cols = append(cols, fmt.Sprintf("%s AS `%s`", expr, a.Alias))
+	}
+
+	if len(cols) == 0 {
+		return ErrIdentifier
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return err
+	}
+
+	// Rows of dest hold groups, so deleted rows are those of the gateways table
+	where, args := whereClause(params)
+	where = withoutDeleted(where, g.softDeleteCol(nil))
+	q := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ","), quoteTable(table)) + where
+
+	if len(grouping.Columns) > 0 {
+		q = q + " GROUP BY " + strings.Join(quoteIdents(grouping.Columns), ",")
+	}
+
+	if len(grouping.Having) > 0 {
+		//noinspection GoPreferNilSlice
+		conds := []string{}
+		for _, h := range grouping.Having {
+			expr, err := h.Aggregate.expr()
+			if err != nil {
+				return err
+			}
+			if !inArray(h.Op, havingOps) {
+				return ErrIdentifier
+			}
+			conds = append(conds, fmt.Sprintf("%s %s ?", expr, h.Op))
+			args = append(args, h.Value)
+		}
+		q = q + " HAVING " + strings.Join(conds, " AND ")
+	}
+
+	q = q + orderClause(orderby, quoteColumn)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	err = g.selectRows(ctx, opSelect, table, dest, q, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// expr validates the aggregate and returns its sql expression without alias
+func (a Aggregate) expr() (string, error) {
+	fn := strings.ToUpper(a.Func)
+	if !inArray(fn, aggFuncs) {
+		return "", ErrIdentifier
+	}
+	if a.Column == "*" && fn == "COUNT" {
+		return "COUNT(*)", nil
+	}
+	if !validIdent(a.Column) {
+		return "", ErrIdentifier
+	}
+	return fmt.Sprintf("%s(`%s`)", fn, a.Column), nil
+}
+
+// GroupValue is a single row of a grouped aggregate, holding the value of the
+// group column and the aggregate of the group
+type GroupValue struct {
+	Key   interface{} `db:"group_key"`
+	Value float64     `db:"value"`
+}
+
+// Sum returns the sum of column over all rows of the gateways table matching
+// params, zero if there are none
+func (g *Gateway) Sum(column string, params Condition) (float64, error) {
+	return g.AggregateContext(context.Background(), "SUM", column, params)
+}
+
+// Min returns the smallest value of a numeric column like Sum
+func (g *Gateway) Min(column string, params Condition) (float64, error) {
+	return g.AggregateContext(context.Background(), "MIN", column, params)
+}
+
+// Max returns the largest value of a numeric column like Sum
+func (g *Gateway) Max(column string, params Condition) (float64, error) {
+	return g.AggregateContext(context.Background(), "MAX", column, params)
+}
+
+// Avg returns the average value of a numeric column like Sum
+func (g *Gateway) Avg(column string, params Condition) (float64, error) {
+	return g.AggregateContext(context.Background(), "AVG", column, params)
+}
+
+// AggregateContext computes aggregate function fn, one of COUNT, SUM, MIN, MAX
+// or AVG, of a numeric column over all rows of the gateways table matching
+// params. Other column types are supported by GroupBy.
+func (g *Gateway) AggregateContext(ctx context.Context, fn, column string, params Condition) (float64, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return 0, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return 0, err
+	}
+
+	expr, err := Aggregate{Func: fn, Column: column}.expr()
+	if err != nil {
+		return 0, err
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return 0, err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf("SELECT COALESCE(%s, 0) FROM %s", expr, quoteTable(table)) + where
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	var v float64
+	if err := g.get(ctx, opSelect, table, &v, q, args...); err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
+// AggregateBy computes aggregate function fn of column for every group of
+// rows of the gateways table matching params sharing the same value in column
+// group. Groups are ordered by their key.
+func (g *Gateway) AggregateBy(fn, group, column string, params Condition) ([]GroupValue, error) {
+	return g.AggregateByContext(context.Background(), fn, group, column, params)
+}
+
+// AggregateByContext is like AggregateBy but runs with given context
+func (g *Gateway) AggregateByContext(ctx context.Context, fn, group, column string, params Condition) ([]GroupValue, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return nil, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !validIdent(group) {
+		return nil, ErrIdentifier
+	}
+
+	expr, err := Aggregate{Func: fn, Column: column}.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf(
+		"SELECT `%s` AS `group_key`, COALESCE(%s, 0) AS `value` FROM %s",
+		group,
+		expr,
+		quoteTable(table),
+	) + where + fmt.Sprintf(" GROUP BY `%s` ORDER BY `%s`", group, group)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	//noinspection GoPreferNilSlice
+	rows := []GroupValue{}
+	if err := g.selectRows(ctx, opSelect, table, &rows, q, args...); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
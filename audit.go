@@ -0,0 +1,227 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditRecord is a row of the audit table. Create the table with
+// CreateTable(&AuditRecord{}) on a gateway for the audit table name.
+type AuditRecord struct {
+	ID        uint64                 `db:"id" tgw:"primary"`
+	Entity    string                 `db:"entity" tgw:"insert,type=VARCHAR(255)"`
+	EntityID  string                 `db:"entity_id" tgw:"insert,type=VARCHAR(255)"`
+	Action    string                 `db:"action" tgw:"insert,type=VARCHAR(16)"`
+	Changes   map[string]AuditChange `db:"changes" tgw:"insert,json"`
+	Actor     string                 `db:"actor" tgw:"insert,type=VARCHAR(255)"`
+	CreatedAt time.Time              `db:"created_at" tgw:"insert,created"`
+}
+
+// AuditChange holds the old and new value of a changed column. Values of
+// encrypted columns are left out.
+type AuditChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// actorKey is the context key of the actor
+type actorKey struct{}
+
+// WithActor returns a copy of ctx naming the actor recorded in audit records
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor or an empty string
+func ActorFrom(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
+
+// WithAudit records every change of a single entity by Create, Upsert,
+// CreateIgnore, Replace, Update, UpdatePartial, Patch, Increment, Delete and
+// HardDelete in given audit table. The row is read before and after the
+// change, both within the transaction writing the change and its record.
+// Batch and set based operations like CreateMany or UpdateWhere are not
+// audited.
+func WithAudit(table string) Option {
+	return func(g *Gateway) error {
+		if !validTable(table) {
+			return ErrOption
+		}
+		g.audit = table
+		return nil
+	}
+}
+
+// audited runs fn on a transaction bound copy of the gateway without
+// auditing and records the changes of entity dest in the audit table
+func (g *Gateway) audited(ctx context.Context, action string, dest interface{}, fn func(ag *Gateway) error) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	entity, err := g.rawTableName(dest)
+	if err != nil {
+		return err
+	}
+
+	return g.transact(ctx, nil, func(txg *Gateway) error {
+
+		ag := *txg
+		ag.audit = ""
+
+		var before map[string]interface{}
+		if action != AuditCreate || hasKey(dest, destcfg) {
+			if before, err = ag.Lock(LockForUpdate).auditState(ctx, dest, destcfg); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(&ag); err != nil {
+			return err
+		}
+
+		after, err := ag.auditState(ctx, dest, destcfg)
+		if err != nil {
+			return err
+		}
+
+		changes := auditDiff(before, after, destcfg)
+		if len(changes) == 0 {
+			return nil
+		}
+
+		rec := &AuditRecord{
+			Entity:   entity,
+			EntityID: auditKey(dest, destcfg),
+			Action:   action,
+			Changes:  changes,
+			Actor:    ActorFrom(ctx),
+		}
+
+		return ag.auditGateway(g.audit).insert(ctx, rec, insertPlain)
+	})
+}
+
+// auditState reads the stored row of entity dest into a map of column values
+// or returns nil if there is none
+func (g *Gateway) auditState(ctx context.Context, dest interface{}, destcfg *tabMeta) (map[string]interface{}, error) {
+
+	e := reflect.New(baseType(reflect.TypeOf(dest)))
+
+	var id interface{} = getPriVals(dest, destcfg)
+	if len(destcfg.PrimaryDBs) == 1 {
+		id = getPriVals(dest, destcfg)[0]
+	}
+	if err := setPriVal(e.Interface(), destcfg, id); err != nil {
+		return nil, err
+	}
+
+	sg := g.Unscoped()
+	sg.preload = nil
+
+	err := sg.ReadContext(ctx, e.Interface())
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := map[string]interface{}{}
+	for col, idx := range destcfg.Fields {
+		state[col] = e.Elem().FieldByIndex(idx).Interface()
+	}
+
+	return state, nil
+}
+
+// auditGateway returns a copy of the gateway writing to given audit table
+func (g *Gateway) auditGateway(table string) *Gateway {
+	ag := *g
+	ag.table = table
+	ag.audit = ""
+	ag.tenant = nil
+	ag.shard = nil
+	ag.shardKey = nil
+	ag.returning = nil
+	ag.preload = nil
+	ag.lock = LockNone
+	ag.idgen = nil
+	ag.validators = nil
+	ag.onChange = nil
+	return &ag
+}
+
+// auditDiff returns the columns differing between two states of an entity,
+// either of which may be nil
+func auditDiff(before, after map[string]interface{}, destcfg *tabMeta) map[string]AuditChange {
+
+	changes := map[string]AuditChange{}
+
+	for col := range destcfg.Fields {
+		o, ok1 := before[col]
+		n, ok2 := after[col]
+		if ok1 == ok2 && reflect.DeepEqual(o, n) {
+			continue
+		}
+		if inArray(col, destcfg.Encrypted) {
+			changes[col] = AuditChange{}
+			continue
+		}
+		changes[col] = AuditChange{Old: o, New: n}
+	}
+
+	return changes
+}
+
+// auditKey renders the primary key of entity, joining composite keys by comma
+func auditKey(dest interface{}, destcfg *tabMeta) string {
+
+	//noinspection GoPreferNilSlice
+	keys := []string{}
+	for _, v := range getPriVals(dest, destcfg) {
+		keys = append(keys, fmt.Sprint(v))
+	}
+
+	return strings.Join(keys, ",")
+}
+
+// hasKey checks if all primary key fields of entity are set
+func hasKey(dest interface{}, destcfg *tabMeta) bool {
+	r := reflect.ValueOf(dest).Elem()
+	for _, idx := range destcfg.PrimaryIdx {
+		if r.FieldByIndex(idx).IsZero() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testAuditGateway returns a gateway on users auditing to audit_log, holding
+// the user a aged 1, and a gateway on the audit table
+func testAuditGateway(t *testing.T) (*Gateway, *Gateway, *testUser) {
+
+	t.Helper()
+
+	db := testDB(t, testUsers)
+	ag := testGateway(t, db, "audit_log")
+	if err := ag.CreateTable(&AuditRecord{}); err != nil {
+		t.Fatal(err)
+	}
+
+	u := &testUser{Name: "a", Age: 1}
+	testCreate(t, testGateway(t, db, "users"), u)
+
+	return testGateway(t, db, "users", WithAudit("audit_log")), ag, u
+}
+
+// TestAudit checks the records written for changes of an entity
+func TestAudit(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		change  func(ctx context.Context, g *Gateway, u *testUser) error
+		action  string
+		changes map[string]string
+	}{
+		{"create", func(ctx context.Context, g *Gateway, u *testUser) error {
+			return g.CreateContext(ctx, &testUser{Name: "b", Age: 2})
+		}, AuditCreate, map[string]string{"id": "<nil> 2", "name": "<nil> b", "age": "<nil> 2"}},
+		{"update", func(ctx context.Context, g *Gateway, u *testUser) error {
+			u.Age = 2
+			return g.UpdateContext(ctx, u)
+		}, AuditUpdate, map[string]string{"age": "1 2"}},
+		{"update unchanged", func(ctx context.Context, g *Gateway, u *testUser) error {
+			return g.UpdateContext(ctx, u)
+		}, "", nil},
+		{"increment", func(ctx context.Context, g *Gateway, u *testUser) error {
+			return g.IncrementContext(ctx, u, "age", 5)
+		}, AuditUpdate, map[string]string{"age": "1 6"}},
+		{"delete", func(ctx context.Context, g *Gateway, u *testUser) error {
+			return g.DeleteContext(ctx, u)
+		}, AuditDelete, map[string]string{"id": "1 <nil>", "name": "a <nil>", "age": "1 <nil>"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, ag, u := testAuditGateway(t)
+
+			if err := tc.change(WithActor(context.Background(), "admin"), g, u); err != nil {
+				t.Fatal(err)
+			}
+
+			var recs []AuditRecord
+			if err := ag.Select(&recs, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.action == "" {
+				if len(recs) != 0 {
+					t.Fatalf("records = %+v, want none", recs)
+				}
+				return
+			}
+
+			if len(recs) != 1 {
+				t.Fatalf("records = %+v, want one", recs)
+			}
+			r := recs[0]
+			if r.Action != tc.action || r.Entity != "users" || r.Actor != "admin" {
+				t.Errorf("record = %+v, want action %s of admin", r, tc.action)
+			}
+
+			got := map[string]string{}
+			for col, c := range r.Changes {
+				got[col] = fmt.Sprint(c.Old, " ", c.New)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.changes) {
+				t.Errorf("changes = %v, want %v", got, tc.changes)
+			}
+		})
+	}
+}
+
+// TestAuditRollback checks that a change is undone if its record can not be
+// written
+func TestAuditRollback(t *testing.T) {
+
+	db := testDB(t, testUsers)
+	g := testGateway(t, db, "users", WithAudit("audit_log"))
+
+	if err := g.Create(&testUser{Name: "a"}); err == nil {
+		t.Fatal("Create() without audit table succeeded")
+	}
+
+	if n := testCount(t, db, "users", "1 = 1"); n != 0 {
+		t.Errorf("%d rows, want the create rolled back", n)
+	}
+}
+
+// TestWithAudit checks the validation of the audit table
+func TestWithAudit(t *testing.T) {
+	if _, err := NewGateway(testDB(t), "users", WithAudit("audit log")); !errors.Is(err, ErrOption) {
+		t.Fatalf("NewGateway() = %v, want ErrOption", err)
+	}
+}
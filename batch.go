@@ -0,0 +1,346 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CreateMany writes all entities of the slice dest points to using multi row
+// INSERT statements of at most chunkSize rows, zero meaning one statement for
+// all. Several statements run in one transaction. Generated primary keys are
+// populated on dialects supporting RETURNING and on MySQL, which reports the
+// first ID of a batch and assigns consecutive IDs. Columns tagged omitempty
+// are always written as all entities share the statement.
+func (g *Gateway) CreateMany(dest interface{}, chunkSize int) error {
+	return g.CreateManyContext(context.Background(), dest, chunkSize)
+}
+
+// CreateManyContext is like CreateMany but runs with given context
+func (g *Gateway) CreateManyContext(ctx context.Context, dest interface{}, chunkSize int) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	elems := sliceElems(dest)
+	if len(elems) == 0 {
+		return nil
+	}
+
+	table, err := g.batchTable(dest, elems)
+	if err != nil {
+		return err
+	}
+
+	if err := runHooks(ctx, hookBeforeCreate, elems); err != nil {
+		return err
+	}
+
+	stamped := destcfg
+	for _, e := range elems {
+		if err := g.generateID(e, destcfg); err != nil {
+			return err
+		}
+		if err := g.setTenant(e, destcfg); err != nil {
+			return err
+		}
+		if err := setDefaults(e, destcfg); err != nil {
+			return err
+		}
+		stamped = g.stamp(e, destcfg, true)
+	}
+	destcfg = stamped
+
+	if err := g.validateAll(ctx, elems); err != nil {
+		return err
+	}
+
+	cols, auto := insertCols(elems[0], destcfg)
+	for _, e := range elems[1:] {
+		if c, _ := insertCols(e, destcfg); !equalStrings(c, cols) {
+			return ErrBatchKeys
+		}
+	}
+
+	if chunkSize <= 0 || chunkSize > len(elems) {
+		chunkSize = len(elems)
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	err = g.transact(ctx, nil, func(txg *Gateway) error {
+		for start := 0; start < len(elems); start += chunkSize {
+			end := start + chunkSize
+			if end > len(elems) {
+				end = len(elems)
+			}
+			if err := txg.insertChunk(ctx, table, elems[start:end], cols, auto, destcfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range elems {
+		g.changed(opCreate, e)
+	}
+
+	return runHooks(ctx, hookAfterCreate, elems)
+}
+
+// insertChunk writes given entities with a single INSERT statement
+func (g *Gateway) insertChunk(ctx context.Context, table string, elems []interface{}, cols []string, auto bool, destcfg *tabMeta) error {
+
+	row := "(" + strings.Join(nowValues(cols, quoteNamedValues(cols), destcfg), ",") + ")"
+
+	//noinspection GoPreferNilSlice
+	rows := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, e := range elems {
+		r, a, err := bindNamed(row, e, destcfg)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, r)
+		args = append(args, a...)
+	}
+
+	q := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s",
+		quoteTable(table),
+		strings.Join(quoteIdents(cols), ","),
+		strings.Join(rows, ","),
+	)
+
+	if auto && g.dialect.Returning() {
+		q = q + fmt.Sprintf(" RETURNING `%s`", destcfg.PrimaryDBs[0])
+		rs, err := g.queryRows(ctx, opCreate, table, q, args...)
+		if err != nil {
+			return err
+		}
+		defer rs.Close()
+		for i := 0; rs.Next() && i < len(elems); i++ {
+			pri := reflect.ValueOf(elems[i]).Elem().FieldByIndex(destcfg.PrimaryIdx[0])
+			if err := rs.Scan(pri.Addr().Interface()); err != nil {
+				return err
+			}
+		}
+		return rs.Err()
+	}
+
+	res, err := g.exec(ctx, opCreate, table, q, args...)
+	if err != nil {
+		return err
+	}
+
+	if !auto || g.dialect != MySQL {
+		return nil
+	}
+
+	first, err := res.LastInsertId()
+	if noInsertID(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, e := range elems {
+		pri := reflect.ValueOf(e).Elem().FieldByIndex(destcfg.PrimaryIdx[0])
+		if isSigned(pri.Kind()) {
+			pri.SetInt(first + int64(i))
+		} else {
+			pri.SetUint(uint64(first + int64(i)))
+		}
+	}
+
+	return nil
+}
+
+// sliceElems returns pointers to all elements of the slice dest points to
+func sliceElems(dest interface{}) []interface{} {
+
+	s := reflect.Indirect(reflect.ValueOf(dest))
+
+	elems := make([]interface{}, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		e := s.Index(i)
+		if e.Kind() != reflect.Ptr {
+			e = e.Addr()
+		}
+		elems[i] = e.Interface()
+	}
+
+	return elems
+}
+
+// equalStrings checks if both slices hold the same strings in same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BatchMode controls the error handling of batch operations
+type BatchMode int
+
+// Batch modes
+const (
+	// BatchAbort runs the batch in one transaction and rolls it back on the
+	// first failing row
+	BatchAbort BatchMode = iota
+	// BatchCollect writes every row on its own and collects the errors of
+	// failing rows in a *BatchError
+	BatchCollect
+)
+
+// BatchError holds the errors of failed rows of a batch by their index
+type BatchError struct {
+	Errors map[int]error
+}
+
+// Error implements error
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d rows of batch failed", len(e.Errors))
+}
+
+// UpdateMany updates all entities of the slice dest points to using a single
+// statement, which is prepared only once with WithStmtCache. Errors are handled
+// according to mode. Columns tagged omitempty are always written as all
+// entities share the statement.
+func (g *Gateway) UpdateMany(dest interface{}, mode BatchMode) error {
+	return g.UpdateManyContext(context.Background(), dest, mode)
+}
+
+// UpdateManyContext is like UpdateMany but runs with given context
+func (g *Gateway) UpdateManyContext(ctx context.Context, dest interface{}, mode BatchMode) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	elems := sliceElems(dest)
+	if len(elems) == 0 {
+		return nil
+	}
+
+	table, err := g.batchTable(dest, elems)
+	if err != nil {
+		return err
+	}
+
+	if err := runHooks(ctx, hookBeforeUpdate, elems); err != nil {
+		return err
+	}
+
+	if err := g.validateAll(ctx, elems); err != nil {
+		return err
+	}
+
+	stamped := destcfg
+	for _, e := range elems {
+		if err := g.setTenant(e, destcfg); err != nil {
+			return err
+		}
+		stamped = g.stamp(e, destcfg, false)
+	}
+	destcfg = stamped
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	if mode == BatchCollect {
+		err = g.updateRows(ctx, table, elems, destcfg, false)
+	} else {
+		err = g.transact(ctx, nil, func(txg *Gateway) error {
+			return txg.updateRows(ctx, table, elems, destcfg, true)
+		})
+	}
+
+	// Failed rows of a collecting batch skip their after hooks
+	var be *BatchError
+	if err != nil && !errors.As(err, &be) {
+		return err
+	}
+
+	for i, e := range elems {
+		if be != nil && be.Errors[i] != nil {
+			continue
+		}
+		g.changed(opUpdate, e)
+		if herr := runHook(ctx, hookAfterUpdate, e); herr != nil {
+			return herr
+		}
+	}
+
+	return err
+}
+
+// updateRows updates given entities one statement each, stopping on the
+// first error if abort is set
+func (g *Gateway) updateRows(ctx context.Context, table string, elems []interface{}, destcfg *tabMeta, abort bool) error {
+
+	if err := g.writable(opUpdate); err != nil {
+		return err
+	}
+
+	errs := map[int]error{}
+	for i, e := range elems {
+		q, args, err := buildUpdate(table, e, destcfg, destcfg.UpdateCols)
+		if err == nil {
+			q, args, err = g.scoped(q, args, destcfg)
+		}
+		if err == nil {
+			var res sql.Result
+			res, err = g.exec(ctx, opUpdate, table, q, args...)
+			if err == nil {
+				err = checkVersion(res, e, destcfg)
+			}
+		}
+		if err != nil {
+			if abort {
+				return err
+			}
+			errs[i] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+
+	return nil
+}
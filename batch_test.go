@@ -0,0 +1,176 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"testing"
+)
+
+func init() {
+	sql.Register("tgw_first_id", testFirstIDDriver{})
+}
+
+// testFirstIDDriver is SQLite reporting the first ID of multi row inserts
+// like MySQL does. Its name maps to the MySQL dialect.
+type testFirstIDDriver struct{}
+
+// Open implements driver.Driver
+func (testFirstIDDriver) Open(name string) (driver.Conn, error) {
+	c, err := (&sqlite3.SQLiteDriver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return testFirstIDConn{c.(*sqlite3.SQLiteConn)}, nil
+}
+
+// testFirstIDConn is a connection of testFirstIDDriver
+type testFirstIDConn struct {
+	*sqlite3.SQLiteConn
+}
+
+// ExecContext implements driver.ExecerContext
+func (c testFirstIDConn) ExecContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.SQLiteConn.ExecContext(ctx, q, args)
+	if err != nil {
+		return nil, err
+	}
+	return testFirstIDResult{res}, nil
+}
+
+// testFirstIDResult turns the last ID SQLite reports into the first one
+type testFirstIDResult struct {
+	driver.Result
+}
+
+// LastInsertId implements driver.Result
+func (r testFirstIDResult) LastInsertId() (int64, error) {
+	last, err := r.Result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.Result.RowsAffected()
+	return last - n + 1, err
+}
+
+// testReturning is SQLite with RETURNING clauses
+type testReturning struct {
+	Dialect
+}
+
+func (testReturning) Returning() bool { return true }
+
+// TestCreateManyIDs checks the primary keys CreateMany assigns to created
+// entities
+func TestCreateManyIDs(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		driver string
+		opts   []Option
+		chunk  int
+		users  []testUser
+		ids    []uint64
+	}{
+		{"mysql", "tgw_first_id", nil, 0, make([]testUser, 3), []uint64{2, 3, 4}},
+		{"mysql chunked", "tgw_first_id", nil, 2, make([]testUser, 3), []uint64{2, 3, 4}},
+		{"mysql set keys", "tgw_first_id", nil, 0, []testUser{{ID: 7}, {ID: 5}}, []uint64{7, 5}},
+		{"returning", "sqlite3", []Option{WithDialect(testReturning{SQLite})}, 0, make([]testUser, 3), []uint64{2, 3, 4}},
+		{"returning chunked", "sqlite3", []Option{WithDialect(testReturning{SQLite})}, 1, make([]testUser, 3), []uint64{2, 3, 4}},
+		{"no returning", "sqlite3", nil, 0, make([]testUser, 2), []uint64{0, 0}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := sqlx.Open(tc.driver, ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.SetMaxOpenConns(1)
+			t.Cleanup(func() { _ = db.Close() })
+			db.MustExec(testUsers)
+			db.MustExec("INSERT INTO users (name) VALUES ('first')")
+
+			g := testGateway(t, db, "users", tc.opts...)
+			if err := g.CreateMany(&tc.users, tc.chunk); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, u := range tc.users {
+				if u.ID != tc.ids[i] {
+					t.Errorf("id of user %d = %d, want %d", i, u.ID, tc.ids[i])
+				}
+			}
+			if n := testCount(t, db, "users", "1 = 1"); n != len(tc.users)+1 {
+				t.Errorf("%d rows, want %d", n, len(tc.users)+1)
+			}
+		})
+	}
+}
+
+// TestCreateManyPointers checks that slices of pointers get their keys too
+func TestCreateManyPointers(t *testing.T) {
+
+	g := testGateway(t, testDB(t, testUsers), "users", WithDialect(testReturning{SQLite}))
+
+	users := []*testUser{{Name: "a"}, {Name: "b"}}
+	if err := g.CreateMany(users, 0); err != nil {
+		t.Fatal(err)
+	}
+	if users[0].ID != 1 || users[1].ID != 2 {
+		t.Fatalf("ids = %d, %d, want 1, 2", users[0].ID, users[1].ID)
+	}
+}
+
+// TestCreateManyErrors checks batches CreateMany refuses or rolls back
+func TestCreateManyErrors(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		users []testUser
+		// err is matched if set, any error passes otherwise
+		err error
+	}{
+		{"mixed keys", []testUser{{ID: 5}, {}}, ErrBatchKeys},
+		{"duplicate key", []testUser{{ID: 5}, {ID: 5}}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := testDB(t, testUsers)
+			g := testGateway(t, db, "users")
+			err := g.CreateMany(&tc.users, 1)
+			if err == nil || tc.err != nil && !errors.Is(err, tc.err) {
+				t.Fatalf("CreateMany() = %v, want %v", err, tc.err)
+			}
+			if n := testCount(t, db, "users", "1 = 1"); n != 0 {
+				t.Errorf("%d rows, want the batch rolled back", n)
+			}
+		})
+	}
+}
+
+// TestCreateManyEmpty checks that empty batches are no statement
+func TestCreateManyEmpty(t *testing.T) {
+	c := &testConn{DB: testDB(t, testUsers)}
+	if err := testGateway(t, c, "users").CreateMany(&[]testUser{}, 0); err != nil || c.count() != 0 {
+		t.Fatalf("CreateMany() = %v after %d statements", err, c.count())
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// BufferedWriter collects creates of a gateway and writes them as multi row
+// inserts of CreateMany, see Buffered. It is safe for concurrent use.
+type BufferedWriter struct {
+	g        *Gateway
+	size     int
+	mu       sync.Mutex
+	flushMu  sync.Mutex
+	pending  map[reflect.Type]reflect.Value
+	types    []reflect.Type
+	count    int
+	err      error
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Buffered returns a BufferedWriter flushing once flushSize entities are
+// collected and every flushInterval unless it is zero. A flush runs one
+// CreateMany per entity type, types in the order they were first added, so
+// hooks, validation and generated IDs apply as for CreateMany. If a type
+// fails the others are still written and the first error is returned, the
+// entities of the failed type are dropped. An error of a timed flush is
+// returned by the next call of Create, Flush or Close. Call Close to stop the
+// timer and write the remaining entities.
+func (g *Gateway) Buffered(flushSize int, flushInterval time.Duration) (*BufferedWriter, error) {
+
+	if flushSize < 1 || flushInterval < 0 {
+		return nil, ErrOption
+	}
+
+	b := &BufferedWriter{
+		g:       g,
+		size:    flushSize,
+		pending: map[reflect.Type]reflect.Value{},
+		stop:    make(chan struct{}),
+	}
+
+	if flushInterval > 0 {
+		b.wg.Add(1)
+		go b.run(flushInterval)
+	}
+
+	return b, nil
+}
+
+// Create adds the entity dest points to, flushing if the buffer is full. The
+// entity must not be modified until it was flushed.
+func (b *BufferedWriter) Create(dest interface{}) error {
+	return b.CreateContext(context.Background(), dest)
+}
+
+// CreateContext is like Create but flushes with given context
+func (b *BufferedWriter) CreateContext(ctx context.Context, dest interface{}) error {
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return ErrStructConfig
+	}
+
+	if _, err := parseMeta(dest); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	if err := b.err; err != nil {
+		b.err = nil
+		b.mu.Unlock()
+		return err
+	}
+	t := v.Type()
+	s, ok := b.pending[t]
+	if !ok {
+		s = reflect.MakeSlice(reflect.SliceOf(t), 0, b.size)
+		b.types = append(b.types, t)
+	}
+	b.pending[t] = reflect.Append(s, v)
+	b.count++
+	full := b.count >= b.size
+	b.mu.Unlock()
+
+	if full {
+		return b.FlushContext(ctx)
+	}
+
+	return nil
+}
+
+// Flush writes all collected entities
+func (b *BufferedWriter) Flush() error {
+	return b.FlushContext(context.Background())
+}
+
+// FlushContext is like Flush but runs with given context
+func (b *BufferedWriter) FlushContext(ctx context.Context) error {
+
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	pending, types, err := b.pending, b.types, b.err
+	b.pending, b.types, b.count, b.err = map[reflect.Type]reflect.Value{}, nil, 0, nil
+	b.mu.Unlock()
+
+	var first error
+	for _, t := range types {
+		s := reflect.New(reflect.SliceOf(t))
+		s.Elem().Set(pending[t])
+		if cerr := b.g.CreateManyContext(ctx, s.Interface(), 0); cerr != nil && first == nil {
+			first = cerr
+		}
+	}
+
+	// The error of an earlier timed flush comes first
+	switch {
+	case err == nil:
+		return first
+	case first == nil:
+		return err
+	}
+
+	return errors.Join(err, first)
+}
+
+// Close stops the timer and writes the remaining entities
+func (b *BufferedWriter) Close() error {
+	b.stopOnce.Do(func() { close(b.stop) })
+	b.wg.Wait()
+	return b.Flush()
+}
+
+// run flushes every interval until stopped
+func (b *BufferedWriter) run(interval time.Duration) {
+
+	defer b.wg.Done()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-t.C:
+			if err := b.Flush(); err != nil {
+				b.mu.Lock()
+				if b.err == nil {
+					b.err = err
+				}
+				b.mu.Unlock()
+			}
+		}
+	}
+}
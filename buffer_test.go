@@ -0,0 +1,163 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testBadUser is written to users but names a column the table lacks
+type testBadUser struct {
+	ID   uint64 `db:"id" tgw:"primary"`
+	Nope string `db:"nope" tgw:"insert"`
+}
+
+// TestBufferedWriter checks when collected entities are written
+func TestBufferedWriter(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		size   int
+		add    []interface{}
+		finish func(b *BufferedWriter) error
+		rows   int
+		err    bool
+		total  int
+	}{
+		{"below size", 3, []interface{}{&testUser{Name: "a"}, &testUser{Name: "b"}}, nil, 0, false, 2},
+		{"size reached", 2, []interface{}{&testUser{Name: "a"}, &testUser{Name: "b"}, &testUser{Name: "c"}}, nil, 2, false, 3},
+		{"flush", 3, []interface{}{&testUser{Name: "a"}}, (*BufferedWriter).Flush, 1, false, 1},
+		{"close", 3, []interface{}{&testUser{Name: "a"}, &testUser{Name: "b"}}, (*BufferedWriter).Close, 2, false, 2},
+		{"failing type", 5, []interface{}{&testUser{Name: "a"}, &testBadUser{}, &testUser{Name: "b"}}, (*BufferedWriter).Flush, 2, true, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := testDB(t, testUsers)
+			g := testGateway(t, db, "users", WithDialect(testReturning{SQLite}))
+			b, err := g.Buffered(tc.size, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, e := range tc.add {
+				if err := b.Create(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.finish != nil {
+				if n := testCount(t, db, "users", "1 = 1"); n != 0 {
+					t.Fatalf("%d rows before flush, want none", n)
+				}
+				if err := tc.finish(b); (err != nil) != tc.err {
+					t.Fatalf("flush = %v, want error %v", err, tc.err)
+				}
+			}
+
+			if n := testCount(t, db, "users", "1 = 1"); n != tc.rows {
+				t.Errorf("%d rows, want %d", n, tc.rows)
+			}
+			// Failed entities are dropped, the second flush writes the rest
+			if err := b.Flush(); err != nil {
+				t.Fatalf("second flush = %v", err)
+			}
+			if n := testCount(t, db, "users", "1 = 1"); n != tc.total {
+				t.Errorf("%d rows after second flush, want %d", n, tc.total)
+			}
+			for _, e := range tc.add {
+				if u, ok := e.(*testUser); ok && u.ID == 0 {
+					t.Errorf("written %+v got no id", u)
+				}
+			}
+		})
+	}
+}
+
+// TestBufferedWriterTimer checks that timed flushes write entities and pass
+// their errors to the next call
+func TestBufferedWriterTimer(t *testing.T) {
+
+	db := testDB(t, testUsers)
+	b, err := testGateway(t, db, "users").Buffered(10, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = b.Close() }()
+
+	if err := b.Create(&testUser{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Create(&testBadUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for testCount(t, db, "users", "1 = 1") == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := testCount(t, db, "users", "1 = 1"); n != 1 {
+		t.Fatalf("%d rows after timed flush, want 1", n)
+	}
+
+	// The error is stored after the flush wrote the row
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		failed := b.err != nil
+		b.mu.Unlock()
+		if failed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := b.Create(&testUser{Name: "b"}); err == nil {
+		t.Fatal("Create() after failed timed flush succeeded")
+	}
+	if err := b.Create(&testUser{Name: "b"}); err != nil {
+		t.Fatalf("Create() after reported error = %v", err)
+	}
+}
+
+// TestBufferedErrors checks the arguments refused by the buffered writer
+func TestBufferedErrors(t *testing.T) {
+
+	g := testGateway(t, testDB(t, testUsers), "users")
+
+	for _, tc := range []struct {
+		name          string
+		size          int
+		interval      time.Duration
+		wantErrOption bool
+	}{
+		{"zero size", 0, 0, true},
+		{"negative interval", 1, -time.Second, true},
+		{"valid", 1, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := g.Buffered(tc.size, tc.interval)
+			if errors.Is(err, ErrOption) != tc.wantErrOption {
+				t.Fatalf("Buffered() = %v", err)
+			}
+			if b == nil {
+				return
+			}
+			if err := b.Create(testUser{}); !errors.Is(err, ErrStructConfig) {
+				t.Errorf("Create() of a value = %v, want ErrStructConfig", err)
+			}
+		})
+	}
+}
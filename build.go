@@ -0,0 +1,259 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// BuildCreate returns the INSERT statement and its arguments for given entity
+// without executing it
+func BuildCreate(table string, dest interface{}) (string, []interface{}, error) {
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return "", nil, err
+	}
+	return buildCreate(table, dest, destcfg)
+}
+
+// BuildRead returns the SELECT statement and its arguments reading given
+// entity by its primary key without executing it
+func BuildRead(table string, dest interface{}) (string, []interface{}, error) {
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return "", nil, err
+	}
+	q, args := buildRead(table, dest, destcfg, nil)
+	return q, args, nil
+}
+
+// BuildUpdate returns the UPDATE statement and its arguments for given entity
+// without executing it
+func BuildUpdate(table string, dest interface{}) (string, []interface{}, error) {
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return "", nil, err
+	}
+	return buildUpdate(table, dest, destcfg, updateSet(dest, destcfg))
+}
+
+// BuildDelete returns the DELETE statement and its arguments for given entity
+// without executing it
+func BuildDelete(table string, dest interface{}) (string, []interface{}, error) {
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return "", nil, err
+	}
+	q, args := buildDelete(table, dest, destcfg)
+	return q, args, nil
+}
+
+// BuildSelect returns the SELECT statement and its arguments for given
+// selectors and ordering without executing it
+func BuildSelect(table string, params Condition, orderby Orderer) (string, []interface{}) {
+	return buildSelect(table, nil, params, orderby, "")
+}
+
+// buildSelect builds the SELECT statement of given columns, all if empty, for
+// given selectors and ordering, skipping soft deleted rows if softcol is set
+func buildSelect(table string, cols []string, params Condition, orderby Orderer, softcol string) (string, []interface{}) {
+	where, args := whereClause(params)
+	where = withoutDeleted(where, softcol)
+	return fmt.Sprintf("SELECT %s FROM %s", selectList(cols), quoteTable(table)) + where + orderClause(orderby, quoteColumn), args
+}
+
+// selectList renders the columns of a SELECT statement, all if cols is empty
+func selectList(cols []string) string {
+	if len(cols) == 0 {
+		return "*"
+	}
+	return strings.Join(quoteIdents(cols), ",")
+}
+
+// buildCreate builds the INSERT statement for entity
+func buildCreate(table string, dest interface{}, destcfg *tabMeta) (string, []interface{}, error) {
+	cols, _ := insertCols(dest, destcfg)
+	q := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		quoteTable(table),
+		strings.Join(quoteIdents(cols), ","),
+		strings.Join(nowValues(cols, quoteNamedValues(cols), destcfg), ","),
+	)
+	return bindNamed(q, dest, destcfg)
+}
+
+// insertCols returns the columns to insert for entity and whether its primary
+// key is generated by the database. Only single integer keys are generated,
+// keys of other types like strings or UUIDs, keys tagged noauto and keys
+// already holding a value are written like any other column.
+func insertCols(dest interface{}, destcfg *tabMeta) ([]string, bool) {
+
+	auto := false
+	if len(destcfg.PrimaryNames) == 1 && !destcfg.NoAuto {
+		f := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.PrimaryIdx[0])
+		auto = isInteger(f.Kind()) && f.IsZero()
+	}
+
+	if auto {
+		return destcfg.InsertCols, true
+	}
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	for _, col := range destcfg.PrimaryDBs {
+		if !inArray(col, destcfg.InsertCols) {
+			cols = append(cols, col)
+		}
+	}
+
+	return append(cols, destcfg.InsertCols...), false
+}
+
+// buildRead builds the SELECT statement reading given columns, all if empty,
+// of entity by primary key
+func buildRead(table string, dest interface{}, destcfg *tabMeta, cols []string) (string, []interface{}) {
+	where := " WHERE " + strings.Join(quoteSelectSet(destcfg.PrimaryDBs), " AND ")
+	q := fmt.Sprintf("SELECT %s FROM %s", selectList(cols), quoteTable(table)) + withoutDeleted(where, destcfg.SoftDelete)
+	return q, getPriVals(dest, destcfg)
+}
+
+// buildUpdate builds the UPDATE statement writing given columns of entity.
+// Versioned entities are only updated if their version is unchanged and get
+// their version incremented.
+func buildUpdate(table string, dest interface{}, destcfg *tabMeta, cols []string) (string, []interface{}, error) {
+
+	where := quoteUpdateSet(destcfg.PrimaryDBs)
+
+	//noinspection GoPreferNilSlice
+	set := []string{}
+	for _, col := range cols {
+		if col != destcfg.Version {
+			set = append(set, col)
+		}
+	}
+	set = nowSet(set, quoteUpdateSet(set), destcfg)
+
+	if destcfg.Version != "" {
+		set = append(set, fmt.Sprintf("`%s` = `%s` + 1", destcfg.Version, destcfg.Version))
+		where = append(where, quoteUpdateSet([]string{destcfg.Version})...)
+	}
+
+	q := fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s",
+		quoteTable(table),
+		strings.Join(set, ","),
+		strings.Join(where, " AND "),
+	)
+	return bindNamed(q, dest, destcfg)
+}
+
+// buildDelete builds the DELETE statement removing entity by primary key. For
+// entities with a soft delete column it builds an UPDATE setting that column
+// to the current time if the row was not deleted yet instead.
+func buildDelete(table string, dest interface{}, destcfg *tabMeta) (string, []interface{}) {
+	if destcfg.SoftDelete != "" {
+		q, args := buildMarkDeleted(table, dest, destcfg, time.Now())
+		return q + fmt.Sprintf(" AND `%s` IS NULL", destcfg.SoftDelete), args
+	}
+	q := fmt.Sprintf(
+		"DELETE FROM %s WHERE %s",
+		quoteTable(table),
+		strings.Join(quoteSelectSet(destcfg.PrimaryDBs), " AND "),
+	)
+	return q, getPriVals(dest, destcfg)
+}
+
+// buildMarkDeleted builds the UPDATE statement setting the soft delete column
+// of entity to given value
+func buildMarkDeleted(table string, dest interface{}, destcfg *tabMeta, value interface{}) (string, []interface{}) {
+	q := fmt.Sprintf(
+		"UPDATE %s SET `%s` = ? WHERE %s",
+		quoteTable(table),
+		destcfg.SoftDelete,
+		strings.Join(quoteSelectSet(destcfg.PrimaryDBs), " AND "),
+	)
+	return q, append([]interface{}{value}, getPriVals(dest, destcfg)...)
+}
+
+// buildReadMany builds the SELECT statement reading all entities with given
+// primary keys. Composite keys expect each id to be a []interface{}.
+func buildReadMany(table string, destcfg *tabMeta, ids []interface{}) (string, []interface{}, error) {
+
+	where, args, err := idsWhere(destcfg, ids)
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := fmt.Sprintf("SELECT * FROM %s", quoteTable(table)) + withoutDeleted(where, destcfg.SoftDelete)
+
+	return q, args, nil
+}
+
+// buildDeleteMany builds the DELETE statement removing all entities with given
+// primary keys. For entities with a soft delete column it builds an UPDATE
+// setting that column to now on the rows not deleted yet instead.
+func buildDeleteMany(table string, destcfg *tabMeta, ids []interface{}, now time.Time) (string, []interface{}, error) {
+
+	where, args, err := idsWhere(destcfg, ids)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if destcfg.SoftDelete == "" {
+		return fmt.Sprintf("DELETE FROM %s", quoteTable(table)) + where, args, nil
+	}
+
+	q := fmt.Sprintf(
+		"UPDATE %s SET `%s` = ?",
+		quoteTable(table),
+		destcfg.SoftDelete,
+	) + withoutDeleted(where, destcfg.SoftDelete)
+
+	return q, append([]interface{}{now}, args...), nil
+}
+
+// idsWhere builds the WHERE clause matching given primary keys with a single
+// IN list. Composite keys expect each id to be a []interface{}.
+func idsWhere(destcfg *tabMeta, ids []interface{}) (string, []interface{}, error) {
+
+	if len(destcfg.PrimaryDBs) == 1 {
+		where := fmt.Sprintf(
+			" WHERE `%s` IN (%s)",
+			destcfg.PrimaryDBs[0],
+			strings.TrimSuffix(strings.Repeat("?,", len(ids)), ","),
+		)
+		return where, ids, nil
+	}
+
+	//noinspection GoPreferNilSlice
+	conds := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, id := range ids {
+		vals, ok := id.([]interface{})
+		if !ok || len(vals) != len(destcfg.PrimaryDBs) {
+			return "", nil, ErrPrimaryType
+		}
+		conds = append(conds, "("+strings.Join(quoteSelectSet(destcfg.PrimaryDBs), " AND ")+")")
+		args = append(args, vals...)
+	}
+
+	return " WHERE (" + strings.Join(conds, " OR ") + ")", args, nil
+}
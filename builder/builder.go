@@ -0,0 +1,124 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package builder builds the statements table gateways run for tagged structs
+// without executing them, e.g. to run them through a custom driver or to queue
+// them for later. Statements are rendered in the dialect of the builder.
+//
+// The fragment helpers like QuoteIdents use backtick quoted identifiers and ?
+// placeholders like the gateway does internally, pass statements assembled
+// from them through Builder.Translate.
+package builder
+
+import (
+	"fmt"
+	"github.com/mrccnt/go-table-gateway"
+	"strings"
+)
+
+// Builder builds statements in a dialect
+type Builder struct {
+	d tgw.Dialect
+}
+
+// New returns a Builder rendering statements in dialect d, MySQL if nil
+func New(d tgw.Dialect) *Builder {
+	if d == nil {
+		d = tgw.MySQL
+	}
+	return &Builder{d: d}
+}
+
+// Dialect returns the dialect of the builder
+func (b *Builder) Dialect() tgw.Dialect {
+	return b.d
+}
+
+// Insert builds the INSERT statement writing entity to table
+func (b *Builder) Insert(table string, entity interface{}) (string, []interface{}, error) {
+	return b.translate(tgw.BuildCreate(table, entity))
+}
+
+// Read builds the SELECT statement reading entity from table by its primary
+// key
+func (b *Builder) Read(table string, entity interface{}) (string, []interface{}, error) {
+	return b.translate(tgw.BuildRead(table, entity))
+}
+
+// Update builds the UPDATE statement writing the update columns of entity to
+// table
+func (b *Builder) Update(table string, entity interface{}) (string, []interface{}, error) {
+	return b.translate(tgw.BuildUpdate(table, entity))
+}
+
+// Delete builds the statement removing entity from table by its primary key.
+// Entities with a soft delete column get an UPDATE marking them deleted.
+func (b *Builder) Delete(table string, entity interface{}) (string, []interface{}, error) {
+	return b.translate(tgw.BuildDelete(table, entity))
+}
+
+// Select builds the SELECT statement of all rows of table matching params in
+// given order
+func (b *Builder) Select(table string, params tgw.Condition, orderby tgw.Orderer) (string, []interface{}) {
+	q, args := tgw.BuildSelect(table, params, orderby)
+	return b.Translate(q), args
+}
+
+// Translate rewrites a statement assembled from backtick quoted identifiers
+// and ? placeholders to the dialect of the builder
+func (b *Builder) Translate(q string) string {
+	return tgw.Translate(b.d, q)
+}
+
+// translate translates the result of a tgw.Build function
+func (b *Builder) translate(q string, args []interface{}, err error) (string, []interface{}, error) {
+	if err != nil {
+		return "", nil, err
+	}
+	return b.Translate(q), args, nil
+}
+
+// QuoteIdent quotes a single identifier with backticks
+func QuoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// QuoteIdents quotes all given identifiers with backticks
+func QuoteIdents(names ...string) []string {
+	//noinspection GoPreferNilSlice
+	quoted := []string{}
+	for _, n := range names {
+		quoted = append(quoted, QuoteIdent(n))
+	}
+	return quoted
+}
+
+// AssignSet renders `name` = ? for every name, usable in SET clauses and,
+// joined by AND, in WHERE clauses
+func AssignSet(names ...string) []string {
+	//noinspection GoPreferNilSlice
+	set := []string{}
+	for _, n := range names {
+		set = append(set, fmt.Sprintf("%s = ?", QuoteIdent(n)))
+	}
+	return set
+}
+
+// Placeholders renders n comma separated ? placeholders
+func Placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
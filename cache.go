@@ -0,0 +1,408 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Cache stores encoded entities for read through caching of Read, see
+// WithCache. Implementations must be safe for concurrent use. A ttl of zero
+// keeps entries until they are deleted or evicted.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+// WithCache lets Read look up entities in c by table and primary key before
+// querying the database and store the rows it read for ttl. Writes of the
+// gateway delete the entries of the entities they changed once they are
+// committed, set based writes like UpdateWhere invalidate all entries of their
+// table. Concurrent reads missing the same entity share a single query, whose
+// row is not stored if the entity was changed while it ran. Reads within
+// transactions, with row locks, unscoped or tenant bound gateways and of
+// entities with encrypted columns bypass the cache. Writes by other processes
+// or gateways not sharing the option are not seen before the entries expired,
+// see NewRemoteCache for caches shared between processes. Their writes are not
+// tracked against reads in flight either, which may store the row such a write
+// replaced until it expires.
+func WithCache(c Cache, ttl time.Duration) Option {
+	return func(g *Gateway) error {
+		if c == nil || ttl < 0 {
+			return ErrOption
+		}
+		rc := &readCache{c: c, ttl: ttl, gens: map[string]uint64{}, calls: map[string]*cacheCall{}}
+		g.cache = rc
+		g.onChange = append(append([]func(Event){}, g.onChange...), rc.invalidate)
+		return nil
+	}
+}
+
+// WithNegativeCache lets a gateway using WithCache remember entities Read did
+// not find for ttl, sparing the database from repeated lookups of missing
+// keys. Creating the entity through the gateway removes the entry.
+func WithNegativeCache(ttl time.Duration) Option {
+	return func(g *Gateway) error {
+		if ttl <= 0 {
+			return ErrOption
+		}
+		g.cacheMiss = ttl
+		return nil
+	}
+}
+
+// readCache stores entities read by their gateway in a Cache. Concurrent
+// misses of the same key are coalesced into a single database read.
+type readCache struct {
+	c     Cache
+	ttl   time.Duration
+	mu    sync.Mutex
+	gens  map[string]uint64
+	calls map[string]*cacheCall
+}
+
+// cacheCall is a database read in flight for a cache key. Val holds the
+// encoded entity if it was read and could be encoded, missing is set if it
+// was not found. Stale is set if the entity was invalidated during the read,
+// which then neither stores nor shares its result.
+type cacheCall struct {
+	done    chan struct{}
+	val     []byte
+	missing bool
+	stale   bool
+}
+
+// key returns the cache key of the entity of table with given primary key
+// values. It includes the generation of the table, which set based writes
+// increment to invalidate all of its entries at once.
+func (rc *readCache) key(table string, vals []interface{}) string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.genKey(table, vals)
+}
+
+// genKey is like key, the caller must hold the lock
+func (rc *readCache) genKey(table string, vals []interface{}) string {
+	return fmt.Sprintf("tgw:%s:%d:%v", table, rc.gens[table], vals)
+}
+
+// invalidate removes the entries changed by ev and marks reads of them in
+// flight as stale
+func (rc *readCache) invalidate(ev Event) {
+
+	rc.mu.Lock()
+
+	if ev.Key == nil {
+		rc.gens[ev.Table]++
+		rc.mu.Unlock()
+		return
+	}
+
+	key := rc.genKey(ev.Table, ev.Key)
+	if c, ok := rc.calls[key]; ok {
+		c.stale = true
+	}
+
+	rc.mu.Unlock()
+
+	rc.c.Delete(key)
+}
+
+// read loads the entity stored under key into dest. On a miss it reads it
+// with fetch and stores it, or remembers it missing for miss if non zero.
+// Callers missing a key another one is fetching wait for its result.
+func (rc *readCache) read(ctx context.Context, key string, dest interface{}, destcfg *tabMeta, miss time.Duration, fetch func() error) error {
+
+	if b, ok := rc.c.Get(key); ok {
+		// Entries of missing entities are empty, gob never encodes to nothing
+		if len(b) == 0 {
+			return notFound(sql.ErrNoRows)
+		}
+		if rc.decode(b, dest, destcfg) {
+			return nil
+		}
+		rc.c.Delete(key)
+	}
+
+	rc.mu.Lock()
+	if c, ok := rc.calls[key]; ok {
+		rc.mu.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if c.val != nil && rc.decode(c.val, dest, destcfg) {
+			return nil
+		}
+		if c.missing {
+			return notFound(sql.ErrNoRows)
+		}
+		// The read failed for another reason, which may not apply to this one
+		return fetch()
+	}
+	c := &cacheCall{done: make(chan struct{})}
+	rc.calls[key] = c
+	rc.mu.Unlock()
+
+	defer func() {
+		rc.mu.Lock()
+		delete(rc.calls, key)
+		rc.mu.Unlock()
+		close(c.done)
+	}()
+
+	err := fetch()
+
+	// The lock keeps invalidate from deleting the key before it is stored
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if c.stale {
+		return err
+	}
+
+	switch {
+	case err == nil:
+		if c.val = rc.encode(dest, destcfg); c.val != nil {
+			rc.c.Set(key, c.val, rc.ttl)
+		}
+	case errors.Is(err, ErrNotFound):
+		c.missing = true
+		if miss > 0 {
+			rc.c.Set(key, []byte{}, miss)
+		}
+	}
+
+	return err
+}
+
+// decode decodes the entity b into the columns of dest and reports if it
+// succeeded
+func (rc *readCache) decode(b []byte, dest interface{}, destcfg *tabMeta) bool {
+
+	target := reflect.Indirect(reflect.ValueOf(dest).Elem())
+	v := reflect.New(target.Type())
+	if err := gob.NewDecoder(bytes.NewReader(b)).DecodeValue(v); err != nil {
+		return false
+	}
+
+	copyColumns(target, v.Elem(), destcfg)
+
+	return true
+}
+
+// encode encodes the columns of dest. It returns nil for entities gob can not
+// encode, which are not cached.
+func (rc *readCache) encode(dest interface{}, destcfg *tabMeta) []byte {
+
+	src := reflect.Indirect(reflect.ValueOf(dest).Elem())
+	v := reflect.New(src.Type())
+	copyColumns(v.Elem(), src, destcfg)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).EncodeValue(v); err != nil {
+		return nil
+	}
+
+	return buf.Bytes()
+}
+
+// cacheKey returns the cache key of entity dest read from table and reports
+// if the read may use the cache
+func (g *Gateway) cacheKey(table string, dest interface{}, destcfg *tabMeta) (string, bool) {
+	if g.cache == nil || g.tx != nil || g.lock != LockNone || g.unscoped || g.tenant != nil || len(destcfg.Encrypted) > 0 {
+		return "", false
+	}
+	return g.cache.key(table, getPriVals(dest, destcfg)), true
+}
+
+// copyColumns copies the column fields of struct value src to dst, leaving
+// relations and other untagged fields alone
+func copyColumns(dst reflect.Value, src reflect.Value, destcfg *tabMeta) {
+	for _, idx := range destcfg.Fields {
+		dst.FieldByIndex(idx).Set(src.FieldByIndex(idx))
+	}
+}
+
+// LRU is an in-process Cache holding up to a fixed number of entries, evicting
+// the least recently used one when full
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// lruEntry is an element of the LRU list
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an LRU holding up to size entries
+func NewLRU(size int) *LRU {
+	if size < 1 {
+		size = 1
+	}
+	return &LRU{size: size, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+// Get implements Cache
+func (l *LRU) Get(key string) ([]byte, bool) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*lruEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		l.remove(el)
+		return nil, false
+	}
+
+	l.ll.MoveToFront(el)
+
+	return e.value, true
+}
+
+// Set implements Cache
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if el, ok := l.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expires = value, expires
+		l.ll.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for l.ll.Len() > l.size {
+		l.remove(l.ll.Back())
+	}
+}
+
+// Delete implements Cache
+func (l *LRU) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+}
+
+// Len returns the number of entries, including expired ones not yet removed
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+// remove deletes el from the list and index
+func (l *LRU) remove(el *list.Element) {
+	l.ll.Remove(el)
+	delete(l.items, el.Value.(*lruEntry).key)
+}
+
+// KV is the client of a remote key value store like Redis or memcached, which
+// a small adapter maps to the clients library. Get reports missing keys by
+// returning false and no error.
+type KV interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// RemoteCache is a Cache on a KV store shared by multiple processes. Writes of
+// one process delete the changed entries for all of them, set based writes
+// like UpdateWhere however only invalidate the entries of the process running
+// them and others keep serving theirs until they expire.
+type RemoteCache struct {
+	kv      KV
+	timeout time.Duration
+	onError func(error)
+}
+
+// NewRemoteCache returns a Cache on kv. Each request to the store is bounded by
+// timeout if it is non zero. Failed requests are passed to onError, which may
+// be nil, and reads count as misses.
+func NewRemoteCache(kv KV, timeout time.Duration, onError func(error)) *RemoteCache {
+	return &RemoteCache{kv: kv, timeout: timeout, onError: onError}
+}
+
+// Get implements Cache
+func (r *RemoteCache) Get(key string) ([]byte, bool) {
+	ctx, cancel := r.context()
+	defer cancel()
+	b, ok, err := r.kv.Get(ctx, key)
+	if err != nil {
+		r.fail(err)
+		return nil, false
+	}
+	return b, ok
+}
+
+// Set implements Cache
+func (r *RemoteCache) Set(key string, value []byte, ttl time.Duration) {
+	ctx, cancel := r.context()
+	defer cancel()
+	r.fail(r.kv.Set(ctx, key, value, ttl))
+}
+
+// Delete implements Cache
+func (r *RemoteCache) Delete(key string) {
+	ctx, cancel := r.context()
+	defer cancel()
+	r.fail(r.kv.Delete(ctx, key))
+}
+
+// context returns the context of a request to the store
+func (r *RemoteCache) context() (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(context.Background(), r.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// fail passes err to the error handler if both are non nil
+func (r *RemoteCache) fail(err error) {
+	if err != nil && r.onError != nil {
+		r.onError(err)
+	}
+}
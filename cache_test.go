@@ -0,0 +1,285 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCacheGateway returns a gateway on users caching in an LRU holding user
+// 1 and the connection it runs on
+func testCacheGateway(t *testing.T, opts ...Option) (*Gateway, *testConn) {
+
+	t.Helper()
+
+	c := &testConn{DB: testDB(t, testUsers)}
+	g := testGateway(t, c, "users", append([]Option{WithCache(NewLRU(10), 0)}, opts...)...)
+	testCreate(t, g, &testUser{Name: "a"})
+
+	return g, c
+}
+
+// TestCacheReadThrough checks which operations leave the cached entity in
+// place and which make the next Read query the database again
+func TestCacheReadThrough(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		between func(g *Gateway) error
+		want    string
+		queries int
+	}{
+		{"read again", func(g *Gateway) error {
+			return nil
+		}, "a", 0},
+		{"read other entity", func(g *Gateway) error {
+			return g.Read(&testUser{ID: 9})
+		}, "a", 0},
+		{"update", func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "b"})
+		}, "b", 1},
+		{"update partial", func(g *Gateway) error {
+			return g.UpdatePartial(&testUser{ID: 1, Name: "b"})
+		}, "b", 1},
+		{"update where", func(g *Gateway) error {
+			_, err := g.UpdateWhere(map[string]interface{}{"name": "b"}, Selectors{"id": 1})
+			return err
+		}, "b", 1},
+		{"delete", func(g *Gateway) error {
+			if err := g.Delete(&testUser{ID: 1}); err != nil {
+				return err
+			}
+			return g.Create(&testUser{ID: 1, Name: "b"})
+		}, "b", 1},
+		{"committed transaction", func(g *Gateway) error {
+			return g.WithTx(func(txg *Gateway) error {
+				return txg.Update(&testUser{ID: 1, Name: "b"})
+			})
+		}, "b", 1},
+		{"rolled back transaction", func(g *Gateway) error {
+			err := g.WithTx(func(txg *Gateway) error {
+				if err := txg.Update(&testUser{ID: 1, Name: "b"}); err != nil {
+					return err
+				}
+				return ErrNotFound
+			})
+			if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			return nil
+		}, "a", 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, c := testCacheGateway(t)
+
+			if err := g.Read(&testUser{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.between(g); err != nil && !errors.Is(err, ErrNotFound) {
+				t.Fatal(err)
+			}
+
+			n := c.count()
+			u := testUser{ID: 1}
+			if err := g.Read(&u); err != nil || u.Name != tc.want {
+				t.Fatalf("Read() = %v, %+v, want name %q", err, u, tc.want)
+			}
+			if err := g.Read(&testUser{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := c.count() - n; got != tc.queries {
+				t.Errorf("reads ran %d statements, want %d", got, tc.queries)
+			}
+		})
+	}
+}
+
+// TestCacheBypass checks the reads that must not be served from the cache
+func TestCacheBypass(t *testing.T) {
+
+	tests := []struct {
+		name string
+		view func(t *testing.T, g *Gateway) (*Gateway, func() error)
+	}{
+		{"transaction", func(t *testing.T, g *Gateway) (*Gateway, func() error) {
+			txg, err := g.BeginTx(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return txg, txg.Rollback
+		}},
+		{"locking", func(t *testing.T, g *Gateway) (*Gateway, func() error) {
+			return g.Lock(LockForUpdate), func() error { return nil }
+		}},
+		{"unscoped", func(t *testing.T, g *Gateway) (*Gateway, func() error) {
+			return g.Unscoped(), func() error { return nil }
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, c := testCacheGateway(t)
+			if err := g.Read(&testUser{ID: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			// A write by someone else the cache does not know about
+			if _, err := c.DB.Exec("UPDATE users SET name = 'b' WHERE id = 1"); err != nil {
+				t.Fatal(err)
+			}
+
+			u := testUser{ID: 1}
+			if err := g.Read(&u); err != nil || u.Name != "a" {
+				t.Fatalf("cached Read() = %v, %+v, want name a", err, u)
+			}
+
+			vg, done := tc.view(t, g)
+			u = testUser{ID: 1}
+			if err := vg.Read(&u); err != nil || u.Name != "b" {
+				t.Errorf("Read() = %v, %+v, want name b", err, u)
+			}
+			if err := done(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// TestNegativeCache checks that missing entities are remembered until created
+// through the gateway
+func TestNegativeCache(t *testing.T) {
+
+	g, c := testCacheGateway(t, WithNegativeCache(time.Hour))
+
+	if err := g.Read(&testUser{ID: 2}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read() = %v, want ErrNotFound", err)
+	}
+
+	n := c.count()
+	if err := g.Read(&testUser{ID: 2}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("cached Read() = %v, want ErrNotFound", err)
+	}
+	if c.count() != n {
+		t.Fatalf("cached Read() ran %d statements", c.count()-n)
+	}
+
+	testCreate(t, g, &testUser{Name: "b"})
+	if err := g.Read(&testUser{ID: 2}); err != nil {
+		t.Fatalf("Read() after Create = %v", err)
+	}
+}
+
+// TestCacheOptions checks the validation of the cache options
+func TestCacheOptions(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"no cache", WithCache(nil, 0)},
+		{"negative ttl", WithCache(NewLRU(1), -time.Second)},
+		{"zero negative ttl", WithNegativeCache(0)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewGateway(testDB(t), "users", tc.opt); !errors.Is(err, ErrOption) {
+				t.Fatalf("NewGateway() = %v, want ErrOption", err)
+			}
+		})
+	}
+}
+
+// TestReadCacheCoalesce checks that concurrent misses of a key share a single
+// fetch
+func TestReadCacheCoalesce(t *testing.T) {
+
+	rc := &readCache{c: NewLRU(10), gens: map[string]uint64{}, calls: map[string]*cacheCall{}}
+	m, err := structMeta(reflect.TypeOf(testUser{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := rc.key("users", []interface{}{1})
+
+	var fetches int
+	release := make(chan struct{})
+	fetch := func(u *testUser) func() error {
+		return func() error {
+			fetches++
+			<-release
+			u.ID, u.Name = 1, "a"
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	users := make([]testUser, 5)
+	errs := make([]error, len(users))
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = rc.read(context.Background(), key, &users[i], m, 0, fetch(&users[i]))
+		}(i)
+	}
+
+	// Let the waiters queue behind the first fetch
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, u := range users {
+		if errs[i] != nil || u.Name != "a" {
+			t.Errorf("read %d = %v, %+v", i, errs[i], u)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("%d fetches, want 1", fetches)
+	}
+}
+
+// TestReadCacheStale checks that a row read while its entity was changed is
+// not stored
+func TestReadCacheStale(t *testing.T) {
+
+	rc := &readCache{c: NewLRU(10), gens: map[string]uint64{}, calls: map[string]*cacheCall{}}
+	m, err := structMeta(reflect.TypeOf(testUser{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := rc.key("users", []interface{}{uint64(1)})
+
+	u := testUser{}
+	err = rc.read(context.Background(), key, &u, m, 0, func() error {
+		u.ID, u.Name = 1, "a"
+		rc.invalidate(Event{Table: "users", Key: []interface{}{uint64(1)}})
+		return nil
+	})
+	if err != nil || u.Name != "a" {
+		t.Fatalf("read = %v, %+v", err, u)
+	}
+
+	if _, ok := rc.c.Get(key); ok {
+		t.Fatal("stale row was stored")
+	}
+}
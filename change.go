@@ -0,0 +1,196 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"github.com/jmoiron/sqlx"
+	"sync"
+)
+
+// Event describes a successful write. Op is "create", "update" or "delete".
+// Key holds the primary key values of the written entity and is nil for set
+// based operations like UpdateWhere, which may have changed any row of Table.
+type Event struct {
+	Op    string
+	Table string
+	Key   []interface{}
+}
+
+// OnChange adds fn to the functions called after every successful write.
+// Writes within a transaction started by a gateway, see BeginTx and Transact,
+// are reported after it was committed and dropped on rollback. This includes
+// writes of other gateways bound to it with BindTx. Gateways bound to a
+// *sqlx.Tx started elsewhere report immediately. Fn runs synchronously and
+// should hand off slow work.
+func OnChange(fn func(Event)) Option {
+	return func(g *Gateway) error {
+		if fn == nil {
+			return ErrOption
+		}
+		g.onChange = append(append([]func(Event){}, g.onChange...), fn)
+		return nil
+	}
+}
+
+// changeQueue holds the events of a transaction until it is committed
+type changeQueue struct {
+	mu     sync.Mutex
+	events []func()
+	marks  map[string]int
+}
+
+// txQueues holds the change queues of transactions started by a gateway, so
+// all gateways bound to one of them share its queue
+var txQueues = struct {
+	sync.Mutex
+	m map[*sqlx.Tx]*changeQueue
+}{m: map[*sqlx.Tx]*changeQueue{}}
+
+// openQueue registers a change queue for tx
+func openQueue(tx *sqlx.Tx) {
+	txQueues.Lock()
+	txQueues.m[tx] = &changeQueue{}
+	txQueues.Unlock()
+}
+
+// txQueue returns the change queue of tx or nil if tx was not started by a
+// gateway
+func txQueue(tx *sqlx.Tx) *changeQueue {
+	txQueues.Lock()
+	defer txQueues.Unlock()
+	return txQueues.m[tx]
+}
+
+// closeQueue unregisters and returns the change queue of tx, which may be nil
+func closeQueue(tx *sqlx.Tx) *changeQueue {
+	txQueues.Lock()
+	defer txQueues.Unlock()
+	q := txQueues.m[tx]
+	delete(txQueues.m, tx)
+	return q
+}
+
+// add queues fn
+func (q *changeQueue) add(fn func()) {
+	q.mu.Lock()
+	q.events = append(q.events, fn)
+	q.mu.Unlock()
+}
+
+// flush runs and removes all queued events
+func (q *changeQueue) flush() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	events := q.events
+	q.events = nil
+	q.mu.Unlock()
+	for _, fn := range events {
+		fn()
+	}
+}
+
+// mark remembers the number of queued events at savepoint name
+func (q *changeQueue) mark(name string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if q.marks == nil {
+		q.marks = map[string]int{}
+	}
+	q.marks[name] = len(q.events)
+	q.mu.Unlock()
+}
+
+// rollbackTo removes the events queued after savepoint name
+func (q *changeQueue) rollbackTo(name string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	if n, ok := q.marks[name]; ok && n < len(q.events) {
+		q.events = q.events[:n]
+	}
+	q.mu.Unlock()
+}
+
+// release forgets savepoint name
+func (q *changeQueue) release(name string) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	delete(q.marks, name)
+	q.mu.Unlock()
+}
+
+// drop removes all queued events
+func (q *changeQueue) drop() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	q.events = nil
+	q.mu.Unlock()
+}
+
+// changed reports a write of entity dest
+func (g *Gateway) changed(op string, dest interface{}) {
+
+	if len(g.onChange) == 0 {
+		return
+	}
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return
+	}
+
+	g.notify(Event{Op: op, Table: table, Key: getPriVals(dest, destcfg)})
+}
+
+// changedTable reports a set based write of table
+func (g *Gateway) changedTable(op string, table string) {
+	if len(g.onChange) == 0 {
+		return
+	}
+	g.notify(Event{Op: op, Table: table})
+}
+
+// notify runs the change functions now or queues them until the transaction
+// of the gateway is committed
+func (g *Gateway) notify(ev Event) {
+
+	fns := g.onChange
+	fire := func() {
+		for _, fn := range fns {
+			fn(ev)
+		}
+	}
+
+	if g.tx != nil && g.changes != nil {
+		g.changes.add(fire)
+		return
+	}
+
+	fire()
+}
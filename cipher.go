@@ -0,0 +1,238 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Cipher encrypts and decrypts the values of columns tagged with
+// tgw:"encrypted". Ciphertexts are stored in text columns and should not
+// contain binary data.
+type Cipher interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+}
+
+// WithCipher sets the cipher of encrypted columns. Entities with encrypted
+// columns can not be written or read without one. Encrypted columns can not
+// be used in selectors since equal values encrypt differently.
+func WithCipher(c Cipher) Option {
+	return func(g *Gateway) error {
+		if c == nil {
+			return ErrOption
+		}
+		g.cipher = c
+		return nil
+	}
+}
+
+// aesCipher implements Cipher using AES-GCM with a set of named keys
+type aesCipher struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewAESCipher returns a Cipher encrypting with AES-GCM using the key named
+// current. Ciphertexts are prefixed with the name of their key, so values
+// written with any of keys can still be decrypted after rotating current to
+// a new key. Keys must be 16, 24 or 32 bytes long and names must not contain
+// a colon.
+func NewAESCipher(current string, keys map[string][]byte) (Cipher, error) {
+
+	c := &aesCipher{current: current, keys: map[string]cipher.AEAD{}}
+
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("%w: invalid key id %q", ErrCipher, id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrCipher, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[id] = aead
+	}
+
+	if _, ok := c.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrCipher, current)
+	}
+
+	return c, nil
+}
+
+// Encrypt implements Cipher, returning "keyid:base64(nonce|ciphertext)"
+func (c *aesCipher) Encrypt(plaintext []byte) ([]byte, error) {
+
+	aead := c.keys[c.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(c.current))
+
+	return []byte(c.current + ":" + base64.RawStdEncoding.EncodeToString(sealed)), nil
+}
+
+// Decrypt implements Cipher
+func (c *aesCipher) Decrypt(ciphertext []byte) ([]byte, error) {
+
+	parts := strings.SplitN(string(ciphertext), ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: missing key id", ErrCipher)
+	}
+
+	aead, ok := c.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrCipher, parts[0])
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: malformed ciphertext", ErrCipher)
+	}
+
+	n := aead.NonceSize()
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCipher, err)
+	}
+
+	return plain, nil
+}
+
+// cipherColumn encrypts and decrypts a field tagged with tgw:"encrypted". It
+// holds a pointer to a string or []byte field, optionally via a pointer or
+// interface. The cipher is set by the gateway running the query.
+type cipherColumn struct {
+	v interface{}
+	c Cipher
+}
+
+// Value implements driver.Valuer. Nil fields are written as NULL.
+func (e cipherColumn) Value() (driver.Value, error) {
+
+	if e.c == nil {
+		return nil, ErrNoCipher
+	}
+
+	f := reflect.ValueOf(e.v).Elem()
+	for f.Kind() == reflect.Ptr || f.Kind() == reflect.Interface {
+		if f.IsNil() {
+			return nil, nil
+		}
+		f = f.Elem()
+	}
+
+	var plain []byte
+	switch {
+	case f.Kind() == reflect.String:
+		plain = []byte(f.String())
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+		if f.IsNil() {
+			return nil, nil
+		}
+		plain = f.Bytes()
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %s", ErrCipher, f.Type())
+	}
+
+	b, err := e.c.Encrypt(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner. NULL resets the field to its zero value.
+func (e *cipherColumn) Scan(src interface{}) error {
+
+	f := reflect.ValueOf(e.v).Elem()
+
+	var b []byte
+	switch s := src.(type) {
+	case nil:
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrCipher, src)
+	}
+
+	if e.c == nil {
+		return ErrNoCipher
+	}
+
+	plain, err := e.c.Decrypt(b)
+	if err != nil {
+		return err
+	}
+
+	if f.Kind() == reflect.Ptr {
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+
+	switch {
+	case f.Kind() == reflect.String:
+		f.SetString(string(plain))
+	case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+		f.SetBytes(plain)
+	default:
+		return fmt.Errorf("%w: unsupported type %s", ErrCipher, f.Type())
+	}
+
+	return nil
+}
+
+// bindCipher sets the cipher of the gateway on encrypted column arguments
+func (g *Gateway) bindCipher(args []interface{}) []interface{} {
+
+	var out []interface{}
+	for i, a := range args {
+		cc, ok := a.(cipherColumn)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = append([]interface{}{}, args...)
+		}
+		cc.c = g.cipher
+		out[i] = cc
+	}
+
+	if out == nil {
+		return args
+	}
+
+	return out
+}
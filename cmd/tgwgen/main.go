@@ -0,0 +1,484 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command tgwgen generates repositories for tagged structs which work without
+// runtime reflection. Queries are built once at generation time from the same
+// db and tgw tags a table gateway reads, fields are bound and scanned
+// directly.
+//
+// Usage:
+//
+//	tgwgen -type User,Order=orders [-dialect mysql] [-output tgw_gen.go] [dir]
+//
+// Each type gets a repository like UserRepo with CreateUser, ReadUser,
+// UpdateUser and DeleteUser. The table is given after "=" or by a table= tag.
+// Primary keys, insert and update columns, json, created, updated, version and
+// softdelete tags are honored. Hooks are not run and omitempty is ignored.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/mrccnt/go-table-gateway"
+)
+
+// Tags read from struct fields, see the tgw package
+const (
+	tagDB  = "db"
+	tagTGW = "tgw"
+)
+
+// Errors...
+var (
+	ErrNoType    = errors.New("no struct type given")
+	ErrDialect   = errors.New("unknown dialect")
+	ErrTypeSpec  = errors.New("type not found or not a struct")
+	ErrNoTable   = errors.New("no table given or found")
+	ErrNoPrimary = errors.New("no primary key found")
+	ErrField     = errors.New("field not supported")
+)
+
+// dialects maps the names accepted by -dialect
+var dialects = map[string]tgw.Dialect{
+	"mysql":    tgw.MySQL,
+	"postgres": tgw.Postgres,
+	"sqlite":   tgw.SQLite,
+}
+
+// identRe matches plain sql identifiers
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// integers are the types a generated primary key can be converted to
+var integers = []string{"int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64"}
+
+// field is a struct field mapped to a column
+type field struct {
+	Name string
+	Col  string
+	Type string
+	Ptr  bool
+	JSON bool
+}
+
+// Var returns the variable holding the encoded value of a json field
+func (f field) Var() string {
+	return "j" + f.Name
+}
+
+// Arg returns the expression bound for the field
+func (f field) Arg() string {
+	if f.JSON {
+		return f.Var()
+	}
+	return "e." + f.Name
+}
+
+// entity is a struct a repository is generated for
+type entity struct {
+	Name      string
+	Table     string
+	Fields    []field
+	Keys      []field
+	Insert    []field
+	Update    []field
+	Auto      *field
+	Created   *field
+	Updated   *field
+	Version   *field
+	Soft      *field
+	Returning bool
+
+	CreateSQL string
+	ReadSQL   string
+	UpdateSQL string
+	DeleteSQL string
+}
+
+func main() {
+
+	types := flag.String("type", "", "comma separated struct names, optionally as Name=table")
+	dialect := flag.String("dialect", "mysql", "sql dialect: mysql, postgres or sqlite")
+	output := flag.String("output", "tgw_gen.go", "file written in the package directory")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	if err := run(dir, *types, *dialect, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "tgwgen:", err)
+		os.Exit(1)
+	}
+}
+
+// run generates the repositories of types found in dir
+func run(dir, types, dialect, output string) error {
+
+	d, ok := dialects[dialect]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDialect, dialect)
+	}
+
+	if strings.TrimSpace(types) == "" {
+		return ErrNoType
+	}
+
+	fset := token.NewFileSet()
+	pkg, specs, err := parseDir(fset, dir, output)
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoPreferNilSlice
+	ents := []*entity{}
+	for _, t := range strings.Split(types, ",") {
+		name, table := strings.TrimSpace(t), ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, table = name[:i], name[i+1:]
+		}
+		spec, ok := specs[name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrTypeSpec, name)
+		}
+		e, err := parseEntity(fset, name, table, spec, specs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		buildSQL(e, d)
+		ents = append(ents, e)
+	}
+
+	src, err := generate(pkg, ents)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, output), src, 0644)
+}
+
+// parseDir returns the package name and struct types of the go files in dir,
+// skipping tests and the output file
+func parseDir(fset *token.FileSet, dir, output string) (string, map[string]*ast.StructType, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	pkg := ""
+	specs := map[string]*ast.StructType{}
+
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") || filepath.Base(name) == output {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return "", nil, err
+		}
+		pkg = f.Name.Name
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range gd.Specs {
+				ts := s.(*ast.TypeSpec)
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					specs[ts.Name.Name] = st
+				}
+			}
+		}
+	}
+
+	if pkg == "" {
+		return "", nil, fmt.Errorf("no go files in %s", dir)
+	}
+
+	return pkg, specs, nil
+}
+
+// parseEntity reads the tags of struct st
+func parseEntity(fset *token.FileSet, name, table string, st *ast.StructType, specs map[string]*ast.StructType) (*entity, error) {
+
+	e := &entity{Name: name, Table: table}
+	stamps := map[string]string{}
+	auto := true
+
+	for _, f := range st.Fields.List {
+
+		tag := reflect.StructTag("")
+		if f.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
+		}
+		col := tag.Get(tagDB)
+		ops := strings.Split(tag.Get(tagTGW), ",")
+
+		for _, op := range ops {
+			if strings.HasPrefix(op, "table=") && e.Table == "" {
+				e.Table = strings.TrimPrefix(op, "table=")
+			}
+		}
+
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("%w: embedded %s", ErrField, typeString(fset, f.Type))
+		}
+		if col == "" || col == "-" {
+			continue
+		}
+		if len(f.Names) > 1 || !identRe.MatchString(col) {
+			return nil, fmt.Errorf("%w: %s", ErrField, col)
+		}
+
+		fd := field{Name: f.Names[0].Name, Col: col, Type: typeString(fset, f.Type), JSON: inArray("json", ops)}
+		_, fd.Ptr = f.Type.(*ast.StarExpr)
+
+		// Nested structs of the package are expanded by the gateway
+		if _, ok := specs[strings.TrimPrefix(fd.Type, "*")]; ok && !fd.JSON {
+			return nil, fmt.Errorf("%w: nested struct %s", ErrField, fd.Name)
+		}
+
+		for _, op := range []string{"tenant", "uuid", "ulid", "encrypted"} {
+			if inArray(op, ops) {
+				return nil, fmt.Errorf("%w: %s tag of %s", ErrField, op, fd.Name)
+			}
+		}
+		for _, op := range ops {
+			if strings.HasPrefix(op, "default=") || strings.HasPrefix(op, "enum=") {
+				return nil, fmt.Errorf("%w: %s tag of %s", ErrField, strings.SplitN(op, "=", 2)[0], fd.Name)
+			}
+		}
+
+		e.Fields = append(e.Fields, fd)
+
+		if inArray("primary", ops) {
+			e.Keys = append(e.Keys, fd)
+		}
+		if inArray("insert", ops) {
+			e.Insert = append(e.Insert, fd)
+		}
+		if inArray("update", ops) && !inArray("version", ops) {
+			e.Update = append(e.Update, fd)
+		}
+		if inArray("version", ops) && !inArray(fd.Type, integers) {
+			return nil, fmt.Errorf("%w: version %s must be an integer", ErrField, fd.Name)
+		}
+		for _, op := range []string{"created", "updated", "version", "softdelete"} {
+			if inArray(op, ops) {
+				stamps[op] = col
+			}
+		}
+		auto = auto && !inArray("noauto", ops)
+	}
+
+	for i := range e.Fields {
+		switch e.Fields[i].Col {
+		case stamps["created"]:
+			e.Created = &e.Fields[i]
+		case stamps["updated"]:
+			e.Updated = &e.Fields[i]
+		case stamps["version"]:
+			e.Version = &e.Fields[i]
+		case stamps["softdelete"]:
+			e.Soft = &e.Fields[i]
+		}
+	}
+
+	for _, p := range []*field{e.Created, e.Updated, e.Soft} {
+		if p != nil && strings.TrimPrefix(p.Type, "*") != "time.Time" {
+			return nil, fmt.Errorf("%w: %s must be a time.Time", ErrField, p.Name)
+		}
+	}
+
+	if e.Table == "" || !validTable(e.Table) {
+		return nil, ErrNoTable
+	}
+	if len(e.Keys) == 0 {
+		return nil, ErrNoPrimary
+	}
+	if len(e.Insert) == 0 {
+		return nil, fmt.Errorf("%w: no insert columns", ErrField)
+	}
+
+	// A single key left out of the insert is generated by the database
+	if len(e.Keys) == 1 && !hasCol(e.Insert, e.Keys[0].Col) && auto {
+		if !inArray(e.Keys[0].Type, integers) {
+			return nil, fmt.Errorf("%w: generated key %s must be an integer, or tag it noauto", ErrField, e.Keys[0].Name)
+		}
+		e.Auto = &e.Keys[0]
+	}
+
+	return e, nil
+}
+
+// buildSQL bakes the queries of e for dialect d
+func buildSQL(e *entity, d tgw.Dialect) {
+
+	n := 0
+	ph := func() string {
+		n++
+		return d.Placeholder(n)
+	}
+	eq := func(fs []field) []string {
+		//noinspection GoPreferNilSlice
+		s := []string{}
+		for _, f := range fs {
+			s = append(s, d.Quote(f.Col)+" = "+ph())
+		}
+		return s
+	}
+	table := quoteTable(d, e.Table)
+
+	//noinspection GoPreferNilSlice
+	cols, vals := []string{}, []string{}
+	for _, f := range e.Insert {
+		cols = append(cols, d.Quote(f.Col))
+		vals = append(vals, ph())
+	}
+	e.CreateSQL = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ","), strings.Join(vals, ","))
+	if e.Auto != nil && d.Returning() {
+		e.Returning = true
+		e.CreateSQL += " RETURNING " + d.Quote(e.Auto.Col)
+	}
+
+	notDeleted := ""
+	if e.Soft != nil {
+		notDeleted = " AND " + d.Quote(e.Soft.Col) + " IS NULL"
+	}
+
+	//noinspection GoPreferNilSlice
+	all := []string{}
+	for _, f := range e.Fields {
+		all = append(all, d.Quote(f.Col))
+	}
+	n = 0
+	e.ReadSQL = fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(all, ","), table, strings.Join(eq(e.Keys), " AND ")) + notDeleted
+
+	n = 0
+	set := eq(e.Update)
+	if e.Version != nil {
+		v := d.Quote(e.Version.Col)
+		set = append(set, v+" = "+v+" + 1")
+	}
+	where := eq(e.Keys)
+	if e.Version != nil {
+		where = append(where, eq([]field{*e.Version})...)
+	}
+	if len(set) > 0 {
+		e.UpdateSQL = fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(set, ","), strings.Join(where, " AND ")) + notDeleted
+	}
+
+	n = 0
+	if e.Soft != nil {
+		set := eq([]field{*e.Soft})
+		e.DeleteSQL = fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, set[0], strings.Join(eq(e.Keys), " AND ")) + notDeleted
+	} else {
+		e.DeleteSQL = fmt.Sprintf("DELETE FROM %s WHERE %s", table, strings.Join(eq(e.Keys), " AND "))
+	}
+}
+
+// generate renders and formats the source of the repositories
+func generate(pkg string, ents []*entity) ([]byte, error) {
+
+	data := struct {
+		Package  string
+		Entities []*entity
+		JSON     bool
+		Time     bool
+		TimePtr  bool
+	}{Package: pkg, Entities: ents}
+
+	for _, e := range ents {
+		for _, f := range e.Fields {
+			data.JSON = data.JSON || f.JSON
+		}
+		for _, p := range []*field{e.Created, e.Updated, e.Soft} {
+			if p != nil {
+				data.Time = true
+				data.TimePtr = data.TimePtr || p.Ptr
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := repoTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return format.Source(buf.Bytes())
+}
+
+// typeString prints a type expression
+func typeString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// quoteTable quotes a "table" or "schema.table" name
+func quoteTable(d tgw.Dialect, table string) string {
+	parts := strings.Split(table, ".")
+	for i, p := range parts {
+		parts[i] = d.Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// validTable checks a "table" or "schema.table" name
+func validTable(table string) bool {
+	parts := strings.Split(table, ".")
+	if len(parts) > 2 {
+		return false
+	}
+	for _, p := range parts {
+		if !identRe.MatchString(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasCol checks if fs holds a field of column col
+func hasCol(fs []field, col string) bool {
+	for _, f := range fs {
+		if f.Col == col {
+			return true
+		}
+	}
+	return false
+}
+
+// inArray checks if needle is one of haystack
+func inArray(needle string, haystack []string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
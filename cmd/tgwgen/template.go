@@ -0,0 +1,251 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"text/template"
+)
+
+// funcs are the helpers available to repoTemplate
+var funcs = template.FuncMap{
+	"lower": func(s string) string { return strings.ToLower(s[:1]) + s[1:] },
+	"args": func(fs []field) string {
+		//noinspection GoPreferNilSlice
+		s := []string{}
+		for _, f := range fs {
+			s = append(s, f.Arg())
+		}
+		return strings.Join(s, ", ")
+	},
+	"params": func(fs []field) string {
+		//noinspection GoPreferNilSlice
+		s := []string{}
+		for _, f := range fs {
+			s = append(s, "k"+f.Name+" "+f.Type)
+		}
+		return strings.Join(s, ", ")
+	},
+	"keys": func(fs []field) string {
+		//noinspection GoPreferNilSlice
+		s := []string{}
+		for _, f := range fs {
+			s = append(s, "k"+f.Name)
+		}
+		return strings.Join(s, ", ")
+	},
+	"dests": func(fs []field) string {
+		//noinspection GoPreferNilSlice
+		s := []string{}
+		for _, f := range fs {
+			s = append(s, "&"+f.Arg())
+		}
+		return strings.Join(s, ", ")
+	},
+	"json": func(fs []field) []field {
+		//noinspection GoPreferNilSlice
+		s := []field{}
+		for _, f := range fs {
+			if f.JSON {
+				s = append(s, f)
+			}
+		}
+		return s
+	},
+}
+
+// repoTemplate renders the repositories of a package
+var repoTemplate = template.Must(template.New("repo").Funcs(funcs).Parse(`// Code generated by tgwgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"database/sql"
+{{- if .JSON}}
+	"encoding/json"
+{{- end}}
+	"errors"
+{{- if .Time}}
+	"time"
+{{- end}}
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mrccnt/go-table-gateway"
+)
+
+{{- if .TimePtr}}
+
+// tgwgenTime returns a pointer to a copy of t
+func tgwgenTime(t time.Time) *time.Time {
+	return &t
+}
+{{- end}}
+{{range .Entities}}
+
+// {{.Name}}Repo reads and writes {{.Name}} entities of table {{.Table}}
+type {{.Name}}Repo struct {
+	db sqlx.ExtContext
+}
+
+// New{{.Name}}Repo returns a {{.Name}}Repo running on a database or transaction
+func New{{.Name}}Repo(db sqlx.ExtContext) *{{.Name}}Repo {
+	return &{{.Name}}Repo{db: db}
+}
+
+const (
+	{{lower .Name}}CreateSQL = {{printf "%q" .CreateSQL}}
+	{{lower .Name}}ReadSQL   = {{printf "%q" .ReadSQL}}
+{{- if .UpdateSQL}}
+	{{lower .Name}}UpdateSQL = {{printf "%q" .UpdateSQL}}
+{{- end}}
+	{{lower .Name}}DeleteSQL = {{printf "%q" .DeleteSQL}}
+)
+
+// Create{{.Name}} inserts e{{if .Auto}} and sets its generated primary key{{end}}
+func (r *{{.Name}}Repo) Create{{.Name}}(ctx context.Context, e *{{.Name}}) error {
+{{- if or .Created .Updated}}
+
+	now := time.Now()
+{{- if .Created}}
+	e.{{.Created.Name}} = {{template "stamp" .Created}}
+{{- end}}
+{{- if .Updated}}
+	e.{{.Updated.Name}} = {{template "stamp" .Updated}}
+{{- end}}
+{{- end}}
+{{template "marshal" .Insert}}
+{{- if .Returning}}
+
+	return r.db.QueryRowxContext(ctx, {{lower .Name}}CreateSQL, {{args .Insert}}).Scan(&e.{{.Auto.Name}})
+}
+{{- else if .Auto}}
+
+	res, err := r.db.ExecContext(ctx, {{lower .Name}}CreateSQL, {{args .Insert}})
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.{{.Auto.Name}} = {{.Auto.Type}}(id)
+
+	return nil
+}
+{{- else}}
+
+	if _, err := r.db.ExecContext(ctx, {{lower .Name}}CreateSQL, {{args .Insert}}); err != nil {
+		return err
+	}
+
+	return nil
+}
+{{- end}}
+
+// Read{{.Name}} returns the {{.Name}} with given primary key or an error
+// matching tgw.ErrNotFound if there is none
+func (r *{{.Name}}Repo) Read{{.Name}}(ctx context.Context, {{params .Keys}}) (*{{.Name}}, error) {
+
+	e := &{{.Name}}{}
+{{- range json .Fields}}
+	var {{.Var}} []byte
+{{- end}}
+
+	err := r.db.QueryRowxContext(ctx, {{lower .Name}}ReadSQL, {{keys .Keys}}).Scan({{dests .Fields}})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tgw.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+{{- range json .Fields}}
+
+	if len({{.Var}}) > 0 {
+		if err := json.Unmarshal({{.Var}}, &e.{{.Name}}); err != nil {
+			return nil, err
+		}
+	}
+{{- end}}
+
+	return e, nil
+}
+{{- if .UpdateSQL}}
+
+// Update{{.Name}} writes the update columns of e
+{{- if .Version}}. It returns an error
+// matching tgw.ErrStaleObject if the row was changed concurrently.{{end}}
+func (r *{{.Name}}Repo) Update{{.Name}}(ctx context.Context, e *{{.Name}}) error {
+{{- if .Updated}}
+
+	e.{{.Updated.Name}} = {{if .Updated.Ptr}}tgwgenTime(time.Now()){{else}}time.Now(){{end}}
+{{- end}}
+{{template "marshal" .Update}}
+
+{{- if .Version}}
+
+	res, err := r.db.ExecContext(ctx, {{lower .Name}}UpdateSQL, {{args .Update}}{{if .Update}}, {{end}}{{args .Keys}}, e.{{.Version.Name}})
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return tgw.ErrStaleObject
+	}
+	e.{{.Version.Name}}++
+{{- else}}
+
+	if _, err := r.db.ExecContext(ctx, {{lower .Name}}UpdateSQL, {{args .Update}}, {{args .Keys}}); err != nil {
+		return err
+	}
+{{- end}}
+
+	return nil
+}
+{{- end}}
+
+// Delete{{.Name}} {{if .Soft}}marks e as deleted{{else}}removes e{{end}}
+func (r *{{.Name}}Repo) Delete{{.Name}}(ctx context.Context, e *{{.Name}}) error {
+{{- if .Soft}}
+
+	now := time.Now()
+	if _, err := r.db.ExecContext(ctx, {{lower .Name}}DeleteSQL, now, {{args .Keys}}); err != nil {
+		return err
+	}
+	e.{{.Soft.Name}} = {{template "stamp" .Soft}}
+
+	return nil
+{{- else}}
+
+	if _, err := r.db.ExecContext(ctx, {{lower .Name}}DeleteSQL, {{args .Keys}}); err != nil {
+		return err
+	}
+
+	return nil
+{{- end}}
+}
+{{end}}
+{{- define "stamp"}}{{if .Ptr}}tgwgenTime(now){{else}}now{{end}}{{end}}
+{{- define "marshal"}}{{range json .}}
+	{{.Var}}, err := json.Marshal(e.{{.Name}})
+	if err != nil {
+		return err
+	}
+{{- end}}{{end}}`))
@@ -0,0 +1,129 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"reflect"
+)
+
+// SelectColumns is like Select but only reads given columns, which have to be
+// db tagged fields of the entity
+func (g *Gateway) SelectColumns(dest interface{}, cols []string, params Condition, orderby Orderer) error {
+	return g.SelectColumnsContext(context.Background(), dest, cols, params, orderby)
+}
+
+// SelectColumnsContext is like SelectColumns but runs with given context
+func (g *Gateway) SelectColumnsContext(ctx context.Context, dest interface{}, cols []string, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	if err := checkColumns(dest, cols); err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return err
+	}
+
+	q, args := buildSelect(table, cols, params, orderby, g.softDeleteCol(dest))
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return g.selectRows(ctx, opSelect, table, dest, q, args...)
+}
+
+// ReadColumns is like Read but only reads given columns, which have to be db
+// tagged fields of the entity
+func (g *Gateway) ReadColumns(dest interface{}, cols ...string) error {
+	return g.ReadColumnsContext(context.Background(), dest, cols...)
+}
+
+// ReadColumnsContext is like ReadColumns but runs with given context
+func (g *Gateway) ReadColumnsContext(ctx context.Context, dest interface{}, cols ...string) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := checkColumns(dest, cols); err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	q, args := buildRead(table, dest, g.readMeta(destcfg), cols)
+
+	q, args, err = g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return notFound(g.get(ctx, opRead, table, dest, q, args...))
+}
+
+// checkColumns verifies that all cols are db tagged fields of the entity
+// type dest refers to
+func checkColumns(dest interface{}, cols []string) error {
+
+	m, err := structMeta(baseType(reflect.TypeOf(dest)))
+	if err != nil {
+		return err
+	}
+
+	for _, col := range cols {
+		if _, ok := m.Fields[col]; !ok {
+			return ErrUnknownCol
+		}
+	}
+
+	return nil
+}
+
+// ColumnPtr returns a pointer to the field of column col of the struct dest
+// points to or ErrUnknownCol if it has no such column
+func ColumnPtr(dest interface{}, col string) (interface{}, error) {
+
+	m, err := structMeta(baseType(reflect.TypeOf(dest)))
+	if err != nil {
+		return nil, err
+	}
+
+	idx, ok := m.Fields[col]
+	if !ok {
+		return nil, ErrUnknownCol
+	}
+
+	return reflect.ValueOf(dest).Elem().FieldByIndex(idx).Addr().Interface(), nil
+}
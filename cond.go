@@ -0,0 +1,354 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// NullCheck is a selector value matching columns being NULL or not
+type NullCheck bool
+
+// Null checks usable as selector values. NotNull is an alias of IsNotNull.
+const (
+	IsNull    NullCheck = true
+	IsNotNull NullCheck = false
+	NotNull   NullCheck = false
+)
+
+// nullCheck returns the null check selector value v stands for with operator
+// op. NULL values like nil, nil pointers or invalid sql.NullString compared
+// with "=" or "!=" check for NULL, as comparing with NULL matches no row.
+func nullCheck(op string, v interface{}) (NullCheck, bool) {
+
+	if n, ok := v.(NullCheck); ok {
+		return n, true
+	}
+
+	if (op == "=" || op == "!=" || op == "<>") && isNull(v) {
+		return NullCheck(op == "="), true
+	}
+
+	return false, false
+}
+
+// isNull checks if v is written as NULL
+func isNull(v interface{}) bool {
+
+	if v == nil {
+		return true
+	}
+
+	if r := reflect.ValueOf(v); r.Kind() == reflect.Ptr && r.IsNil() {
+		return true
+	}
+
+	if dv, ok := v.(driver.Valuer); ok {
+		x, err := dv.Value()
+		return err == nil && x == nil
+	}
+
+	return false
+}
+
+// Condition filters the rows of a query. It is implemented by Selectors,
+// which require all of their terms to match, and by And and Or, which allow
+// combining and nesting conditions.
+type Condition interface {
+	condition(col func(string) string) (string, []interface{})
+}
+
+// and requires all of its conditions to match
+type and []Condition
+
+// or requires any of its conditions to match
+type or []Condition
+
+// And returns a condition matching rows matched by all of conds
+func And(conds ...Condition) Condition {
+	return and(conds)
+}
+
+// Or returns a condition matching rows matched by any of conds
+func Or(conds ...Condition) Condition {
+	return or(conds)
+}
+
+// condition implements Condition
+func (a and) condition(col func(string) string) (string, []interface{}) {
+
+	//noinspection GoPreferNilSlice
+	terms := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, c := range a {
+		if c == nil {
+			continue
+		}
+		t, v := c.condition(col)
+		if t == "" {
+			continue
+		}
+		terms = append(terms, t)
+		args = append(args, v...)
+	}
+
+	return strings.Join(terms, " AND "), args
+}
+
+// condition implements Condition. Operands are wrapped in parentheses so the
+// result can be combined with further terms safely.
+func (o or) condition(col func(string) string) (string, []interface{}) {
+
+	//noinspection GoPreferNilSlice
+	terms := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, c := range o {
+		if c == nil {
+			//noinspection GoPreferNilSlice
+			return "", []interface{}{}
+		}
+		t, v := c.condition(col)
+		// An empty operand matches every row and so does the whole group
+		if t == "" {
+			//noinspection GoPreferNilSlice
+			return "", []interface{}{}
+		}
+		terms = append(terms, "("+t+")")
+		args = append(args, v...)
+	}
+
+	if len(terms) == 0 {
+		return "1 = 0", args
+	}
+
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+// condition implements Condition
+func (s Selectors) condition(col func(string) string) (string, []interface{}) {
+	terms, args := s.terms(col)
+	return strings.Join(terms, " AND "), args
+}
+
+// Expr is a sql expression used verbatim as selector or update value, like
+// Expr("price * 1.1"). It must never hold user input.
+type Expr string
+
+// RawSQL is a sql fragment with ? placeholders and their arguments. It can be
+// used as condition, selector value or update value.
+type RawSQL struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Raw returns a RawSQL fragment like Raw("LOWER(name) = ?", name)
+func Raw(sql string, args ...interface{}) RawSQL {
+	return RawSQL{SQL: sql, Args: args}
+}
+
+// condition implements Condition
+func (r RawSQL) condition(col func(string) string) (string, []interface{}) {
+	if r.SQL == "" {
+		//noinspection GoPreferNilSlice
+		return "", []interface{}{}
+	}
+	return "(" + r.SQL + ")", r.Args
+}
+
+// valueSQL renders a selector or update value, inlining Expr and RawSQL
+// values and using a placeholder for all others
+func valueSQL(v interface{}) (string, []interface{}) {
+	switch e := v.(type) {
+	case Expr:
+		//noinspection GoPreferNilSlice
+		return string(e), []interface{}{}
+	case RawSQL:
+		return "(" + e.SQL + ")", e.Args
+	}
+	return "?", []interface{}{v}
+}
+
+// selectorOps are the operators allowed after the column of a selector key
+var selectorOps = []string{"=", "!=", "<>", "<", "<=", ">", ">=", "LIKE", "NOT LIKE", "IN", "NOT IN"}
+
+// terms builds the conditions of all selectors and their arguments, col
+// renders column names
+func (s Selectors) terms(col func(string) string) ([]string, []interface{}) {
+
+	//noinspection GoPreferNilSlice
+	keys := []string{}
+	for k := range s {
+		keys = append(keys, k)
+	}
+
+	// Stable order keeps queries cacheable as prepared statements
+	sort.Strings(keys)
+
+	//noinspection GoPreferNilSlice
+	terms := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, k := range keys {
+		t, a := selectorTerm(k, s[k], col)
+		terms = append(terms, t)
+		args = append(args, a...)
+	}
+
+	return terms, args
+}
+
+// selectorTerm builds the condition of a single selector
+func selectorTerm(k string, v interface{}, col func(string) string) (string, []interface{}) {
+
+	name, op := splitSelector(k)
+
+	if n, ok := nullCheck(op, v); ok {
+		if n {
+			return col(name) + " IS NULL", nil
+		}
+		return col(name) + " IS NOT NULL", nil
+	}
+
+	switch v.(type) {
+	case Expr, RawSQL:
+		val, args := valueSQL(v)
+		return fmt.Sprintf("%s %s %s", col(name), op, val), args
+	}
+
+	if op == "IN" || op == "NOT IN" {
+		q, args, err := sqlx.In(col(name)+" "+op+" (?)", v)
+		if err != nil {
+			// Empty lists match no row or every row
+			if op == "IN" {
+				return "1 = 0", nil
+			}
+			return "1 = 1", nil
+		}
+		return q, args
+	}
+
+	return fmt.Sprintf("%s %s ?", col(name), op), []interface{}{v}
+}
+
+// splitSelector splits a selector key into its column and operator. Keys
+// without a known operator compare the whole key for equality.
+func splitSelector(k string) (string, string) {
+
+	k = strings.TrimSpace(k)
+
+	i := strings.IndexByte(k, ' ')
+	if i < 0 {
+		return k, "="
+	}
+
+	op := strings.ToUpper(strings.Join(strings.Fields(k[i+1:]), " "))
+	if !inArray(op, selectorOps) {
+		return k, "="
+	}
+
+	return k[:i], op
+}
+
+// checkCondition validates the selector keys of params, which may come from
+// untrusted input. Columns have to be plain identifiers, unqualified columns
+// also db tags of dest if it is a struct or a slice of them. Raw sql is not
+// checked.
+func checkCondition(params Condition, dest interface{}) error {
+	return checkKeys(params, destMeta(dest))
+}
+
+// checkKeys validates the selector keys of c against m, which may be nil
+func checkKeys(c Condition, m *tabMeta) error {
+
+	switch c := c.(type) {
+	case Selectors:
+		for k := range c {
+			name, _ := splitSelector(k)
+			if err := knownColumn(name, m); err != nil {
+				return err
+			}
+		}
+	case and:
+		for _, sub := range c {
+			if err := checkKeys(sub, m); err != nil {
+				return err
+			}
+		}
+	case or:
+		for _, sub := range c {
+			if err := checkKeys(sub, m); err != nil {
+				return err
+			}
+		}
+	case grouped:
+		return checkKeys(c.c, m)
+	}
+
+	return nil
+}
+
+// knownColumn checks if col is a plain or qualified identifier and, if
+// unqualified, a column of m. It returns ErrIdentifier or ErrUnknownCol.
+func knownColumn(col string, m *tabMeta) error {
+
+	parts := strings.Split(col, ".")
+	if len(parts) > 3 || !validIdent(parts...) {
+		return ErrIdentifier
+	}
+
+	if m == nil || len(parts) > 1 {
+		return nil
+	}
+
+	if _, ok := m.Fields[col]; !ok {
+		return ErrUnknownCol
+	}
+
+	return nil
+}
+
+// destMeta returns the struct meta of dest if it is a struct or a slice of
+// them, nil otherwise
+func destMeta(dest interface{}) *tabMeta {
+
+	if dest == nil {
+		return nil
+	}
+
+	t := baseType(reflect.TypeOf(dest))
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	m, err := structMeta(t)
+	if err != nil {
+		return nil
+	}
+
+	return m
+}
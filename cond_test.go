@@ -0,0 +1,115 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// condEntity is an entity conditions are checked against
+type condEntity struct {
+	ID   uint64 `db:"id" tgw:"primary"`
+	Name string `db:"name" tgw:"insert,update"`
+	Age  int    `db:"age" tgw:"insert,update"`
+}
+
+// TestWhereClause checks the sql and arguments rendered for conditions
+func TestWhereClause(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		cond  Condition
+		where string
+		args  []interface{}
+	}{
+		{"nil", nil, "", nil},
+		{"empty", Selectors{}, "", nil},
+		{"equal", Selectors{"name": "a"}, " WHERE `name` = ?", []interface{}{"a"}},
+		{"sorted keys", Selectors{"name": "a", "age >=": 3}, " WHERE `age` >= ? AND `name` = ?", []interface{}{3, "a"}},
+		{"lower case operator", Selectors{"name not like": "a%"}, " WHERE `name` NOT LIKE ?", []interface{}{"a%"}},
+		{"unknown operator", Selectors{"name ~": "a"}, " WHERE `name ~` = ?", []interface{}{"a"}},
+		{"qualified column", Selectors{"users.name": "a"}, " WHERE `users`.`name` = ?", []interface{}{"a"}},
+		{"nil is null", Selectors{"name": nil}, " WHERE `name` IS NULL", nil},
+		{"nil pointer is null", Selectors{"name": (*string)(nil)}, " WHERE `name` IS NULL", nil},
+		{"not nil", Selectors{"name !=": nil}, " WHERE `name` IS NOT NULL", nil},
+		{"null check", Selectors{"name": IsNotNull}, " WHERE `name` IS NOT NULL", nil},
+		{"in", Selectors{"id IN": []int{1, 2}}, " WHERE `id` IN (?, ?)", []interface{}{1, 2}},
+		{"empty in", Selectors{"id IN": []int{}}, " WHERE 1 = 0", nil},
+		{"empty not in", Selectors{"id NOT IN": []int{}}, " WHERE 1 = 1", nil},
+		{"expr", Selectors{"age >": Expr("id * 2")}, " WHERE `age` > id * 2", nil},
+		{"raw value", Selectors{"age >": Raw("? + 1", 2)}, " WHERE `age` > (? + 1)", []interface{}{2}},
+		{"raw", Raw("LOWER(name) = ?", "a"), " WHERE (LOWER(name) = ?)", []interface{}{"a"}},
+		{"empty raw", Raw(""), "", nil},
+		{"or", Or(Selectors{"name": "a"}, Selectors{"age": 3}), " WHERE ((`name` = ?) OR (`age` = ?))", []interface{}{"a", 3}},
+		{"empty or", Or(), " WHERE 1 = 0", nil},
+		{"or with empty operand", Or(Selectors{"name": "a"}, Selectors{}), "", nil},
+		{"or with nil operand", Or(Selectors{"name": "a"}, nil), "", nil},
+		{"and", And(Selectors{"name": "a"}, Selectors{"age": 3}), " WHERE `name` = ? AND `age` = ?", []interface{}{"a", 3}},
+		{"and skips empty", And(nil, Selectors{}, Selectors{"age": 3}), " WHERE `age` = ?", []interface{}{3}},
+		{
+			"nested",
+			And(Selectors{"age >": 18}, Or(Selectors{"name": "a"}, And(Selectors{"name": "b"}, Selectors{"age <": 30}))),
+			" WHERE `age` > ? AND ((`name` = ?) OR (`name` = ? AND `age` < ?))",
+			[]interface{}{18, "a", "b", 30},
+		},
+		{
+			"restricted raw",
+			restrict(Raw("name = ? OR 1 = 1", "a"), Selectors{"tenant": 7}),
+			" WHERE ((name = ? OR 1 = 1)) AND `tenant` = ?",
+			[]interface{}{"a", 7},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			where, args := whereClause(tc.cond)
+			if where != tc.where {
+				t.Errorf("where = %q, want %q", where, tc.where)
+			}
+			if len(args) != len(tc.args) || fmt.Sprint(args) != fmt.Sprint(tc.args) {
+				t.Errorf("args = %v, want %v", args, tc.args)
+			}
+		})
+	}
+}
+
+// TestCheckCondition checks the validation of selector keys against the
+// columns of an entity
+func TestCheckCondition(t *testing.T) {
+
+	tests := []struct {
+		name string
+		cond Condition
+		err  error
+	}{
+		{"known", Selectors{"name": "a", "age >": 3}, nil},
+		{"qualified", Selectors{"users.other": "a"}, nil},
+		{"unknown", Selectors{"other": "a"}, ErrUnknownCol},
+		{"injection", Selectors{"name; DROP TABLE users": "a"}, ErrIdentifier},
+		{"unknown in or", Or(Selectors{"name": "a"}, Selectors{"other": 1}), ErrUnknownCol},
+		{"unknown in and", And(Selectors{"name": "a"}, Or(Selectors{"other": 1})), ErrUnknownCol},
+		{"raw is not checked", Raw("other = 1"), nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := checkCondition(tc.cond, &[]condEntity{}); !errors.Is(err, tc.err) {
+				t.Errorf("err = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Increment atomically adds delta, which may be negative, to given column of
+// entity in database without reading it first. Like Patch it bumps the version
+// column and sets the updated timestamp, which is also set on dest. The field
+// of column is left unchanged, read the entity to see the new value.
+func (g *Gateway) Increment(dest interface{}, column string, delta int64) error {
+	return g.IncrementContext(context.Background(), dest, column, delta)
+}
+
+// IncrementContext is like Increment but runs with given context
+func (g *Gateway) IncrementContext(ctx context.Context, dest interface{}, column string, delta int64) error {
+
+	if g.audit != "" {
+		return g.audited(ctx, AuditUpdate, dest, func(ag *Gateway) error {
+			return ag.IncrementContext(ctx, dest, column, delta)
+		})
+	}
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := counterCol(destcfg, column); err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	destcfg = g.stamp(dest, destcfg, false)
+
+	assigns := []string{fmt.Sprintf("`%s` = `%s` + ?", column, column)}
+	args := []interface{}{delta}
+
+	if c := destcfg.Updated; c != "" && inArray(c, destcfg.UpdateCols) {
+		if inArray(c, destcfg.NowCols) {
+			assigns = append(assigns, fmt.Sprintf("`%s` = %s", c, serverNow))
+		} else {
+			assigns = append(assigns, fmt.Sprintf("`%s` = ?", c))
+			args = append(args, reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[c]).Interface())
+		}
+	}
+
+	if c := destcfg.Version; c != "" {
+		assigns = append(assigns, fmt.Sprintf("`%s` = `%s` + 1", c, c))
+	}
+
+	q := fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s",
+		quoteTable(table),
+		strings.Join(assigns, ","),
+		strings.Join(quoteSelectSet(destcfg.PrimaryDBs), " AND "),
+	)
+
+	q, args, err = g.scoped(q, append(args, getPriVals(dest, destcfg)...), destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opUpdate, table, q, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	g.changed(opUpdate, dest)
+
+	return nil
+}
+
+// counterCol checks if column is a plain column of the entity, which excludes
+// primary, version, soft delete, timestamp, encrypted and json columns
+func counterCol(destcfg *tabMeta, column string) error {
+	if _, ok := destcfg.Fields[column]; !ok || inArray(column, destcfg.PrimaryDBs) || !validIdent(column) {
+		return ErrUnknownCol
+	}
+	special := []string{destcfg.Version, destcfg.SoftDelete, destcfg.Created, destcfg.Updated}
+	if inArray(column, special) || inArray(column, destcfg.Encrypted) || inArray(column, destcfg.JSONCols) {
+		return ErrUnknownCol
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CreateTable creates the table of entity dest if it does not exist yet,
+// see CreateTableSQL
+func (g *Gateway) CreateTable(dest interface{}) error {
+	return g.CreateTableContext(context.Background(), dest)
+}
+
+// CreateTableContext is like CreateTable but runs with given context
+func (g *Gateway) CreateTableContext(ctx context.Context, dest interface{}) error {
+
+	q, err := g.createTable(dest)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	_, err = g.exec(ctx, opSchema, table, q)
+
+	return err
+}
+
+// CreateTableSQL returns the CREATE TABLE statement of entity dest in the
+// gateways dialect. Column types are inferred from the field types, a tag
+// like tgw:"type=VARCHAR(64)" sets them explicitly and tgw:"notnull" adds
+// NOT NULL. A single integer primary key is generated by the database unless
+// tagged noauto.
+func (g *Gateway) CreateTableSQL(dest interface{}) (string, error) {
+
+	q, err := g.createTable(dest)
+	if err != nil {
+		return "", err
+	}
+
+	return translate(g.dialect, q), nil
+}
+
+// createTable builds the CREATE TABLE statement of dest with backtick quoted
+// identifiers
+func (g *Gateway) createTable(dest interface{}) (string, error) {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return "", err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return "", err
+	}
+
+	auto := len(destcfg.PrimaryDBs) == 1 && !destcfg.NoAuto && destcfg.Generate == ""
+
+	//noinspection GoPreferNilSlice
+	defs := []string{}
+
+	for _, f := range structFields(baseType(reflect.TypeOf(dest))) {
+
+		if f.col == "" || f.col == "-" {
+			continue
+		}
+		if idx, ok := destcfg.Fields[f.col]; !ok || !equalIndex(idx, f.Index) {
+			continue
+		}
+
+		primary := inArray(f.col, destcfg.PrimaryDBs)
+
+		typ, err := g.columnType(f, destcfg, primary && auto)
+		if err != nil {
+			return "", err
+		}
+
+		def := fmt.Sprintf("`%s` %s", f.col, typ)
+		if primary && auto && g.dialect.Name() == "sqlite" {
+			// SQLite only generates keys of INTEGER PRIMARY KEY columns
+			def = def + " PRIMARY KEY AUTOINCREMENT"
+		} else if primary || inArray(tgwNotNull, f.ops) {
+			def = def + " NOT NULL"
+		}
+		if primary && auto && g.dialect.Name() == "mysql" {
+			def = def + " AUTO_INCREMENT"
+		}
+
+		defs = append(defs, def)
+	}
+
+	if !(auto && g.dialect.Name() == "sqlite") {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(quoteIdents(destcfg.PrimaryDBs), ",")))
+	}
+
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteTable(table), strings.Join(defs, ",")), nil
+}
+
+// columnType returns the sql type of field f from its type tag or its Go type
+func (g *Gateway) columnType(f colField, destcfg *tabMeta, auto bool) (string, error) {
+
+	if t := tagValue(f.ops, tgwType); t != "" {
+		return t, nil
+	}
+
+	d := g.dialect.Name()
+
+	if inArray(f.col, destcfg.JSONCols) {
+		return dialectType(d, "JSON", "JSONB", "TEXT"), nil
+	}
+
+	// Ciphertexts outgrow the plain value
+	if inArray(f.col, destcfg.Encrypted) {
+		return "TEXT", nil
+	}
+
+	t := f.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(sql.NullTime{}):
+		return dialectType(d, "DATETIME(6)", "TIMESTAMP", "DATETIME"), nil
+	case reflect.TypeOf(sql.NullString{}):
+		t = reflect.TypeOf("")
+	case reflect.TypeOf(sql.NullInt64{}):
+		t = reflect.TypeOf(int64(0))
+	case reflect.TypeOf(sql.NullInt32{}):
+		t = reflect.TypeOf(int32(0))
+	case reflect.TypeOf(sql.NullFloat64{}):
+		t = reflect.TypeOf(float64(0))
+	case reflect.TypeOf(sql.NullBool{}):
+		t = reflect.TypeOf(false)
+	}
+
+	switch k := t.Kind(); {
+	case auto && isInteger(k):
+		return dialectType(d, "BIGINT", "BIGSERIAL", "INTEGER"), nil
+	case k == reflect.Int64 || k == reflect.Uint64 || k == reflect.Int || k == reflect.Uint || k == reflect.Uint32:
+		return dialectType(d, "BIGINT", "BIGINT", "INTEGER"), nil
+	case isInteger(k):
+		return "INTEGER", nil
+	case k == reflect.Float32 || k == reflect.Float64:
+		return dialectType(d, "DOUBLE", "DOUBLE PRECISION", "REAL"), nil
+	case k == reflect.Bool:
+		return "BOOLEAN", nil
+	case k == reflect.String:
+		return dialectType(d, "VARCHAR(255)", "TEXT", "TEXT"), nil
+	case k == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return dialectType(d, "BLOB", "BYTEA", "BLOB"), nil
+	}
+
+	return "", ErrColumnType
+}
+
+// dialectType picks the type for the dialect named d. Unknown dialects use
+// the PostgreSQL type.
+func dialectType(d, mysql, postgres, sqlite string) string {
+	switch d {
+	case "mysql":
+		return mysql
+	case "sqlite":
+		return sqlite
+	}
+	return postgres
+}
+
+// tagValue returns the value of the tgw option starting with prefix. Values
+// like DECIMAL(10,2) were split at the comma and are joined again.
+func tagValue(ops []string, prefix string) string {
+	for i, op := range ops {
+		if !strings.HasPrefix(op, prefix) {
+			continue
+		}
+		v := strings.TrimPrefix(op, prefix)
+		for j := i + 1; j < len(ops) && strings.Count(v, "(") > strings.Count(v, ")"); j++ {
+			v = v + "," + ops[j]
+		}
+		return v
+	}
+	return ""
+}
+
+// equalIndex checks if two field indexes are the same
+func equalIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// defaultNow is the default value setting time fields to the current time
+const defaultNow = "now"
+
+// setDefaults fills the zero fields of entity dest tagged with a default value
+// like tgw:"insert,default=pending" before it is created. Time fields accept
+// default=now. Defaults can not contain commas.
+func setDefaults(dest interface{}, destcfg *tabMeta) error {
+
+	if len(destcfg.Defaults) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	r := reflect.ValueOf(dest).Elem()
+
+	for col, def := range destcfg.Defaults {
+		f := r.FieldByIndex(destcfg.Fields[col])
+		if !f.IsZero() {
+			continue
+		}
+		v, err := defaultValue(f.Type(), def, now)
+		if err != nil {
+			return err
+		}
+		f.Set(v)
+	}
+
+	return nil
+}
+
+// defaultValue converts default def to a value of type t. Times only accept
+// "now", types implementing sql.Scanner scan def, pointers are set to a
+// default of their element type.
+func defaultValue(t reflect.Type, def string, now time.Time) (reflect.Value, error) {
+
+	if t == reflect.TypeOf(now) {
+		if def != defaultNow {
+			return reflect.Value{}, fmt.Errorf("%w: invalid default %q for %s", ErrStructConfig, def, t)
+		}
+		return reflect.ValueOf(now), nil
+	}
+
+	if reflect.PtrTo(t).Implements(scannerType) {
+		v := reflect.New(t)
+		if err := v.Interface().(sql.Scanner).Scan(def); err != nil {
+			return reflect.Value{}, fmt.Errorf("%w: invalid default %q for %s: %v", ErrStructConfig, def, t, err)
+		}
+		return v.Elem(), nil
+	}
+
+	v := reflect.New(t).Elem()
+	var err error
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		var e reflect.Value
+		if e, err = defaultValue(t.Elem(), def, now); err == nil {
+			v = reflect.New(t.Elem())
+			v.Elem().Set(e)
+		}
+	case reflect.String:
+		v.SetString(def)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(def)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(def, 10, t.Bits())
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(def, 10, t.Bits())
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var fl float64
+		fl, err = strconv.ParseFloat(def, t.Bits())
+		v.SetFloat(fl)
+	default:
+		return reflect.Value{}, fmt.Errorf("%w: no default supported for %s", ErrStructConfig, t)
+	}
+
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("%w: invalid default %q for %s", ErrStructConfig, def, t)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect abstracts the differences in SQL syntax between databases. Queries
+// are built using backtick quoted identifiers and ? placeholders and are
+// translated to the dialect right before execution.
+type Dialect interface {
+	// Name returns a short name of the dialect like "mysql"
+	Name() string
+	// Quote quotes a single identifier
+	Quote(ident string) string
+	// Placeholder returns the bind variable for the n-th argument, starting at 1
+	Placeholder(n int) string
+	// Limit returns the clause limiting a result, including a leading space
+	Limit(limit, offset int) string
+	// Returning reports whether generated values are read via a RETURNING
+	// clause instead of LastInsertId
+	Returning() bool
+	// Upsert returns the clause appended to an INSERT updating cols if a row
+	// with the same keys exists, including a leading space
+	Upsert(keys, cols []string) string
+}
+
+// Dialects shipped with the package
+var (
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+// WithDialect overrides the dialect detected from the driver name
+func WithDialect(d Dialect) Option {
+	return func(g *Gateway) error {
+		if d == nil {
+			return ErrOption
+		}
+		g.dialect = d
+		return nil
+	}
+}
+
+// Dialect returns the dialect statements of the gateway are translated to
+func (g *Gateway) Dialect() Dialect {
+	return g.dialect
+}
+
+// dialectFor returns the dialect for given sql driver name. Unknown drivers
+// are treated as MySQL.
+func dialectFor(driver string) Dialect {
+	switch driver {
+	case "postgres", "pgx", "pq", "cloudsqlpostgres":
+		return Postgres
+	case "sqlite3", "sqlite":
+		return SQLite
+	default:
+		return MySQL
+	}
+}
+
+// mysqlDialect implements Dialect for MySQL and MariaDB
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string { return "mysql" }
+
+func (mysqlDialect) Quote(ident string) string {
+	return "`" + strings.Replace(ident, "`", "``", -1) + "`"
+}
+
+func (mysqlDialect) Placeholder(int) string { return "?" }
+
+func (mysqlDialect) Limit(limit, offset int) string {
+	if limit < 0 && offset > 0 {
+		// MySQL needs a LIMIT for OFFSET, use the largest one possible
+		return fmt.Sprintf(" LIMIT 18446744073709551615 OFFSET %d", offset)
+	}
+	return limitOffset(limit, offset)
+}
+
+func (mysqlDialect) Returning() bool { return false }
+
+func (mysqlDialect) Upsert(keys, cols []string) string {
+	if len(cols) == 0 {
+		// Keep the existing row untouched
+		cols = keys[:1]
+	}
+	//noinspection GoPreferNilSlice
+	set := []string{}
+	for _, col := range quoteIdents(cols) {
+		set = append(set, fmt.Sprintf("%s = VALUES(%s)", col, col))
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(set, ",")
+}
+
+// postgresDialect implements Dialect for PostgreSQL
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) Quote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (postgresDialect) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+
+func (postgresDialect) Limit(limit, offset int) string {
+	return limitOffset(limit, offset)
+}
+
+func (postgresDialect) Returning() bool { return true }
+
+func (postgresDialect) Upsert(keys, cols []string) string {
+	return onConflict(keys, cols)
+}
+
+// sqliteDialect implements Dialect for SQLite
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+func (sqliteDialect) Quote(ident string) string {
+	return `"` + strings.Replace(ident, `"`, `""`, -1) + `"`
+}
+
+func (sqliteDialect) Placeholder(int) string { return "?" }
+
+func (sqliteDialect) Limit(limit, offset int) string {
+	if limit < 0 && offset > 0 {
+		// SQLite needs a LIMIT for OFFSET, -1 means no limit
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+	return limitOffset(limit, offset)
+}
+
+func (sqliteDialect) Returning() bool { return false }
+
+func (sqliteDialect) Upsert(keys, cols []string) string {
+	return onConflict(keys, cols)
+}
+
+// onConflict renders the standard ON CONFLICT clause used by PostgreSQL and
+// SQLite
+func onConflict(keys, cols []string) string {
+	q := fmt.Sprintf(" ON CONFLICT (%s)", strings.Join(quoteIdents(keys), ","))
+	if len(cols) == 0 {
+		return q + " DO NOTHING"
+	}
+	//noinspection GoPreferNilSlice
+	set := []string{}
+	for _, col := range quoteIdents(cols) {
+		set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", col, col))
+	}
+	return q + " DO UPDATE SET " + strings.Join(set, ",")
+}
+
+// limitOffset renders the common LIMIT ... OFFSET ... clause. A negative
+// limit omits the LIMIT part.
+func limitOffset(limit, offset int) string {
+	q := ""
+	if limit >= 0 {
+		q = fmt.Sprintf(" LIMIT %d", limit)
+	}
+	if offset > 0 {
+		q = q + fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return q
+}
+
+// Translate rewrites a query built with backtick quoted identifiers and ?
+// placeholders to given dialect, like gateways do right before execution
+func Translate(d Dialect, q string) string {
+	return translate(d, q)
+}
+
+// translate rewrites a query built with backtick quoted identifiers and ?
+// placeholders to given dialect. String literals are left untouched.
+func translate(d Dialect, q string) string {
+
+	if d == MySQL {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+
+	for i := 0; i < len(q); i++ {
+		switch c := q[i]; c {
+		case '\'':
+			// Copy string literal, '' is an escaped quote
+			j := i + 1
+			for j < len(q) {
+				if q[j] == '\'' {
+					if j+1 < len(q) && q[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(q) {
+				j = len(q) - 1
+			}
+			b.WriteString(q[i : j+1])
+			i = j
+		case '`':
+			// Collect identifier, `` is an escaped backtick
+			var ident strings.Builder
+			j := i + 1
+			for j < len(q) {
+				if q[j] == '`' {
+					if j+1 < len(q) && q[j+1] == '`' {
+						ident.WriteByte('`')
+						j += 2
+						continue
+					}
+					break
+				}
+				ident.WriteByte(q[j])
+				j++
+			}
+			b.WriteString(d.Quote(ident.String()))
+			i = j
+		case '?':
+			n++
+			b.WriteString(d.Placeholder(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
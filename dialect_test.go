@@ -0,0 +1,149 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"testing"
+)
+
+// TestTranslate checks the rewriting of queries to the dialects shipped
+func TestTranslate(t *testing.T) {
+
+	q := "SELECT * FROM `users` WHERE `name` = ? AND `age` > ?"
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		in      string
+		out     string
+	}{
+		{"mysql untouched", MySQL, q, q},
+		{"postgres", Postgres, q, `SELECT * FROM "users" WHERE "name" = $1 AND "age" > $2`},
+		{"sqlite", SQLite, q, `SELECT * FROM "users" WHERE "name" = ? AND "age" > ?`},
+		{"literal kept", Postgres, "SELECT '?`x`' FROM `t` WHERE `a` = ?", `SELECT '?` + "`x`" + `' FROM "t" WHERE "a" = $1`},
+		{"escaped quote in literal", Postgres, "SELECT 'it''s ?' WHERE `a` = ?", `SELECT 'it''s ?' WHERE "a" = $1`},
+		{"escaped backtick", Postgres, "SELECT `a``b` FROM `t`", `SELECT "a` + "`" + `b" FROM "t"`},
+		{"double quote in identifier", SQLite, "SELECT `a\"b` FROM `t`", `SELECT "a""b" FROM "t"`},
+		{"unterminated literal", Postgres, "SELECT 'abc", "SELECT 'abc"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if out := Translate(tc.dialect, tc.in); out != tc.out {
+				t.Errorf("Translate() = %q, want %q", out, tc.out)
+			}
+		})
+	}
+}
+
+// TestDialectFor checks the dialect detected from driver names
+func TestDialectFor(t *testing.T) {
+
+	tests := []struct {
+		driver string
+		name   string
+	}{
+		{"mysql", "mysql"},
+		{"postgres", "postgres"},
+		{"pgx", "postgres"},
+		{"pq", "postgres"},
+		{"cloudsqlpostgres", "postgres"},
+		{"sqlite3", "sqlite"},
+		{"sqlite", "sqlite"},
+		{"ql", "mysql"},
+		{"unknown", "mysql"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.driver, func(t *testing.T) {
+			if name := dialectFor(tc.driver).Name(); name != tc.name {
+				t.Errorf("dialectFor(%q) = %q, want %q", tc.driver, name, tc.name)
+			}
+		})
+	}
+}
+
+// TestDialectClauses checks the LIMIT and upsert clauses of the dialects
+func TestDialectClauses(t *testing.T) {
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"mysql limit", MySQL.Limit(10, 0), " LIMIT 10"},
+		{"mysql limit offset", MySQL.Limit(10, 20), " LIMIT 10 OFFSET 20"},
+		{"mysql offset only", MySQL.Limit(-1, 20), " LIMIT 18446744073709551615 OFFSET 20"},
+		{"postgres offset only", Postgres.Limit(-1, 20), " OFFSET 20"},
+		{"sqlite offset only", SQLite.Limit(-1, 20), " LIMIT -1 OFFSET 20"},
+		{"no limit", SQLite.Limit(-1, 0), ""},
+		{"mysql upsert", MySQL.Upsert([]string{"id"}, []string{"name", "age"}), " ON DUPLICATE KEY UPDATE `name` = VALUES(`name`),`age` = VALUES(`age`)"},
+		{"mysql upsert without columns", MySQL.Upsert([]string{"id"}, nil), " ON DUPLICATE KEY UPDATE `id` = VALUES(`id`)"},
+		{"postgres upsert", Postgres.Upsert([]string{"a", "b"}, []string{"name"}), " ON CONFLICT (`a`,`b`) DO UPDATE SET `name` = EXCLUDED.`name`"},
+		{"sqlite upsert without columns", SQLite.Upsert([]string{"id"}, nil), " ON CONFLICT (`id`) DO NOTHING"},
+		{"postgres quote", Postgres.Quote(`a"b`), `"a""b"`},
+		{"mysql quote", MySQL.Quote("a`b"), "`a``b`"},
+		{"postgres placeholder", Postgres.Placeholder(3), "$3"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.got != tc.want {
+				t.Errorf("got %q, want %q", tc.got, tc.want)
+			}
+		})
+	}
+}
+
+// TestDialectStatements checks the statements gateways build in each dialect
+func TestDialectStatements(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		op      func(g *Gateway) error
+		want    string
+	}{
+		{"mysql select", MySQL, func(g *Gateway) error {
+			var users []testUser
+			return g.Select(&users, Selectors{"name": "a", "age >": 1}, nil)
+		}, "SELECT * FROM `users` WHERE `age` > ? AND `name` = ?"},
+		{"postgres select", Postgres, func(g *Gateway) error {
+			var users []testUser
+			return g.Select(&users, Selectors{"name": "a", "age >": 1}, nil)
+		}, `SELECT * FROM "users" WHERE "age" > $1 AND "name" = $2`},
+		{"postgres update", Postgres, func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "a", Age: 2})
+		}, `UPDATE "users" SET "name" = $1,"age" = $2 WHERE "id" = $3`},
+		{"sqlite delete", SQLite, func(g *Gateway) error {
+			return g.Delete(&testUser{ID: 1})
+		}, `DELETE FROM "users" WHERE "id" = ?`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := testGateway(t, testDB(t), "users", WithDialect(tc.dialect))
+			stmts, err := g.DryRun(func(dg *Gateway) error {
+				return tc.op(dg)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stmts) != 1 || stmts[0].SQL != tc.want {
+				t.Errorf("statements = %+v, want %q", stmts, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"sync"
+)
+
+// Statement is a sql statement with its arguments as sent to the database
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// DryRun runs fn with a copy of the gateway which builds all statements in
+// the gateways dialect but does not send them to the database, and returns
+// them in order. Writes report a single affected row, reads find no rows so
+// Read and similar calls in fn return an error matching ErrNotFound. The read
+// cache and change handlers, see WithCache and OnChange, are not used.
+func (g *Gateway) DryRun(fn func(dg *Gateway) error) ([]Statement, error) {
+
+	rec := &dryRecorder{}
+	db := sqlx.NewDb(sql.OpenDB(dryConnector{rec: rec}), g.ext.DriverName())
+	defer db.Close()
+
+	dg := *g
+	dg.dbx = db
+	dg.ext = db
+	dg.tx = nil
+	dg.stmts = nil
+	dg.replicas = nil
+	dg.retries = nil
+	dg.onChange = nil
+	dg.cache = nil
+	dg.changes = nil
+
+	err := fn(&dg)
+
+	return rec.statements(), err
+}
+
+// dryRecorder collects the statements of a dry run
+type dryRecorder struct {
+	mu    sync.Mutex
+	stmts []Statement
+}
+
+// add records a statement
+func (r *dryRecorder) add(q string, args []driver.NamedValue) {
+
+	//noinspection GoPreferNilSlice
+	vals := []interface{}{}
+	for _, a := range args {
+		vals = append(vals, a.Value)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stmts = append(r.stmts, Statement{SQL: q, Args: vals})
+}
+
+// statements returns all recorded statements
+func (r *dryRecorder) statements() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stmts
+}
+
+// dryConnector connects to a database accepting every statement
+type dryConnector struct {
+	rec *dryRecorder
+}
+
+// Connect implements driver.Connector
+func (c dryConnector) Connect(context.Context) (driver.Conn, error) {
+	return dryConn(c), nil
+}
+
+// Driver implements driver.Connector
+func (c dryConnector) Driver() driver.Driver {
+	return dryDriver{}
+}
+
+// dryDriver is the driver of dry runs, it is never opened by name
+type dryDriver struct{}
+
+// Open implements driver.Driver
+func (dryDriver) Open(string) (driver.Conn, error) {
+	return nil, driver.ErrSkip
+}
+
+// dryConn records all statements and returns empty results
+type dryConn struct {
+	rec *dryRecorder
+}
+
+// Prepare implements driver.Conn
+func (c dryConn) Prepare(q string) (driver.Stmt, error) {
+	return dryStmt{rec: c.rec, q: q}, nil
+}
+
+// Close implements driver.Conn
+func (dryConn) Close() error {
+	return nil
+}
+
+// Begin implements driver.Conn
+func (dryConn) Begin() (driver.Tx, error) {
+	return dryTx{}, nil
+}
+
+// CheckNamedValue implements driver.NamedValueChecker keeping all arguments
+// as given
+func (dryConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+// ExecContext implements driver.ExecerContext
+func (c dryConn) ExecContext(_ context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	c.rec.add(q, args)
+	return dryResult{}, nil
+}
+
+// QueryContext implements driver.QueryerContext
+func (c dryConn) QueryContext(_ context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	c.rec.add(q, args)
+	return dryRows{}, nil
+}
+
+// dryStmt is a prepared statement of a dry run
+type dryStmt struct {
+	rec *dryRecorder
+	q   string
+}
+
+// Close implements driver.Stmt
+func (dryStmt) Close() error {
+	return nil
+}
+
+// NumInput implements driver.Stmt
+func (dryStmt) NumInput() int {
+	return -1
+}
+
+// Exec implements driver.Stmt
+func (s dryStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.rec.add(s.q, namedValues(args))
+	return dryResult{}, nil
+}
+
+// Query implements driver.Stmt
+func (s dryStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.rec.add(s.q, namedValues(args))
+	return dryRows{}, nil
+}
+
+// namedValues converts positional driver values
+func namedValues(args []driver.Value) []driver.NamedValue {
+	//noinspection GoPreferNilSlice
+	nv := []driver.NamedValue{}
+	for i, v := range args {
+		nv = append(nv, driver.NamedValue{Ordinal: i + 1, Value: v})
+	}
+	return nv
+}
+
+// dryTx is a transaction of a dry run
+type dryTx struct{}
+
+// Commit implements driver.Tx
+func (dryTx) Commit() error {
+	return nil
+}
+
+// Rollback implements driver.Tx
+func (dryTx) Rollback() error {
+	return nil
+}
+
+// dryResult reports a single affected row
+type dryResult struct{}
+
+// LastInsertId implements driver.Result
+func (dryResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+// RowsAffected implements driver.Result
+func (dryResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+// dryRows is an empty result set
+type dryRows struct{}
+
+// Columns implements driver.Rows
+func (dryRows) Columns() []string {
+	return []string{}
+}
+
+// Close implements driver.Rows
+func (dryRows) Close() error {
+	return nil
+}
+
+// Next implements driver.Rows
+func (dryRows) Next([]driver.Value) error {
+	return io.EOF
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"reflect"
+)
+
+// SelectEach scans the rows matching params one at a time into the struct
+// dest points to and calls fn with dest for each of them, so large results
+// are never held in memory. Returning an error from fn stops the iteration.
+// The connection is busy while iterating, queries run by fn use another one.
+func (g *Gateway) SelectEach(dest interface{}, params Condition, orderby Orderer, fn func(dest interface{}) error) error {
+	return g.SelectEachContext(context.Background(), dest, params, orderby, fn)
+}
+
+// SelectEachContext is like SelectEach but runs with given context
+func (g *Gateway) SelectEachContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer, fn func(dest interface{}) error) (err error) {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return err
+	}
+
+	q, args := buildSelect(table, nil, params, orderby, g.softDeleteCol(dest))
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	rows, err := g.queryRows(ctx, opSelect, table, q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	m := scanMeta(dest)
+	v := reflect.ValueOf(dest).Elem()
+
+	for rows.Next() {
+		v.Set(reflect.Zero(v.Type()))
+		if m != nil {
+			err = scanStruct(rows, v, m, g.cipher)
+		} else {
+			err = rows.StructScan(dest)
+		}
+		if err != nil {
+			return err
+		}
+		g.localize(dest)
+		if err := fn(dest); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// FindInBatches walks the rows matching params ordered by primary key in
+// batches of batchSize rows. Each batch is selected into the slice dest points
+// to and handed to fn together with a gateway bound to a transaction, which
+// is committed after every batch. Tables with composite keys are not
+// supported.
+func (g *Gateway) FindInBatches(dest interface{}, params Condition, batchSize int, fn func(txg *Gateway, batch interface{}) error) error {
+	return g.FindInBatchesContext(context.Background(), dest, params, batchSize, fn)
+}
+
+// FindInBatchesContext is like FindInBatches but runs with given context
+func (g *Gateway) FindInBatchesContext(ctx context.Context, dest interface{}, params Condition, batchSize int, fn func(txg *Gateway, batch interface{}) error) error {
+
+	if batchSize < 1 {
+		return ErrPage
+	}
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if len(destcfg.PrimaryDBs) != 1 {
+		return ErrPrimaryType
+	}
+
+	pk := destcfg.PrimaryDBs[0]
+	s := reflect.ValueOf(dest).Elem()
+
+	var last interface{}
+	for {
+		n := 0
+		err := g.transact(ctx, nil, func(txg *Gateway) error {
+			s.Set(reflect.MakeSlice(s.Type(), 0, batchSize))
+			q := txg.Query().Where(params).OrderBy(Sorts{Asc(pk)}).Limit(batchSize)
+			if last != nil {
+				q = q.Where(Selectors{pk + " >": last})
+			}
+			if err := q.AllContext(ctx, dest); err != nil {
+				return err
+			}
+			if n = s.Len(); n == 0 {
+				return nil
+			}
+			last = reflect.Indirect(s.Index(n - 1)).FieldByIndex(destcfg.PrimaryIdx[0]).Interface()
+			return fn(txg, dest)
+		})
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// eagerJoin is a relation joined by SelectEager
+type eagerJoin struct {
+	rel   *relation
+	alias string
+	meta  *tabMeta
+	cols  []string
+	typ   reflect.Type
+	seen  map[string]bool
+	first int
+}
+
+// SelectEager works like Select but loads given relation fields, see Preload,
+// within the same query by left joining their tables. Parents are returned
+// once no matter how many children they have. Unqualified selector and
+// ordering keys refer to the gateways table.
+func (g *Gateway) SelectEager(dest interface{}, relations []string, params Condition, orderby Orderer) error {
+	return g.SelectEagerContext(context.Background(), dest, relations, params, orderby)
+}
+
+// SelectEagerContext is like SelectEager but runs with given context
+func (g *Gateway) SelectEagerContext(ctx context.Context, dest interface{}, relations []string, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: dest must point to a slice", ErrRelation)
+	}
+	slice = slice.Elem()
+
+	et := baseType(slice.Type())
+	pcfg, err := structMeta(et)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	pcols := sortedCols(pcfg)
+	for _, c := range pcols {
+		cols = append(cols, fmt.Sprintf("%s.`%s`", quoteTable(table), c))
+	}
+
+	//noinspection GoPreferNilSlice
+	clauses := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	//noinspection GoPreferNilSlice
+	joins := []*eagerJoin{}
+
+	for i, name := range relations {
+
+		rel, err := parseRelation(et, name)
+		if err != nil {
+			return err
+		}
+
+		j := &eagerJoin{rel: rel, alias: fmt.Sprintf("r%d", i+1), typ: baseType(rel.field.Type), first: len(cols)}
+		if j.meta, err = structMeta(j.typ); err != nil {
+			return err
+		}
+		if len(j.meta.PrimaryDBs) != 1 || (rel.hasMany && len(pcfg.PrimaryDBs) != 1) {
+			return fmt.Errorf("%w: %s needs a single primary key", ErrRelation, name)
+		}
+
+		j.cols = sortedCols(j.meta)
+		for _, c := range j.cols {
+			cols = append(cols, fmt.Sprintf("`%s`.`%s`", j.alias, c))
+		}
+
+		// Has many joins the child by its fk, belongs to the owner by its key
+		local, remote := pcfg.PrimaryDBs[0], rel.fk
+		if !rel.hasMany {
+			local, remote = rel.fk, j.meta.PrimaryDBs[0]
+		}
+		if _, ok := pcfg.Fields[local]; !ok {
+			return fmt.Errorf("%w: %s has no column %s", ErrRelation, name, local)
+		}
+		if _, ok := j.meta.Fields[remote]; !ok {
+			return fmt.Errorf("%w: %s has no column %s", ErrRelation, name, remote)
+		}
+
+		on := fmt.Sprintf("%s.`%s` = `%s`.`%s`", quoteTable(table), local, j.alias, remote)
+
+		if sc := g.softDeleteCol(reflect.New(j.typ).Interface()); sc != "" {
+			on = on + fmt.Sprintf(" AND `%s`.`%s` IS NULL", j.alias, sc)
+		}
+
+		tc, err := g.tenantCondFor(reflect.New(j.typ).Interface())
+		if err != nil {
+			return err
+		}
+		if tc != nil {
+			t, targs := tc.condition(func(c string) string { return fmt.Sprintf("`%s`.`%s`", j.alias, c) })
+			on = on + " AND " + t
+			args = append(args, targs...)
+		}
+
+		clauses = append(clauses, fmt.Sprintf(
+			"LEFT JOIN %s AS `%s` ON %s",
+			quoteTable(g.qualify(rel.table)),
+			j.alias,
+			on,
+		))
+		joins = append(joins, j)
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return err
+	}
+
+	var qerr error
+	col := func(name string) string {
+		n, err := qualifyIdent(table, name)
+		if err != nil {
+			qerr = err
+		}
+		return n
+	}
+
+	//noinspection GoPreferNilSlice
+	where := []string{}
+	if params != nil {
+		w, wargs := params.condition(col)
+		if w != "" {
+			where = append(where, w)
+		}
+		args = append(args, wargs...)
+	}
+	if sc := g.softDeleteCol(dest); sc != "" {
+		where = append(where, fmt.Sprintf("%s.`%s` IS NULL", quoteTable(table), sc))
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ","), quoteTable(table))
+	if len(clauses) > 0 {
+		q = q + " " + strings.Join(clauses, " ")
+	}
+	if len(where) > 0 {
+		q = q + " WHERE " + strings.Join(where, " AND ")
+	}
+	q = q + orderClause(orderby, col)
+
+	if qerr != nil {
+		return qerr
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	rows, err := g.queryRows(ctx, opSelect, table, q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	//noinspection GoPreferNilSlice
+	parents := []reflect.Value{}
+	byKey := map[string]reflect.Value{}
+
+	for _, j := range joins {
+		j.seen = map[string]bool{}
+	}
+
+	targets := make([]interface{}, len(cols))
+
+	for rows.Next() {
+
+		p := reflect.New(et).Elem()
+		for i, c := range pcols {
+			targets[i] = scanTarget(p, c, pcfg, g.cipher)
+		}
+
+		// Joined columns may be NULL, they are scanned into pointers first.
+		// Json and encrypted columns handle NULL and scan into the entity.
+		ents := make([]reflect.Value, len(joins))
+		holders := make([][]reflect.Value, len(joins))
+		for x, j := range joins {
+			ents[x] = reflect.New(j.typ).Elem()
+			for i, c := range j.cols {
+				if inArray(c, j.meta.JSONCols) || inArray(c, j.meta.Encrypted) {
+					targets[j.first+i] = scanTarget(ents[x], c, j.meta, g.cipher)
+					holders[x] = append(holders[x], reflect.Value{})
+					continue
+				}
+				h := reflect.New(reflect.PtrTo(ents[x].FieldByIndex(j.meta.Fields[c]).Type()))
+				targets[j.first+i] = h.Interface()
+				holders[x] = append(holders[x], h)
+			}
+		}
+
+		if err := rows.Scan(targets...); err != nil {
+			return err
+		}
+
+		if g.loc != nil {
+			localizeValue(p, g.loc)
+			for _, hs := range holders {
+				for _, h := range hs {
+					if h.IsValid() {
+						localizeValue(h, g.loc)
+					}
+				}
+			}
+		}
+
+		k := entityKey(p, pcfg)
+		if prev, ok := byKey[k]; ok {
+			p = prev
+		} else {
+			for _, j := range joins {
+				if f := p.FieldByIndex(j.rel.field.Index); j.rel.hasMany {
+					f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+				}
+			}
+			byKey[k] = p
+			parents = append(parents, p)
+		}
+
+		for x, j := range joins {
+			j.attach(p, k, ents[x], holders[x])
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	out := reflect.MakeSlice(slice.Type(), 0, len(parents))
+	for _, p := range parents {
+		if slice.Type().Elem().Kind() == reflect.Ptr {
+			out = reflect.Append(out, p.Addr())
+		} else {
+			out = reflect.Append(out, p)
+		}
+	}
+	slice.Set(out)
+
+	return nil
+}
+
+// attach copies the scanned columns into related entity e and sets it on
+// parent p with key k unless the joined row was NULL or is already attached
+func (j *eagerJoin) attach(p reflect.Value, k string, e reflect.Value, holders []reflect.Value) {
+
+	for i, c := range j.cols {
+		h := holders[i]
+		if !h.IsValid() {
+			continue
+		}
+		if c == j.meta.PrimaryDBs[0] && h.Elem().IsNil() {
+			return
+		}
+		if !h.Elem().IsNil() {
+			e.FieldByIndex(j.meta.Fields[c]).Set(h.Elem().Elem())
+		}
+	}
+
+	ck := k + "\x00" + entityKey(e, j.meta)
+	if j.seen[ck] {
+		return
+	}
+	j.seen[ck] = true
+
+	f := p.FieldByIndex(j.rel.field.Index)
+	v := e
+	if (j.rel.hasMany && f.Type().Elem().Kind() == reflect.Ptr) || (!j.rel.hasMany && f.Kind() == reflect.Ptr) {
+		v = e.Addr()
+	}
+
+	if j.rel.hasMany {
+		f.Set(reflect.Append(f, v))
+	} else {
+		f.Set(v)
+	}
+}
+
+// entityKey returns the printed primary key values of struct value v
+func entityKey(v reflect.Value, m *tabMeta) string {
+
+	//noinspection GoPreferNilSlice
+	keys := []string{}
+	for _, c := range m.PrimaryDBs {
+		keys = append(keys, fmt.Sprint(v.FieldByIndex(m.Fields[c]).Interface()))
+	}
+
+	return strings.Join(keys, "\x00")
+}
+
+// sortedCols returns the columns of m in a stable order
+func sortedCols(m *tabMeta) []string {
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	for c := range m.Fields {
+		cols = append(cols, c)
+	}
+	sort.Strings(cols)
+
+	return cols
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// EnumValues returns the values allowed for column col of the entity type
+// dest refers to by a tag like tgw:"insert,update,enum=active|inactive|banned"
+// or nil if it has none. Creates and updates of such columns fail with a
+// *ValidationError matching ErrEnum for other values, NULL is allowed.
+func EnumValues(dest interface{}, col string) []string {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return nil
+	}
+
+	vals, ok := destcfg.Enums[col]
+	if !ok {
+		return nil
+	}
+
+	return append([]string{}, vals...)
+}
+
+// parseEnum returns the values of an enum tag value
+func parseEnum(v string) []string {
+	return strings.Split(v, "|")
+}
+
+// checkEnums checks the enum columns of entity dest hold allowed values.
+// Empty columns tagged omitempty are not written and skipped.
+func checkEnums(dest interface{}, destcfg *tabMeta) error {
+
+	if len(destcfg.Enums) == 0 {
+		return nil
+	}
+
+	r := reflect.ValueOf(dest).Elem()
+
+	for col := range destcfg.Enums {
+		f := r.FieldByIndex(destcfg.Fields[col])
+		if inArray(col, destcfg.OmitEmpty) && f.IsZero() {
+			continue
+		}
+		if err := checkEnum(destcfg, col, f.Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPatchEnums checks the values of enum columns in changes of a Patch of
+// entity dest. Expressions are computed by the database and not checked.
+func checkPatchEnums(dest interface{}, destcfg *tabMeta, changes map[string]interface{}) error {
+	for col, v := range changes {
+		if s, _ := valueSQL(v); s != "?" {
+			continue
+		}
+		if err := checkEnum(destcfg, col, v); err != nil {
+			return &ValidationError{Entity: entityName(dest), Err: err}
+		}
+	}
+	return nil
+}
+
+// checkEnum checks v is allowed for column col if it is an enum column
+func checkEnum(destcfg *tabMeta, col string, v interface{}) error {
+
+	vals, ok := destcfg.Enums[col]
+	if !ok {
+		return nil
+	}
+
+	v = memValue(v)
+	if v == nil {
+		return nil
+	}
+
+	if s := fmt.Sprint(v); !inArray(s, vals) {
+		return fmt.Errorf("%w: %q for %s, allowed: %s", ErrEnum, s, col, strings.Join(vals, ","))
+	}
+
+	return nil
+}
@@ -0,0 +1,298 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"time"
+)
+
+// Operation names passed to observers
+const (
+	opCreate = "create"
+	opRead   = "read"
+	opUpdate = "update"
+	opDelete = "delete"
+	opSelect = "select"
+	opCount  = "count"
+	opSchema = "schema"
+)
+
+// exec runs a statement with positional parameters
+func (g *Gateway) exec(ctx context.Context, op, table, q string, args ...interface{}) (res sql.Result, err error) {
+
+	if err := g.writable(op); err != nil {
+		return nil, err
+	}
+
+	g, done := g.route(op)
+	defer done()
+
+	args = g.bindLocation(g.bindCipher(args))
+
+	if g.observing() {
+		defer g.observe(ctx, op, table, &q, args, time.Now(), &err)
+	}
+
+	q = translate(g.dialect, q)
+
+	if g.logging() {
+		defer g.log(ctx, op, table, q, args, time.Now(), &err)
+	}
+
+	if g.tracer != nil {
+		var span QuerySpan
+		ctx, span = g.tracer.StartQuery(ctx, op, table, q)
+		defer func() { span.End(rowsAffected(res), err) }()
+	}
+
+	err = g.retry(ctx, func() error {
+		res, err = g.execOnce(ctx, q, args...)
+		return err
+	})
+
+	return res, err
+}
+
+// execOnce is a single attempt of exec with translated query q
+func (g *Gateway) execOnce(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+
+	if g.stmts == nil {
+		return g.ext.ExecContext(ctx, q, args...)
+	}
+
+	s, release, err := g.stmt(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.ExecContext(ctx, args...)
+}
+
+// get runs a query scanning a single row into dest
+func (g *Gateway) get(ctx context.Context, op, table string, dest interface{}, q string, args ...interface{}) (err error) {
+
+	if err := g.writable(op); err != nil {
+		return err
+	}
+
+	g, done := g.route(op)
+	defer done()
+
+	args = g.bindLocation(g.bindCipher(args))
+
+	if g.observing() {
+		defer g.observe(ctx, op, table, &q, args, time.Now(), &err)
+	}
+
+	if q, err = g.applyHints(q, table); err != nil {
+		return err
+	}
+
+	q = translate(g.dialect, q)
+
+	if g.logging() {
+		defer g.log(ctx, op, table, q, args, time.Now(), &err)
+	}
+
+	if g.tracer != nil {
+		var span QuerySpan
+		ctx, span = g.tracer.StartQuery(ctx, op, table, q)
+		defer func() { span.End(-1, err) }()
+	}
+
+	err = g.retry(ctx, func() error {
+		return g.getOnce(ctx, dest, q, args...)
+	})
+	if err == nil {
+		g.localize(dest)
+	}
+
+	return err
+}
+
+// getOnce is a single attempt of get with translated query q
+func (g *Gateway) getOnce(ctx context.Context, dest interface{}, q string, args ...interface{}) error {
+
+	if m := scanMeta(dest); m != nil {
+		rows, err := g.queryOnce(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		return scanOne(rows, dest, m, g.cipher)
+	}
+
+	if g.stmts == nil {
+		return sqlx.GetContext(ctx, g.ext, dest, q, args...)
+	}
+
+	s, release, err := g.stmt(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.GetContext(ctx, dest, args...)
+}
+
+// selectRows runs a query scanning all rows into dest
+func (g *Gateway) selectRows(ctx context.Context, op, table string, dest interface{}, q string, args ...interface{}) (err error) {
+
+	if err := g.writable(op); err != nil {
+		return err
+	}
+
+	g, done := g.route(op)
+	defer done()
+
+	args = g.bindLocation(g.bindCipher(args))
+
+	if g.observing() {
+		defer g.observe(ctx, op, table, &q, args, time.Now(), &err)
+	}
+
+	if q, err = g.applyHints(q, table); err != nil {
+		return err
+	}
+
+	q = translate(g.dialect, q)
+
+	if g.logging() {
+		defer g.log(ctx, op, table, q, args, time.Now(), &err)
+	}
+
+	if g.tracer != nil {
+		var span QuerySpan
+		ctx, span = g.tracer.StartQuery(ctx, op, table, q)
+		defer func() { span.End(-1, err) }()
+	}
+
+	v := reflect.ValueOf(dest).Elem()
+	n := v.Len()
+
+	err = g.retry(ctx, func() error {
+		// Drop rows appended by a failed attempt
+		v.SetLen(n)
+		return g.selectOnce(ctx, dest, q, args...)
+	})
+	if err == nil {
+		g.localize(dest)
+	}
+
+	return err
+}
+
+// selectOnce is a single attempt of selectRows with translated query q
+func (g *Gateway) selectOnce(ctx context.Context, dest interface{}, q string, args ...interface{}) error {
+
+	if m := scanMeta(dest); m != nil {
+		rows, err := g.queryOnce(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		return scanAll(rows, dest, m, g.cipher)
+	}
+
+	if g.stmts == nil {
+		return sqlx.SelectContext(ctx, g.ext, dest, q, args...)
+	}
+
+	s, release, err := g.stmt(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return s.SelectContext(ctx, dest, args...)
+}
+
+// queryRows runs a query of given operation and returns its rows
+func (g *Gateway) queryRows(ctx context.Context, op, table, q string, args ...interface{}) (rows *sqlx.Rows, err error) {
+
+	if err := g.writable(op); err != nil {
+		return nil, err
+	}
+
+	g, done := g.route(op)
+	defer done()
+
+	args = g.bindLocation(g.bindCipher(args))
+
+	if g.observing() {
+		defer g.observe(ctx, op, table, &q, args, time.Now(), &err)
+	}
+
+	if q, err = g.applyHints(q, table); err != nil {
+		return nil, err
+	}
+
+	q = translate(g.dialect, q)
+
+	if g.logging() {
+		defer g.log(ctx, op, table, q, args, time.Now(), &err)
+	}
+
+	if g.tracer != nil {
+		var span QuerySpan
+		ctx, span = g.tracer.StartQuery(ctx, op, table, q)
+		defer func() { span.End(-1, err) }()
+	}
+
+	err = g.retry(ctx, func() error {
+		rows, err = g.queryOnce(ctx, q, args...)
+		return err
+	})
+
+	return rows, err
+}
+
+// queryOnce is a single attempt of queryRows with translated query q
+func (g *Gateway) queryOnce(ctx context.Context, q string, args ...interface{}) (*sqlx.Rows, error) {
+
+	if g.stmts == nil {
+		return g.ext.QueryxContext(ctx, q, args...)
+	}
+
+	s, release, err := g.stmt(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return s.QueryxContext(ctx, args...)
+}
+
+// observing checks if statements have to be reported to an observer or the
+// slow query log
+func (g *Gateway) observing() bool {
+	return g.observer != nil || g.slowLog != nil
+}
+
+// observe reports a finished statement to the observer and, if it took at
+// least the slow query threshold, to the slow query log. The query is read
+// once done to report it in the gateways dialect.
+func (g *Gateway) observe(ctx context.Context, op, table string, q *string, args []interface{}, start time.Time, err *error) {
+	d := time.Since(start)
+	if g.observer != nil {
+		g.observer.ObserveQuery(op, table, d, *err)
+	}
+	if g.slowLog != nil && d >= g.slow {
+		g.slowLog.LogQuery(ctx, op, table, *q, args, d, *err)
+	}
+}
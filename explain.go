@@ -0,0 +1,123 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// ExplainSelect returns the plan of the query Select would run on the
+// gateways table for params and orderby, including index and optimizer
+// hints. MySQL uses EXPLAIN, SQLite EXPLAIN QUERY PLAN and PostgreSQL EXPLAIN
+// ANALYZE, which executes the query. Plans of a single column, like the lines
+// of PostgreSQL, are returned as is, others as a table of the plan rows.
+func (g *Gateway) ExplainSelect(params Condition, orderby Orderer) (string, error) {
+	return g.ExplainSelectContext(context.Background(), params, orderby)
+}
+
+// ExplainSelectContext is like ExplainSelect but runs with given context
+func (g *Gateway) ExplainSelectContext(ctx context.Context, params Condition, orderby Orderer) (string, error) {
+
+	if err := checkOrder(orderby, nil); err != nil {
+		return "", err
+	}
+	if err := checkCondition(params, nil); err != nil {
+		return "", err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return "", err
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return "", err
+	}
+
+	q, args := buildSelect(table, nil, params, orderby, "")
+
+	q, err = g.applyHints(q, table)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	rows, err := g.queryRows(ctx, opSelect, table, g.explainPrefix()+q, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	if len(cols) > 1 {
+		fmt.Fprintln(w, strings.Join(cols, "\t"))
+	}
+
+	for rows.Next() {
+		vals, err := rows.SliceScan()
+		if err != nil {
+			return "", err
+		}
+		//noinspection GoPreferNilSlice
+		cells := []string{}
+		for _, v := range vals {
+			cells = append(cells, explainValue(v))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// explainPrefix returns the EXPLAIN statement of the gateways dialect
+func (g *Gateway) explainPrefix() string {
+	switch g.dialect.Name() {
+	case "postgres":
+		return "EXPLAIN ANALYZE "
+	case "sqlite":
+		return "EXPLAIN QUERY PLAN "
+	}
+	return "EXPLAIN "
+}
+
+// explainValue formats a cell of a plan row
+func explainValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(x)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ExportCSV streams the rows matching params to w as CSV, starting with a
+// header of the column names. Rows are scanned one at a time into the struct
+// dest points to like SelectEach, columns follow the field order of the
+// struct. NULL is written as an empty field, times in RFC 3339 and json
+// columns as their encoding.
+func (g *Gateway) ExportCSV(w io.Writer, dest interface{}, params Condition, orderby Orderer) error {
+	return g.ExportCSVContext(context.Background(), w, dest, params, orderby)
+}
+
+// ExportCSVContext is like ExportCSV but runs with given context
+func (g *Gateway) ExportCSVContext(ctx context.Context, w io.Writer, dest interface{}, params Condition, orderby Orderer) error {
+
+	m, err := structMeta(baseType(reflect.TypeOf(dest)))
+	if err != nil {
+		return err
+	}
+
+	cols := exportColumns(m)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cols))
+
+	err = g.SelectEachContext(ctx, dest, params, orderby, func(dest interface{}) error {
+		v := reflect.ValueOf(dest).Elem()
+		for i, col := range cols {
+			s, err := csvValue(v.FieldByIndex(m.Fields[col]).Interface())
+			if err != nil {
+				return err
+			}
+			record[i] = s
+		}
+		return cw.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// ExportNDJSON streams the rows matching params to w as newline delimited
+// json, one object keyed by column names per row. Rows are scanned one at a
+// time into the struct dest points to like SelectEach.
+func (g *Gateway) ExportNDJSON(w io.Writer, dest interface{}, params Condition, orderby Orderer) error {
+	return g.ExportNDJSONContext(context.Background(), w, dest, params, orderby)
+}
+
+// ExportNDJSONContext is like ExportNDJSON but runs with given context
+func (g *Gateway) ExportNDJSONContext(ctx context.Context, w io.Writer, dest interface{}, params Condition, orderby Orderer) error {
+
+	m, err := structMeta(baseType(reflect.TypeOf(dest)))
+	if err != nil {
+		return err
+	}
+
+	cols := exportColumns(m)
+	enc := json.NewEncoder(w)
+
+	return g.SelectEachContext(ctx, dest, params, orderby, func(dest interface{}) error {
+		v := reflect.ValueOf(dest).Elem()
+		obj := make(map[string]interface{}, len(cols))
+		for _, col := range cols {
+			f := v.FieldByIndex(m.Fields[col]).Interface()
+			if inArray(col, m.JSONCols) {
+				obj[col] = f
+				continue
+			}
+			obj[col] = memValue(f)
+		}
+		return enc.Encode(obj)
+	})
+}
+
+// exportColumns returns the columns of m in the field order of the struct
+func exportColumns(m *tabMeta) []string {
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	for col := range m.Fields {
+		cols = append(cols, col)
+	}
+
+	sort.Slice(cols, func(i, j int) bool {
+		a, b := m.Fields[cols[i]], m.Fields[cols[j]]
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	return cols
+}
+
+// csvValue formats the field value v as a CSV field
+func csvValue(v interface{}) (string, error) {
+
+	switch x := memValue(v).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case time.Time:
+		return x.Format(time.RFC3339Nano), nil
+	case int64, float64, bool:
+		return fmt.Sprint(x), nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
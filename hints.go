@@ -0,0 +1,106 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"strings"
+)
+
+// indexHint is a MySQL index hint like USE INDEX (idx_name)
+type indexHint struct {
+	kind  string
+	names []string
+}
+
+// UseIndex returns a copy of the gateway suggesting MySQL to use one of the
+// named indexes for the table of its SELECT statements. Index hints are
+// ignored on other dialects.
+func (g *Gateway) UseIndex(names ...string) *Gateway {
+	return g.withIndexHint("USE INDEX", names)
+}
+
+// ForceIndex is like UseIndex but makes MySQL avoid table scans if one of the
+// named indexes can be used
+func (g *Gateway) ForceIndex(names ...string) *Gateway {
+	return g.withIndexHint("FORCE INDEX", names)
+}
+
+// IgnoreIndex is like UseIndex but keeps MySQL from using the named indexes
+func (g *Gateway) IgnoreIndex(names ...string) *Gateway {
+	return g.withIndexHint("IGNORE INDEX", names)
+}
+
+// withIndexHint returns a copy of the gateway with given index hint
+func (g *Gateway) withIndexHint(kind string, names []string) *Gateway {
+	hg := *g
+	hg.indexHint = nil
+	if len(names) > 0 {
+		hg.indexHint = &indexHint{kind: kind, names: append([]string{}, names...)}
+	}
+	return &hg
+}
+
+// Hint returns a copy of the gateway adding optimizer hints like
+// "NO_INDEX_MERGE(users)" to its SELECT statements, which are written as a
+// /*+ ... */ comment after the SELECT keyword as read by MySQL and the
+// pg_hint_plan extension of PostgreSQL. Hints must never hold user input.
+func (g *Gateway) Hint(hints ...string) *Gateway {
+	hg := *g
+	hg.hints = append(append([]string{}, g.hints...), hints...)
+	return &hg
+}
+
+// applyHints adds the optimizer and index hints of the gateway to SELECT
+// statement q reading table. Other statements are returned unchanged.
+func (g *Gateway) applyHints(q string, table string) (string, error) {
+
+	if !strings.HasPrefix(q, "SELECT ") {
+		return q, nil
+	}
+
+	//noinspection GoPreferNilSlice
+	hints := []string{}
+	for _, h := range g.hints {
+		if strings.Contains(h, "*/") {
+			return "", ErrHint
+		}
+		if h = strings.TrimSpace(h); h != "" {
+			hints = append(hints, h)
+		}
+	}
+	if h := g.timeoutHint(); h != "" {
+		hints = append(hints, h)
+	}
+
+	if ih := g.indexHint; ih != nil && g.dialect.Name() == "mysql" {
+		if !validIdent(ih.names...) {
+			return "", ErrHint
+		}
+		from := "FROM " + quoteTable(table)
+		i := strings.Index(q, from)
+		if i < 0 {
+			return "", ErrHint
+		}
+		i += len(from)
+		q = fmt.Sprintf("%s %s (%s)%s", q[:i], ih.kind, strings.Join(quoteIdents(ih.names), ","), q[i:])
+	}
+
+	if len(hints) > 0 {
+		q = "SELECT /*+ " + strings.Join(hints, " ") + " */ " + strings.TrimPrefix(q, "SELECT ")
+	}
+
+	return q, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+)
+
+// BeforeCreator is implemented by entities to run code before they are created
+type BeforeCreator interface {
+	BeforeCreate(ctx context.Context) error
+}
+
+// AfterCreator is implemented by entities to run code after they were created
+type AfterCreator interface {
+	AfterCreate(ctx context.Context) error
+}
+
+// BeforeUpdater is implemented by entities to run code before they are updated
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterUpdater is implemented by entities to run code after they were updated
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleter is implemented by entities to run code before they are deleted
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleter is implemented by entities to run code after they were deleted
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// hookStage names the point of a write at which a hook runs
+type hookStage int
+
+// Hook stages
+const (
+	hookBeforeCreate hookStage = iota
+	hookAfterCreate
+	hookBeforeUpdate
+	hookAfterUpdate
+	hookBeforeDelete
+	hookAfterDelete
+)
+
+// runHook calls the hook of entity for given stage if it implements one. An
+// error returned by a before hook aborts the write.
+func runHook(ctx context.Context, stage hookStage, dest interface{}) error {
+
+	var fn func(context.Context) error
+
+	switch stage {
+	case hookBeforeCreate:
+		if h, ok := dest.(BeforeCreator); ok {
+			fn = h.BeforeCreate
+		}
+	case hookAfterCreate:
+		if h, ok := dest.(AfterCreator); ok {
+			fn = h.AfterCreate
+		}
+	case hookBeforeUpdate:
+		if h, ok := dest.(BeforeUpdater); ok {
+			fn = h.BeforeUpdate
+		}
+	case hookAfterUpdate:
+		if h, ok := dest.(AfterUpdater); ok {
+			fn = h.AfterUpdate
+		}
+	case hookBeforeDelete:
+		if h, ok := dest.(BeforeDeleter); ok {
+			fn = h.BeforeDelete
+		}
+	case hookAfterDelete:
+		if h, ok := dest.(AfterDeleter); ok {
+			fn = h.AfterDelete
+		}
+	}
+
+	if fn == nil {
+		return nil
+	}
+
+	return fn(ctx)
+}
+
+// runHooks calls the hooks of all given entities for given stage
+func runHooks(ctx context.Context, stage hookStage, elems []interface{}) error {
+	for _, e := range elems {
+		if err := runHook(ctx, stage, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// Primary key generators selectable by tag
+const (
+	genUUID = "uuid"
+	genULID = "ulid"
+)
+
+// IDGenerator generates primary keys for new entities on Create
+type IDGenerator interface {
+	NewID() (interface{}, error)
+}
+
+// IDGeneratorFunc adapts a function to an IDGenerator
+type IDGeneratorFunc func() (interface{}, error)
+
+// NewID implements IDGenerator
+func (f IDGeneratorFunc) NewID() (interface{}, error) {
+	return f()
+}
+
+// WithIDGenerator sets the generator filling empty primary keys on Create.
+// Keys tagged uuid or ulid use their own generator.
+func WithIDGenerator(gen IDGenerator) Option {
+	return func(g *Gateway) error {
+		g.idgen = gen
+		return nil
+	}
+}
+
+// crockford is the alphabet used to encode ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// generateID fills an empty primary key of dest with a generated value
+func (g *Gateway) generateID(dest interface{}, destcfg *tabMeta) error {
+
+	if len(destcfg.PrimaryNames) != 1 {
+		return nil
+	}
+
+	f := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.PrimaryIdx[0])
+	if !f.IsZero() {
+		return nil
+	}
+
+	var raw [16]byte
+	var str string
+	var err error
+
+	switch destcfg.Generate {
+	case genUUID:
+		raw, str, err = newUUID()
+	case genULID:
+		raw, str, err = newULID()
+	default:
+		if g.idgen == nil {
+			return nil
+		}
+		id, err := g.idgen.NewID()
+		if err != nil {
+			return err
+		}
+		return setField(f, id)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Binary columns get the raw bytes, all others the string form
+	if f.Kind() == reflect.Array && f.Len() == 16 {
+		return setField(f, raw)
+	}
+
+	return setField(f, str)
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() ([16]byte, string, error) {
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return b, "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return b, fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// newULID returns a ULID made of the current time and random bits
+func newULID() ([16]byte, string, error) {
+
+	var b [16]byte
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(b[:6], ts[2:])
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		return b, "", err
+	}
+
+	n := new(big.Int).SetBytes(b[:])
+	m := new(big.Int)
+	base := big.NewInt(32)
+
+	s := make([]byte, 26)
+	for i := len(s) - 1; i >= 0; i-- {
+		n.DivMod(n, base, m)
+		s[i] = crockford[m.Int64()]
+	}
+
+	return b, string(s), nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Join describes a LEFT JOIN of another table. The gateways table is joined
+// by LocalKey = Table.ForeignKey and the given Columns of the joined table are
+// selected additionally. Their names must match db tags of the destination.
+type Join struct {
+	Table      string
+	LocalKey   string
+	ForeignKey string
+	Columns    []string
+}
+
+// SelectJoin works like Select but left joins the given tables. Unqualified
+// selector and ordering keys refer to the gateways table, use "table.column"
+// to address columns of a joined table.
+func (g *Gateway) SelectJoin(dest interface{}, joins []Join, params Condition, orderby Orderer) error {
+	return g.SelectJoinContext(context.Background(), dest, joins, params, orderby)
+}
+
+// SelectJoinContext is like SelectJoin but runs with given context
+func (g *Gateway) SelectJoinContext(ctx context.Context, dest interface{}, joins []Join, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	cols := []string{quoteTable(table) + ".*"}
+
+	//noinspection GoPreferNilSlice
+	clauses := []string{}
+
+	for _, j := range joins {
+		if !validTable(j.Table) || !validIdent(j.LocalKey, j.ForeignKey) || !validIdent(j.Columns...) {
+			return ErrIdentifier
+		}
+		// Prefixed or schema qualified tables keep their plain name as alias
+		from, ref := quoteTable(j.Table), quoteTable(j.Table)
+		if qt := g.qualify(j.Table); qt != j.Table {
+			parts := strings.Split(j.Table, ".")
+			ref = quoteTable(parts[len(parts)-1])
+			from = quoteTable(qt) + " AS " + ref
+		}
+		for _, c := range j.Columns {
+			cols = append(cols, fmt.Sprintf("%s.`%s`", ref, c))
+		}
+		clauses = append(clauses, fmt.Sprintf(
+			"LEFT JOIN %s ON %s.`%s` = %s.`%s`",
+			from,
+			quoteTable(table),
+			j.LocalKey,
+			ref,
+			j.ForeignKey,
+		))
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return err
+	}
+
+	var qerr error
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	where := ""
+	if params != nil {
+		where, args = params.condition(func(name string) string {
+			n, err := qualifyIdent(table, name)
+			if err != nil {
+				qerr = err
+			}
+			return n
+		})
+	}
+	if qerr != nil {
+		return qerr
+	}
+
+	if sc := g.softDeleteCol(dest); sc != "" {
+		del := fmt.Sprintf("%s.`%s` IS NULL", quoteTable(table), sc)
+		if where == "" {
+			where = del
+		} else {
+			where = "(" + where + ") AND " + del
+		}
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ","), quoteTable(table))
+	if len(clauses) > 0 {
+		q = q + " " + strings.Join(clauses, " ")
+	}
+
+	if where != "" {
+		q = q + " WHERE " + where
+	}
+
+	q = q + orderClause(orderby, func(name string) string {
+		if !strings.Contains(name, ".") {
+			return quoteTable(table) + "." + quoteColumn(name)
+		}
+		return quoteColumn(name)
+	})
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	err = g.selectRows(ctx, opSelect, table, dest, q, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// qualifyIdent quotes a "column", "table.column" or "schema.table.column"
+// name, prefixing plain columns with given table
+func qualifyIdent(table string, name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 3 || !validIdent(parts...) {
+		return "", ErrIdentifier
+	}
+	if len(parts) == 1 {
+		return quoteTable(table) + "." + quoteIdents(parts)[0], nil
+	}
+	return strings.Join(quoteIdents(parts), "."), nil
+}
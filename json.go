@@ -0,0 +1,73 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// jsonColumn encodes and decodes a field tagged with tgw:"json". It holds a
+// pointer to the field.
+type jsonColumn struct {
+	v interface{}
+}
+
+// Value implements driver.Valuer. Nil maps, slices and pointers are written
+// as NULL.
+func (j jsonColumn) Value() (driver.Value, error) {
+
+	f := reflect.ValueOf(j.v).Elem()
+	switch f.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if f.IsNil() {
+			return nil, nil
+		}
+	}
+
+	b, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner. The field is reset before decoding, NULL
+// leaves it at its zero value.
+func (j *jsonColumn) Scan(src interface{}) error {
+
+	var b []byte
+	switch s := src.(type) {
+	case nil:
+		f := reflect.ValueOf(j.v).Elem()
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	case []byte:
+		b = s
+	case string:
+		b = []byte(s)
+	default:
+		return fmt.Errorf("unsupported type %T for json column", src)
+	}
+
+	// Unmarshal merges into existing maps and structs, start from scratch
+	f := reflect.ValueOf(j.v).Elem()
+	f.Set(reflect.Zero(f.Type()))
+
+	return json.Unmarshal(b, j.v)
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql"
+	"reflect"
+	"time"
+)
+
+// timeType is the type of time.Time
+var timeType = reflect.TypeOf(time.Time{})
+
+// WithLocation converts all time.Time values written by the gateway, entity
+// fields as well as query arguments, to loc and the times it reads to loc as
+// well. Using time.UTC keeps columns without time zone like DATETIME free of
+// the local time of the writing service. Drivers have to read such columns in
+// the same location, like the MySQL driver does for its loc parameter
+// defaulting to UTC. Zero times are left alone.
+func WithLocation(loc *time.Location) Option {
+	return func(g *Gateway) error {
+		if loc == nil {
+			return ErrOption
+		}
+		g.loc = loc
+		return nil
+	}
+}
+
+// inLocation returns t in loc unless it is zero
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(loc)
+}
+
+// bindLocation converts the time arguments of a query to the location of the
+// gateway. Values are copied, the caller's entities are not changed.
+func (g *Gateway) bindLocation(args []interface{}) []interface{} {
+
+	if g.loc == nil {
+		return args
+	}
+
+	var out []interface{}
+	for i, a := range args {
+		var v interface{}
+		switch t := a.(type) {
+		case time.Time:
+			v = inLocation(t, g.loc)
+		case *time.Time:
+			if t == nil {
+				continue
+			}
+			lt := inLocation(*t, g.loc)
+			v = &lt
+		case sql.NullTime:
+			t.Time = inLocation(t.Time, g.loc)
+			v = t
+		default:
+			continue
+		}
+		if out == nil {
+			out = append([]interface{}{}, args...)
+		}
+		out[i] = v
+	}
+
+	if out == nil {
+		return args
+	}
+
+	return out
+}
+
+// localize converts the times read into dest to the location of the gateway.
+// Dest may point to a time, an entity or a slice of them.
+func (g *Gateway) localize(dest interface{}) {
+	if g.loc == nil || dest == nil {
+		return
+	}
+	localizeValue(reflect.ValueOf(dest), g.loc)
+}
+
+// localizeValue converts the times held by v to loc, descending into
+// pointers, slices and the column fields of structs
+func localizeValue(v reflect.Value, loc *time.Location) {
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case v.Type() == timeType:
+		if v.CanSet() {
+			v.Set(reflect.ValueOf(inLocation(v.Interface().(time.Time), loc)))
+		}
+	case v.Type() == reflect.TypeOf(sql.NullTime{}):
+		localizeValue(v.Field(0), loc)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		for i := 0; i < v.Len(); i++ {
+			localizeValue(v.Index(i), loc)
+		}
+	case v.Kind() == reflect.Struct:
+		m, err := structMeta(v.Type())
+		if err != nil {
+			return
+		}
+		for col, idx := range m.Fields {
+			// Json columns keep the times they were encoded with
+			if !inArray(col, m.JSONCols) {
+				localizeValue(v.FieldByIndex(idx), loc)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import "context"
+
+// LockMode selects the row lock taken by reading queries
+type LockMode int
+
+// Lock modes
+const (
+	LockNone LockMode = iota
+	LockForUpdate
+	LockForShare
+)
+
+// Lock returns a copy of the gateway locking all rows read by Read, ReadMany,
+// Select, SelectOne and queries until the end of the transaction it runs in.
+// Locking reads always use the primary. SQLite locks the whole database on
+// writes and ignores the mode.
+func (g *Gateway) Lock(mode LockMode) *Gateway {
+	lg := *g
+	lg.lock = mode
+	if mode != LockNone {
+		lg.replicas = nil
+	}
+	return &lg
+}
+
+// ReadForUpdate reads entity like Read and locks its row for update
+func (g *Gateway) ReadForUpdate(dest interface{}) error {
+	return g.ReadForUpdateContext(context.Background(), dest)
+}
+
+// ReadForUpdateContext is like ReadForUpdate but runs with given context
+func (g *Gateway) ReadForUpdateContext(ctx context.Context, dest interface{}) error {
+	return g.Lock(LockForUpdate).ReadContext(ctx, dest)
+}
+
+// lockClause returns the locking clause of the gateways lock mode, including a
+// leading space
+func (g *Gateway) lockClause() string {
+
+	if g.lock == LockNone || g.dialect.Name() == "sqlite" {
+		return ""
+	}
+
+	if g.lock == LockForShare {
+		if g.dialect.Name() == "mysql" {
+			return " LOCK IN SHARE MODE"
+		}
+		return " FOR SHARE"
+	}
+
+	return " FOR UPDATE"
+}
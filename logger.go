@@ -0,0 +1,84 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Logger receives every statement a gateway sends to the database, with the
+// final sql in the gateways dialect, its arguments in order of their
+// placeholders, the duration and the resulting error. The op is one of
+// create, read, update, delete, select or count. Implementations must be safe
+// for concurrent use.
+type Logger interface {
+	LogQuery(ctx context.Context, op, table, query string, args []interface{}, d time.Duration, err error)
+}
+
+// LoggerFunc adapts a function to a Logger
+type LoggerFunc func(ctx context.Context, op, table, query string, args []interface{}, d time.Duration, err error)
+
+// LogQuery implements Logger
+func (f LoggerFunc) LogQuery(ctx context.Context, op, table, query string, args []interface{}, d time.Duration, err error) {
+	f(ctx, op, table, query, args, d, err)
+}
+
+// WithLogger sets the logger receiving all statements
+func WithLogger(l Logger) Option {
+	return func(g *Gateway) error {
+		g.logger = l
+		return nil
+	}
+}
+
+// SetLogger sets the logger receiving all statements, nil disables logging.
+// It must not be called while the gateway is in use, copies made before by
+// ForTenant, BindTx and the like keep their logger.
+func (g *Gateway) SetLogger(l Logger) {
+	g.logger = l
+}
+
+// WithSlowQueryThreshold reports every statement taking at least d to l,
+// which logs with the standard logger if nil
+func WithSlowQueryThreshold(d time.Duration, l Logger) Option {
+	return func(g *Gateway) error {
+		if d <= 0 {
+			return ErrOption
+		}
+		if l == nil {
+			l = LoggerFunc(logSlowQuery)
+		}
+		g.slow = d
+		g.slowLog = l
+		return nil
+	}
+}
+
+// logSlowQuery logs a slow statement with the standard logger
+func logSlowQuery(_ context.Context, op, table, query string, args []interface{}, d time.Duration, err error) {
+	log.Printf("tgw: slow %s on %s took %s: %s %v (error: %v)", op, table, d, query, args, err)
+}
+
+// logging checks if statements have to be reported to a logger
+func (g *Gateway) logging() bool {
+	return g.logger != nil
+}
+
+// log reports a finished statement to the logger
+func (g *Gateway) log(ctx context.Context, op, table, q string, args []interface{}, start time.Time, err *error) {
+	g.logger.LogQuery(ctx, op, table, q, args, time.Since(start), *err)
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SelectMaps selects all rows of the gateways table matching params as maps of
+// column names to values, for tables without a struct. Byte slices of the
+// driver are returned as strings. Without an entity soft deleted rows are
+// included and encrypted columns are not decrypted.
+func (g *Gateway) SelectMaps(params Condition, orderby Orderer) ([]map[string]interface{}, error) {
+	return g.SelectMapsContext(context.Background(), params, orderby)
+}
+
+// SelectMapsContext is like SelectMaps but runs with given context
+func (g *Gateway) SelectMapsContext(ctx context.Context, params Condition, orderby Orderer) ([]map[string]interface{}, error) {
+	return g.selectMaps(ctx, params, orderby, 0)
+}
+
+// ReadMap reads the first row of the gateways table matching params as a map
+// like SelectMaps. It returns an error matching ErrNotFound if there is none.
+func (g *Gateway) ReadMap(params Condition) (map[string]interface{}, error) {
+	return g.ReadMapContext(context.Background(), params)
+}
+
+// ReadMapContext is like ReadMap but runs with given context
+func (g *Gateway) ReadMapContext(ctx context.Context, params Condition) (map[string]interface{}, error) {
+
+	rows, err := g.selectMaps(ctx, params, nil, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return nil, notFound(sql.ErrNoRows)
+	}
+
+	return rows[0], nil
+}
+
+// selectMaps selects up to limit rows matching params as maps, all of them if
+// limit is zero
+func (g *Gateway) selectMaps(ctx context.Context, params Condition, orderby Orderer, limit int) (res []map[string]interface{}, err error) {
+
+	if err := checkOrder(orderby, nil); err != nil {
+		return nil, err
+	}
+	if err := checkCondition(params, nil); err != nil {
+		return nil, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf("SELECT * FROM %s", quoteTable(table)) + where + orderClause(orderby, quoteColumn)
+	if limit > 0 {
+		q = q + g.dialect.Limit(limit, 0)
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	rows, err := g.queryRows(ctx, opSelect, table, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	//noinspection GoPreferNilSlice
+	res = []map[string]interface{}{}
+
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+		for col, v := range row {
+			row[col] = g.mapValue(v)
+		}
+		res = append(res, row)
+	}
+
+	return res, rows.Err()
+}
+
+// mapValue normalizes the driver value v of a map row
+func (g *Gateway) mapValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case time.Time:
+		if g.loc != nil {
+			return inLocation(x, g.loc)
+		}
+	}
+	return v
+}
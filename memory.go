@@ -0,0 +1,1283 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// compile time check of the implementation
+var _ Gatewayer = (*MemGateway)(nil)
+
+// MemGateway is an in-memory Gatewayer for tests without a database. It
+// honors the primary, noauto, uuid, ulid, insert, update, softdelete,
+// created, updated and version tags as well as hooks. Conditions may be built
+// from Selectors, NullCheck, And and Or, raw sql and expressions fail with
+// ErrUnsupported. LIKE matches case insensitive.
+type MemGateway struct {
+	g      *Gateway
+	mu     sync.Mutex
+	tables map[string]*memTable
+}
+
+// memTable holds the rows of a table in insertion order
+type memTable struct {
+	rows   []memRow
+	nextID int64
+}
+
+// memRow maps the columns of a row to their values
+type memRow map[string]interface{}
+
+// NewMemGateway returns an empty MemGateway. The table may be left empty like
+// for NewGateway. Of the options only WithSoftDeleteColumn and WithDeleteAll
+// have an effect.
+func NewMemGateway(table string, opts ...Option) (*MemGateway, error) {
+
+	m := &MemGateway{
+		g:      &Gateway{table: table},
+		tables: map[string]*memTable{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(m.g); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// Create writes entity to memory
+func (m *MemGateway) Create(dest interface{}) error {
+	return m.CreateContext(context.Background(), dest)
+}
+
+// CreateContext is like Create but runs with given context
+func (m *MemGateway) CreateContext(ctx context.Context, dest interface{}) error {
+	return m.insert(ctx, dest, insertPlain)
+}
+
+// CreateMany writes all entities of the slice dest points to, chunkSize is
+// ignored
+func (m *MemGateway) CreateMany(dest interface{}, chunkSize int) error {
+	return m.CreateManyContext(context.Background(), dest, chunkSize)
+}
+
+// CreateManyContext is like CreateMany but runs with given context
+func (m *MemGateway) CreateManyContext(ctx context.Context, dest interface{}, _ int) error {
+	for _, e := range sliceElems(dest) {
+		if err := m.insert(ctx, e, insertPlain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Upsert writes entity or replaces the update columns of the stored entity
+// with the same primary key
+func (m *MemGateway) Upsert(dest interface{}) error {
+	return m.UpsertContext(context.Background(), dest)
+}
+
+// UpsertContext is like Upsert but runs with given context
+func (m *MemGateway) UpsertContext(ctx context.Context, dest interface{}) error {
+	_, err := m.insertWith(ctx, dest, insertUpsert)
+	return err
+}
+
+// CreateIgnore writes entity unless an entity with the same primary key is
+// stored and reports whether it was written
+func (m *MemGateway) CreateIgnore(dest interface{}) (bool, error) {
+	return m.CreateIgnoreContext(context.Background(), dest)
+}
+
+// CreateIgnoreContext is like CreateIgnore but runs with given context
+func (m *MemGateway) CreateIgnoreContext(ctx context.Context, dest interface{}) (bool, error) {
+	return m.insertWith(ctx, dest, insertIgnore)
+}
+
+// Replace writes entity, replacing all insert columns of the stored entity
+// with the same primary key
+func (m *MemGateway) Replace(dest interface{}) (bool, error) {
+	return m.ReplaceContext(context.Background(), dest)
+}
+
+// ReplaceContext is like Replace but runs with given context
+func (m *MemGateway) ReplaceContext(ctx context.Context, dest interface{}) (bool, error) {
+	return m.insertWith(ctx, dest, insertReplace)
+}
+
+// insert stores entity, failing with ErrDuplicate for existing keys
+func (m *MemGateway) insert(ctx context.Context, dest interface{}, mode insertMode) error {
+	_, err := m.insertWith(ctx, dest, mode)
+	return err
+}
+
+// insertWith stores entity handling existing keys according to mode and
+// reports whether it was written
+func (m *MemGateway) insertWith(ctx context.Context, dest interface{}, mode insertMode) (bool, error) {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return false, err
+	}
+
+	if err := runHook(ctx, hookBeforeCreate, dest); err != nil {
+		return false, err
+	}
+
+	if err := m.g.generateID(dest, destcfg); err != nil {
+		return false, err
+	}
+
+	if err := setDefaults(dest, destcfg); err != nil {
+		return false, err
+	}
+
+	if err := m.g.validate(ctx, dest); err != nil {
+		return false, err
+	}
+
+	written, err := m.store(table, dest, destcfg, mode)
+	if err != nil || !written {
+		return written, err
+	}
+
+	return true, runHook(ctx, hookAfterCreate, dest)
+}
+
+// store writes entity to table handling existing keys according to mode
+func (m *MemGateway) store(table string, dest interface{}, destcfg *tabMeta, mode insertMode) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+	r := reflect.ValueOf(dest).Elem()
+
+	cols, auto := insertCols(dest, destcfg)
+	if auto {
+		t.nextID++
+		if err := setField(r.FieldByIndex(destcfg.PrimaryIdx[0]), t.nextID); err != nil {
+			return false, err
+		}
+		cols = append(append([]string{}, destcfg.PrimaryDBs...), cols...)
+	} else if len(destcfg.PrimaryDBs) == 1 {
+		if v, ok := memValue(getPriVals(dest, destcfg)[0]).(int64); ok && v > t.nextID {
+			t.nextID = v
+		}
+	}
+
+	if i := t.find(getPriVals(dest, destcfg), destcfg); i >= 0 {
+		switch mode {
+		case insertIgnore:
+			return false, nil
+		case insertUpsert:
+			m.g.stamp(dest, destcfg, false)
+			if err := m.write(t.rows[i], dest, destcfg, updateCols(destcfg)); err != nil {
+				return false, err
+			}
+			return true, nil
+		case insertReplace:
+			m.g.stamp(dest, destcfg, true)
+			t.rows[i] = memRow{}
+			if err := m.write(t.rows[i], dest, destcfg, cols); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		return false, ErrDuplicate
+	}
+
+	m.g.stamp(dest, destcfg, true)
+
+	row := memRow{}
+	if err := m.write(row, dest, destcfg, cols); err != nil {
+		return false, err
+	}
+	t.rows = append(t.rows, row)
+
+	return true, nil
+}
+
+// Read reads entity with given primary key from memory
+func (m *MemGateway) Read(dest interface{}) error {
+	return m.ReadContext(context.Background(), dest)
+}
+
+// ReadContext is like Read but runs with given context
+func (m *MemGateway) ReadContext(_ context.Context, dest interface{}) error {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+	i := t.find(getPriVals(dest, destcfg), destcfg)
+	if i < 0 || deleted(t.rows[i], destcfg) {
+		return notFoundError{}
+	}
+
+	m.read(t.rows[i], reflect.ValueOf(dest).Elem(), destcfg)
+
+	return nil
+}
+
+// ReadMany reads all entities with given primary keys into the slice dest
+// points to
+func (m *MemGateway) ReadMany(dest interface{}, ids []interface{}) error {
+	return m.ReadManyContext(context.Background(), dest, ids)
+}
+
+// ReadManyContext is like ReadMany but runs with given context
+func (m *MemGateway) ReadManyContext(_ context.Context, dest interface{}, ids []interface{}) error {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	//noinspection GoPreferNilSlice
+	rows := []memRow{}
+	for _, row := range m.table(table).rows {
+		if deleted(row, destcfg) {
+			continue
+		}
+		for _, id := range ids {
+			vals := []interface{}{id}
+			if len(destcfg.PrimaryDBs) > 1 {
+				v, ok := id.([]interface{})
+				if !ok || len(v) != len(destcfg.PrimaryDBs) {
+					return ErrPrimaryType
+				}
+				vals = v
+			}
+			if row.hasKey(vals, destcfg) {
+				rows = append(rows, row)
+				break
+			}
+		}
+	}
+
+	s := reflect.ValueOf(dest).Elem()
+	s.Set(reflect.MakeSlice(s.Type(), 0, len(rows)))
+	m.appendRows(s, rows, destcfg)
+
+	return nil
+}
+
+// ReadByIDs is like ReadMany taking the IDs as arguments
+func (m *MemGateway) ReadByIDs(dest interface{}, ids ...interface{}) error {
+	return m.ReadManyContext(context.Background(), dest, ids)
+}
+
+// ReadByIDsContext is like ReadByIDs but runs with given context
+func (m *MemGateway) ReadByIDsContext(ctx context.Context, dest interface{}, ids ...interface{}) error {
+	return m.ReadManyContext(ctx, dest, ids)
+}
+
+// Update writes the update columns of entity to memory
+func (m *MemGateway) Update(dest interface{}) error {
+	return m.UpdateContext(context.Background(), dest)
+}
+
+// UpdateContext is like Update but runs with given context
+func (m *MemGateway) UpdateContext(ctx context.Context, dest interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	return m.update(ctx, dest, updateSet(dest, destcfg))
+}
+
+// UpdatePartial writes only given columns of entity or all update columns
+// holding a non-zero value
+func (m *MemGateway) UpdatePartial(dest interface{}, cols ...string) error {
+	return m.UpdatePartialContext(context.Background(), dest, cols...)
+}
+
+// UpdatePartialContext is like UpdatePartial but runs with given context
+func (m *MemGateway) UpdatePartialContext(ctx context.Context, dest interface{}, cols ...string) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range cols {
+		if !inArray(col, destcfg.UpdateCols) || inArray(col, destcfg.PrimaryDBs) {
+			return ErrUnknownCol
+		}
+	}
+
+	set := partialCols(dest, destcfg, cols)
+	if len(set) == 0 {
+		return nil
+	}
+
+	return m.update(ctx, dest, set)
+}
+
+// UpdateColumns writes only given columns of entity, nothing without columns
+func (m *MemGateway) UpdateColumns(dest interface{}, cols ...string) error {
+	return m.UpdateColumnsContext(context.Background(), dest, cols...)
+}
+
+// UpdateColumnsContext is like UpdateColumns but runs with given context
+func (m *MemGateway) UpdateColumnsContext(ctx context.Context, dest interface{}, cols ...string) error {
+	if len(cols) == 0 {
+		return nil
+	}
+	return m.UpdatePartialContext(ctx, dest, cols...)
+}
+
+// Patch updates only the columns in changes of the entity with given primary
+// key. Expressions are not supported.
+func (m *MemGateway) Patch(dest interface{}, id interface{}, changes map[string]interface{}) error {
+	return m.PatchContext(context.Background(), dest, id, changes)
+}
+
+// PatchContext is like Patch but runs with given context
+func (m *MemGateway) PatchContext(_ context.Context, dest interface{}, id interface{}, changes map[string]interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := setPriVal(dest, destcfg, id); err != nil {
+		return err
+	}
+
+	cols, err := patchCols(destcfg, changes)
+	if err != nil || len(cols) == 0 {
+		return err
+	}
+
+	if err := checkPatchEnums(dest, destcfg, changes); err != nil {
+		return err
+	}
+
+	_, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+	i := t.find(getPriVals(dest, destcfg), destcfg)
+	if i < 0 {
+		return nil
+	}
+
+	// dest is filled from the stored row so changes convert to its field types
+	r := reflect.ValueOf(dest).Elem()
+	m.read(t.rows[i], r, destcfg)
+
+	for _, col := range cols {
+		f := r.FieldByIndex(destcfg.Fields[col])
+		switch v := changes[col].(type) {
+		case Expr, RawSQL:
+			return ErrUnsupported
+		case nil:
+			f.Set(reflect.Zero(f.Type()))
+		default:
+			if err := setField(f, v); err != nil {
+				return ErrUnsupported
+			}
+		}
+	}
+
+	if destcfg.Updated != "" && inArray(destcfg.Updated, destcfg.UpdateCols) && !inArray(destcfg.Updated, cols) {
+		m.g.stamp(dest, destcfg, false)
+		cols = append(cols, destcfg.Updated)
+	}
+
+	if destcfg.Version != "" && !inArray(destcfg.Version, cols) {
+		if err := checkVersion(driver.RowsAffected(1), dest, destcfg); err != nil {
+			return err
+		}
+		cols = append(cols, destcfg.Version)
+	}
+
+	return m.write(t.rows[i], dest, destcfg, cols)
+}
+
+// Increment adds delta to given numeric column of the stored entity, bumping
+// its version and setting the updated timestamp like Patch
+func (m *MemGateway) Increment(dest interface{}, column string, delta int64) error {
+	return m.IncrementContext(context.Background(), dest, column, delta)
+}
+
+// IncrementContext is like Increment but runs with given context
+func (m *MemGateway) IncrementContext(_ context.Context, dest interface{}, column string, delta int64) error {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := counterCol(destcfg, column); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+	i := t.find(getPriVals(dest, destcfg), destcfg)
+	if i < 0 {
+		return nil
+	}
+
+	if err := t.rows[i].add(dest, destcfg, column, delta); err != nil {
+		return err
+	}
+
+	if c := destcfg.Updated; c != "" && inArray(c, destcfg.UpdateCols) {
+		m.g.stamp(dest, destcfg, false)
+		t.rows[i][c] = reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[c]).Interface()
+	}
+
+	if c := destcfg.Version; c != "" {
+		return t.rows[i].add(dest, destcfg, c, 1)
+	}
+
+	return nil
+}
+
+// add adds delta to numeric column of row, typed like the field of dest
+func (row memRow) add(dest interface{}, destcfg *tabMeta, column string, delta int64) error {
+
+	v := reflect.New(reflect.TypeOf(dest).Elem().FieldByIndex(destcfg.Fields[column]).Type).Elem()
+	if old := row[column]; old != nil {
+		v.Set(reflect.ValueOf(old))
+	}
+
+	switch {
+	case isSigned(v.Kind()):
+		v.SetInt(v.Int() + delta)
+	case isInteger(v.Kind()):
+		v.SetUint(uint64(int64(v.Uint()) + delta))
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		v.SetFloat(v.Float() + float64(delta))
+	default:
+		return ErrUnsupported
+	}
+
+	row[column] = v.Interface()
+
+	return nil
+}
+
+// update writes given columns of entity, checking its version
+func (m *MemGateway) update(ctx context.Context, dest interface{}, cols []string) error {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := runHook(ctx, hookBeforeUpdate, dest); err != nil {
+		return err
+	}
+
+	if err := m.g.validate(ctx, dest); err != nil {
+		return err
+	}
+
+	found, err := m.modify(table, dest, destcfg, cols)
+	if err != nil || !found {
+		return err
+	}
+
+	return runHook(ctx, hookAfterUpdate, dest)
+}
+
+// modify writes given columns of entity and reports whether it was found
+func (m *MemGateway) modify(table string, dest interface{}, destcfg *tabMeta, cols []string) (bool, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+	i := t.find(getPriVals(dest, destcfg), destcfg)
+
+	r := reflect.ValueOf(dest).Elem()
+	if i >= 0 && destcfg.Version != "" {
+		if c, ok := memCompare(t.rows[i][destcfg.Version], r.FieldByIndex(destcfg.Fields[destcfg.Version]).Interface()); !ok || c != 0 {
+			i = -1
+		}
+	}
+
+	if i < 0 {
+		return false, checkVersion(driver.RowsAffected(0), dest, destcfg)
+	}
+
+	m.g.stamp(dest, destcfg, false)
+
+	if err := checkVersion(driver.RowsAffected(1), dest, destcfg); err != nil {
+		return false, err
+	}
+	if destcfg.Version != "" {
+		cols = append(append([]string{}, cols...), destcfg.Version)
+	}
+
+	if err := m.write(t.rows[i], dest, destcfg, cols); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Delete removes entity from memory or marks it deleted if it has a soft
+// delete column
+func (m *MemGateway) Delete(dest interface{}) error {
+	return m.DeleteContext(context.Background(), dest)
+}
+
+// DeleteContext is like Delete but runs with given context
+func (m *MemGateway) DeleteContext(ctx context.Context, dest interface{}) error {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := runHook(ctx, hookBeforeDelete, dest); err != nil {
+		return err
+	}
+
+	if !m.remove(table, dest, destcfg) {
+		return nil
+	}
+
+	return runHook(ctx, hookAfterDelete, dest)
+}
+
+// remove deletes or marks entity as deleted and reports whether it was found
+func (m *MemGateway) remove(table string, dest interface{}, destcfg *tabMeta) bool {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+	i := t.find(getPriVals(dest, destcfg), destcfg)
+	if i < 0 {
+		return false
+	}
+
+	if destcfg.SoftDelete != "" {
+		f := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[destcfg.SoftDelete])
+		setTime(f, time.Now())
+		t.rows[i][destcfg.SoftDelete] = f.Interface()
+	} else {
+		t.rows = append(t.rows[:i], t.rows[i+1:]...)
+	}
+
+	return true
+}
+
+// DeleteByIDs deletes or marks deleted all entities of the type dest refers
+// to with given IDs without running hooks
+func (m *MemGateway) DeleteByIDs(dest interface{}, ids ...interface{}) (int64, error) {
+	return m.DeleteByIDsContext(context.Background(), dest, ids...)
+}
+
+// DeleteByIDsContext is like DeleteByIDs but runs with given context
+func (m *MemGateway) DeleteByIDsContext(_ context.Context, dest interface{}, ids ...interface{}) (int64, error) {
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+
+	var n int64
+	for _, id := range ids {
+		vals := []interface{}{id}
+		if len(destcfg.PrimaryDBs) > 1 {
+			v, ok := id.([]interface{})
+			if !ok || len(v) != len(destcfg.PrimaryDBs) {
+				return n, ErrPrimaryType
+			}
+			vals = v
+		}
+		i := t.find(vals, destcfg)
+		if i < 0 || deleted(t.rows[i], destcfg) {
+			continue
+		}
+		if destcfg.SoftDelete != "" {
+			f := reflect.New(baseType(reflect.TypeOf(dest))).Elem().FieldByIndex(destcfg.Fields[destcfg.SoftDelete])
+			setTime(f, time.Now())
+			t.rows[i][destcfg.SoftDelete] = f.Interface()
+		} else {
+			t.rows = append(t.rows[:i], t.rows[i+1:]...)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// Select appends all entities matching params in given order to the slice
+// dest points to
+func (m *MemGateway) Select(dest interface{}, params Condition, orderby Orderer) error {
+	return m.SelectContext(context.Background(), dest, params, orderby)
+}
+
+// SelectContext is like Select but runs with given context
+func (m *MemGateway) SelectContext(_ context.Context, dest interface{}, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows, err := m.match(table, params, orderby, destcfg)
+	if err != nil {
+		return err
+	}
+
+	m.appendRows(reflect.ValueOf(dest).Elem(), rows, destcfg)
+
+	return nil
+}
+
+// SelectOne reads the first entity matching params in given order into dest
+// and returns an error matching ErrNotFound if there is none
+func (m *MemGateway) SelectOne(dest interface{}, params Condition, orderby Orderer) error {
+	return m.SelectOneContext(context.Background(), dest, params, orderby)
+}
+
+// SelectOneContext is like SelectOne but runs with given context
+func (m *MemGateway) SelectOneContext(_ context.Context, dest interface{}, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	destcfg, table, err := m.meta(dest)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows, err := m.match(table, params, orderby, destcfg)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return notFoundError{}
+	}
+
+	m.read(rows[0], reflect.ValueOf(dest).Elem(), destcfg)
+
+	return nil
+}
+
+// Count returns the number of rows of the gateways table matching params,
+// skipping soft deleted rows, see WithSoftDeleteColumn
+func (m *MemGateway) Count(params Condition) (int64, error) {
+	return m.CountContext(context.Background(), params)
+}
+
+// CountContext is like Count but runs with given context
+func (m *MemGateway) CountContext(_ context.Context, params Condition) (int64, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return 0, err
+	}
+
+	table, err := m.g.defaultTable()
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows, err := m.match(table, params, nil, m.softMeta())
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(rows)), nil
+}
+
+// Exists checks if any row of the gateways table matches params
+func (m *MemGateway) Exists(params Condition) (bool, error) {
+	return m.ExistsContext(context.Background(), params)
+}
+
+// ExistsContext is like Exists but runs with given context
+func (m *MemGateway) ExistsContext(ctx context.Context, params Condition) (bool, error) {
+	n, err := m.CountContext(ctx, params)
+	return n > 0, err
+}
+
+// DeleteWhere deletes all rows of the gateways table matching params and
+// returns their number. Rows are marked deleted if the gateway has a soft
+// delete column, see WithSoftDeleteColumn. Empty params fail with
+// ErrNotAllowed unless the gateway was created WithDeleteAll.
+func (m *MemGateway) DeleteWhere(params Condition) (int64, error) {
+	return m.DeleteWhereContext(context.Background(), params)
+}
+
+// DeleteWhereContext is like DeleteWhere but runs with given context
+func (m *MemGateway) DeleteWhereContext(_ context.Context, params Condition) (int64, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return 0, err
+	}
+
+	if err := m.g.allRows(params); err != nil {
+		return 0, err
+	}
+
+	table, err := m.g.defaultTable()
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.table(table)
+
+	if softcfg := m.softMeta(); softcfg.SoftDelete != "" {
+		rows, err := m.match(table, params, nil, softcfg)
+		if err != nil {
+			return 0, err
+		}
+		for _, row := range rows {
+			markDeleted(row, softcfg.SoftDelete, time.Now())
+		}
+		return int64(len(rows)), nil
+	}
+
+	//noinspection GoPreferNilSlice
+	keep := []memRow{}
+	for _, row := range t.rows {
+		ok, err := matchRow(row, params)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			keep = append(keep, row)
+		}
+	}
+
+	n := int64(len(t.rows) - len(keep))
+	t.rows = keep
+
+	return n, nil
+}
+
+// meta returns the tag informations and table of entity
+func (m *MemGateway) meta(dest interface{}) (*tabMeta, string, error) {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	table, err := m.g.tableName(dest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return destcfg, table, nil
+}
+
+// softMeta returns the metadata naming only the soft delete column of the
+// gateways table, see WithSoftDeleteColumn
+func (m *MemGateway) softMeta() *tabMeta {
+	return &tabMeta{SoftDelete: m.g.softCol}
+}
+
+// table returns the rows of table, creating it on first use. The caller must
+// hold the lock.
+func (m *MemGateway) table(name string) *memTable {
+	t, ok := m.tables[name]
+	if !ok {
+		t = &memTable{}
+		m.tables[name] = t
+	}
+	return t
+}
+
+// match returns the rows of table not soft deleted matching params in given
+// order. Soft deletes are only known for entities, destcfg may be nil.
+func (m *MemGateway) match(table string, params Condition, orderby Orderer, destcfg *tabMeta) ([]memRow, error) {
+
+	//noinspection GoPreferNilSlice
+	rows := []memRow{}
+	for _, row := range m.table(table).rows {
+		if destcfg != nil && deleted(row, destcfg) {
+			continue
+		}
+		ok, err := matchRow(row, params)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+
+	sorts, err := memSorts(orderby)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return lessRow(rows[i], rows[j], sorts)
+	})
+
+	return rows, nil
+}
+
+// write copies given columns of entity into row. Json columns are stored
+// encoded so the entity does not share maps or slices with the row.
+func (m *MemGateway) write(row memRow, dest interface{}, destcfg *tabMeta, cols []string) error {
+	r := reflect.ValueOf(dest).Elem()
+	for _, col := range cols {
+		idx, ok := destcfg.Fields[col]
+		if !ok {
+			continue
+		}
+		if inArray(col, destcfg.JSONCols) {
+			v, err := jsonColumn{v: r.FieldByIndex(idx).Addr().Interface()}.Value()
+			if err != nil {
+				return err
+			}
+			row[col] = v
+			continue
+		}
+		row[col] = r.FieldByIndex(idx).Interface()
+	}
+	return nil
+}
+
+// read fills entity r from row, columns never written are zeroed
+func (m *MemGateway) read(row memRow, r reflect.Value, destcfg *tabMeta) {
+	for col, idx := range destcfg.Fields {
+		f := r.FieldByIndex(idx)
+		v, ok := row[col]
+		if !ok || v == nil {
+			f.Set(reflect.Zero(f.Type()))
+			continue
+		}
+		if inArray(col, destcfg.JSONCols) {
+			// Stored values were encoded by write and decode again
+			_ = (&jsonColumn{v: f.Addr().Interface()}).Scan(v)
+			continue
+		}
+		f.Set(reflect.ValueOf(v))
+	}
+}
+
+// appendRows appends entities read from rows to slice s
+func (m *MemGateway) appendRows(s reflect.Value, rows []memRow, destcfg *tabMeta) {
+
+	et := s.Type().Elem()
+	ptr := et.Kind() == reflect.Ptr
+	if ptr {
+		et = et.Elem()
+	}
+
+	for _, row := range rows {
+		e := reflect.New(et)
+		m.read(row, e.Elem(), destcfg)
+		if ptr {
+			s.Set(reflect.Append(s, e))
+		} else {
+			s.Set(reflect.Append(s, e.Elem()))
+		}
+	}
+}
+
+// find returns the index of the row with given primary key values or -1
+func (t *memTable) find(vals []interface{}, destcfg *tabMeta) int {
+	for i, row := range t.rows {
+		if row.hasKey(vals, destcfg) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasKey checks if row has given primary key values
+func (row memRow) hasKey(vals []interface{}, destcfg *tabMeta) bool {
+	for i, col := range destcfg.PrimaryDBs {
+		if c, ok := memCompare(row[col], vals[i]); !ok || c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// markDeleted sets soft delete column col of row to t, keeping the type of the
+// value stored for the entity
+func markDeleted(row memRow, col string, t time.Time) {
+	if old := row[col]; old != nil {
+		f := reflect.New(reflect.TypeOf(old)).Elem()
+		setTime(f, t)
+		row[col] = f.Interface()
+		return
+	}
+	row[col] = t
+}
+
+// deleted checks if row is marked as soft deleted
+func deleted(row memRow, destcfg *tabMeta) bool {
+	return destcfg.SoftDelete != "" && memValue(row[destcfg.SoftDelete]) != nil
+}
+
+// matchRow evaluates condition c on row
+func matchRow(row memRow, c Condition) (bool, error) {
+
+	switch c := c.(type) {
+	case nil:
+		return true, nil
+	case Selectors:
+		for k, v := range c {
+			ok, err := matchSelector(row, k, v)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case and:
+		for _, sub := range c {
+			ok, err := matchRow(row, sub)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case or:
+		for _, sub := range c {
+			if sub == nil {
+				return true, nil
+			}
+			ok, err := matchRow(row, sub)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case grouped:
+		return matchRow(row, c.c)
+	case RawSQL:
+		if c.SQL == "" {
+			return true, nil
+		}
+	}
+
+	return false, ErrUnsupported
+}
+
+// matchSelector evaluates a single selector on row with SQL semantics, NULL
+// values never compare
+func matchSelector(row memRow, k string, v interface{}) (bool, error) {
+
+	name, op := splitSelector(k)
+	have := memValue(row[name])
+
+	if n, ok := nullCheck(op, v); ok {
+		return (have == nil) == bool(n), nil
+	}
+
+	switch v.(type) {
+	case Expr, RawSQL:
+		return false, ErrUnsupported
+	}
+
+	switch op {
+	case "IN", "NOT IN":
+		in := false
+		l := reflect.ValueOf(v)
+		if l.Kind() != reflect.Slice && l.Kind() != reflect.Array {
+			return false, ErrUnsupported
+		}
+		if l.Len() == 0 {
+			return op == "NOT IN", nil
+		}
+		for i := 0; i < l.Len(); i++ {
+			if c, ok := memCompare(have, l.Index(i).Interface()); ok && c == 0 {
+				in = true
+			}
+		}
+		if have == nil {
+			return false, nil
+		}
+		return in == (op == "IN"), nil
+	case "LIKE", "NOT LIKE":
+		s, ok := have.(string)
+		p, pok := memValue(v).(string)
+		if !ok || !pok {
+			return false, nil
+		}
+		return likeRegexp(p).MatchString(s) == (op == "LIKE"), nil
+	}
+
+	c, ok := memCompare(have, v)
+	if !ok {
+		return false, nil
+	}
+
+	switch op {
+	case "!=", "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+
+	return c == 0, nil
+}
+
+// likeRegexp translates a LIKE pattern escaped with likeEscape
+func likeRegexp(p string) *regexp.Regexp {
+
+	var b strings.Builder
+	b.WriteString("(?is)^")
+
+	esc := false
+	for _, r := range p {
+		switch {
+		case esc:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			esc = false
+		case string(r) == likeEscape:
+			esc = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.MustCompile(b.String())
+}
+
+// memSorts converts an Orderer into its sorts
+func memSorts(orderby Orderer) (Sorts, error) {
+
+	switch o := orderby.(type) {
+	case nil:
+		return nil, nil
+	case Sorts:
+		return o, nil
+	case OrderBy:
+		//noinspection GoPreferNilSlice
+		keys := []string{}
+		for k := range o {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		//noinspection GoPreferNilSlice
+		sorts := Sorts{}
+		for _, k := range keys {
+			sorts = append(sorts, Sort{Column: k, Desc: strings.EqualFold(o[k], "DESC")})
+		}
+		return sorts, nil
+	}
+
+	return nil, ErrUnsupported
+}
+
+// lessRow orders rows by sorts, NULL values sort first unless placed
+// explicitly
+func lessRow(a, b memRow, sorts Sorts) bool {
+
+	for _, s := range sorts {
+
+		x, y := memValue(a[s.Column]), memValue(b[s.Column])
+		if s.Lower {
+			if xs, ok := x.(string); ok {
+				x = strings.ToLower(xs)
+			}
+			if ys, ok := y.(string); ok {
+				y = strings.ToLower(ys)
+			}
+		}
+
+		if (x == nil) != (y == nil) {
+			// NULL first by default and for NullsFirst, ignoring direction
+			if s.Nulls == NullsDefault {
+				return (x == nil) != s.Desc
+			}
+			return (x == nil) == (s.Nulls == NullsFirst)
+		}
+
+		c, ok := memCompare(x, y)
+		if !ok || c == 0 {
+			continue
+		}
+
+		return (c < 0) != s.Desc
+	}
+
+	return false
+}
+
+// memValue normalizes a stored or compared value to nil, int64, float64,
+// string, bool or time.Time where possible
+func memValue(v interface{}) interface{} {
+
+	if dv, ok := v.(driver.Valuer); ok {
+		if x, err := dv.Value(); err == nil {
+			v = x
+		}
+	}
+
+	r := reflect.ValueOf(v)
+	for r.Kind() == reflect.Ptr {
+		if r.IsNil() {
+			return nil
+		}
+		r = r.Elem()
+	}
+
+	if !r.IsValid() {
+		return nil
+	}
+
+	switch {
+	case isSigned(r.Kind()):
+		return r.Int()
+	case isInteger(r.Kind()):
+		return int64(r.Uint())
+	case r.Kind() == reflect.Float32 || r.Kind() == reflect.Float64:
+		return r.Float()
+	case r.Kind() == reflect.String:
+		return r.String()
+	case r.Kind() == reflect.Bool:
+		return r.Bool()
+	case r.Kind() == reflect.Slice && r.Type().Elem().Kind() == reflect.Uint8:
+		return string(r.Bytes())
+	}
+
+	return r.Interface()
+}
+
+// memCompare compares two values, reporting false if they are not comparable
+// or NULL
+func memCompare(a, b interface{}) (int, bool) {
+
+	a, b = memValue(a), memValue(b)
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	// Mixed integers and floats compare as floats
+	if x, ok := a.(int64); ok {
+		if _, ok := b.(float64); ok {
+			a = float64(x)
+		}
+	}
+	if y, ok := b.(int64); ok {
+		if _, ok := a.(float64); ok {
+			b = float64(y)
+		}
+	}
+
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return cmpOrdered(x < y, x > y), true
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmpOrdered(x < y, x > y), true
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return cmpOrdered(!x && y, x && !y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return cmpOrdered(x.Before(y), x.After(y)), true
+		}
+	}
+
+	return 0, false
+}
+
+// cmpOrdered turns the results of less and greater into -1, 0 or 1
+func cmpOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,229 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testPerson is an entity with a nullable column
+type testPerson struct {
+	ID   uint64  `db:"id" tgw:"primary"`
+	Name *string `db:"name" tgw:"insert,update"`
+	Age  int     `db:"age" tgw:"insert,update"`
+}
+
+// testPeople creates the table of testPerson
+const testPeople = "CREATE TABLE people (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, age INTEGER)"
+
+// testPersons returns the people both gateways of TestMemGatewayParity hold
+func testPersons() []testPerson {
+	name := func(s string) *string { return &s }
+	return []testPerson{
+		{Name: name("anna"), Age: 3},
+		{Name: name("Bob"), Age: 5},
+		{Name: nil, Age: 7},
+		{Name: name("bea"), Age: 5},
+	}
+}
+
+// TestMemGatewayParity checks that MemGateway selects the same rows in the
+// same order as a database
+func TestMemGatewayParity(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		params  Condition
+		orderby Orderer
+	}{
+		{"all", nil, nil},
+		{"equal", Selectors{"age": 5}, nil},
+		{"greater", Selectors{"age >": 3}, nil},
+		{"less or equal", Selectors{"age <=": 5}, nil},
+		{"not equal null", Selectors{"name !=": "anna"}, nil},
+		{"in", Selectors{"age IN": []int{3, 7}}, nil},
+		{"empty in", Selectors{"age IN": []int{}}, nil},
+		{"empty not in", Selectors{"age NOT IN": []int{}}, nil},
+		{"not in", Selectors{"age NOT IN": []int{3}}, nil},
+		{"is null", Selectors{"name": IsNull}, nil},
+		{"nil", Selectors{"name": nil}, nil},
+		{"is not null", Selectors{"name": IsNotNull}, nil},
+		{"like", Selectors{"name LIKE": "b%"}, nil},
+		{"not like", Selectors{"name NOT LIKE": "b%"}, nil},
+		{"or", Or(Selectors{"age": 3}, Selectors{"name": IsNull}), nil},
+		{"and", And(Selectors{"age": 5}, Selectors{"name LIKE": "%e%"}), nil},
+		{"nested", Or(And(Selectors{"age >": 3}, Selectors{"name LIKE": "b%"}), Selectors{"id": 1}), nil},
+		{"order", nil, OrderBy{"age": "DESC", "id": "ASC"}},
+		{"order by sorts", Selectors{"age >=": 5}, Sorts{{Column: "age", Desc: true}, {Column: "name"}}},
+	}
+
+	db := testDB(t, testPeople)
+	g := testGateway(t, db, "people")
+	m, err := NewMemGateway("people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range testPersons() {
+		mp := p
+		testCreate(t, g, &p)
+		testCreate(t, m, &mp)
+	}
+
+	ids := func(ps []testPerson) string {
+		var s []uint64
+		for _, p := range ps {
+			s = append(s, p.ID)
+		}
+		return fmt.Sprint(s)
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var want, got []testPerson
+			if err := g.Select(&want, tc.params, tc.orderby); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Select(&got, tc.params, tc.orderby); err != nil {
+				t.Fatal(err)
+			}
+			if ids(got) != ids(want) {
+				t.Errorf("MemGateway selected %s, database %s", ids(got), ids(want))
+			}
+			wn, _ := g.Count(tc.params)
+			if n, err := m.Count(tc.params); err != nil || n != wn {
+				t.Errorf("Count() = %d, %v, database %d", n, err, wn)
+			}
+		})
+	}
+}
+
+// TestMemGatewayErrors checks the errors MemGateway reports like a Gateway
+func TestMemGatewayErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts []Option
+		op   func(m *MemGateway) error
+		err  error
+	}{
+		{"duplicate", nil, func(m *MemGateway) error {
+			return m.Create(&testUser{ID: 1})
+		}, ErrDuplicate},
+		{"read missing", nil, func(m *MemGateway) error {
+			return m.Read(&testUser{ID: 9})
+		}, sql.ErrNoRows},
+		{"select one missing", nil, func(m *MemGateway) error {
+			return m.SelectOne(&testUser{}, Selectors{"name": "x"}, nil)
+		}, ErrNotFound},
+		{"unknown column", nil, func(m *MemGateway) error {
+			var users []testUser
+			return m.Select(&users, Selectors{"nope": 1}, nil)
+		}, ErrUnknownCol},
+		{"raw", nil, func(m *MemGateway) error {
+			var users []testUser
+			return m.Select(&users, Raw("age = 1"), nil)
+		}, ErrUnsupported},
+		{"expression", nil, func(m *MemGateway) error {
+			var users []testUser
+			return m.Select(&users, Selectors{"age": Expr("age + 1")}, nil)
+		}, ErrUnsupported},
+		{"delete all", nil, func(m *MemGateway) error {
+			_, err := m.DeleteWhere(nil)
+			return err
+		}, ErrNotAllowed},
+		{"delete all empty", nil, func(m *MemGateway) error {
+			_, err := m.DeleteWhere(Selectors{})
+			return err
+		}, ErrNotAllowed},
+		{"delete all allowed", []Option{WithDeleteAll()}, func(m *MemGateway) error {
+			if n, err := m.DeleteWhere(nil); err != nil || n != 1 {
+				return fmt.Errorf("deleted %d: %v", n, err)
+			}
+			return nil
+		}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewMemGateway("users", tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			testCreate(t, m, &testUser{Name: "a"})
+			if err := tc.op(m); !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+// TestMemGatewayVersion checks optimistic locking of MemGateway
+func TestMemGatewayVersion(t *testing.T) {
+
+	m, err := NewMemGateway("versioned")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := testVersioned{Name: "a"}
+	testCreate(t, m, &v)
+	stale := v
+
+	v.Name = "b"
+	if err := m.Update(&v); err != nil || v.Version != 1 {
+		t.Fatalf("Update() = %v, version %d, want 1", err, v.Version)
+	}
+	if err := m.Update(&stale); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("stale Update() = %v, want ErrStaleObject", err)
+	}
+}
+
+// TestMemGatewaySoftDelete checks that MemGateway marks rows deleted and
+// skips them like a Gateway
+func TestMemGatewaySoftDelete(t *testing.T) {
+
+	m, err := NewMemGateway("soft", WithSoftDeleteColumn("deleted_at"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		testCreate(t, m, &testSoft{Grp: "a", Score: i})
+	}
+
+	s := testSoft{ID: 1}
+	if err := m.Delete(&s); err != nil || s.DeletedAt == nil {
+		t.Fatalf("Delete() = %v, marker %v", err, s.DeletedAt)
+	}
+	if err := m.Read(&testSoft{ID: 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read() of deleted = %v, want ErrNotFound", err)
+	}
+	if n, err := m.DeleteByIDs(&testSoft{}, 1, 2); err != nil || n != 1 {
+		t.Errorf("DeleteByIDs() = %d, %v, want 1", n, err)
+	}
+	if n, err := m.DeleteWhere(Selectors{"grp": "a"}); err != nil || n != 1 {
+		t.Errorf("DeleteWhere() = %d, %v, want 1", n, err)
+	}
+
+	var all []testSoft
+	if err := m.Select(&all, nil, nil); err != nil || len(all) != 0 {
+		t.Errorf("Select() = %v, %+v, want none", err, all)
+	}
+	if n, err := m.Count(nil); err != nil || n != 0 {
+		t.Errorf("Count() = %d, %v, want 0", n, err)
+	}
+}
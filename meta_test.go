@@ -0,0 +1,60 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// benchMeta is a typical entity with the common tag options
+type benchMeta struct {
+	ID      uint64            `db:"id" tgw:"primary"`
+	Name    string            `db:"name" tgw:"insert,update"`
+	Email   string            `db:"email" tgw:"insert,update,omitempty"`
+	Attrs   map[string]string `db:"attrs" tgw:"insert,update,json"`
+	Version int64             `db:"version" tgw:"insert,update,version"`
+	Created time.Time         `db:"created" tgw:"insert,created"`
+	Updated time.Time         `db:"updated" tgw:"insert,update,updated"`
+}
+
+// BenchmarkParseMeta compares reading the metadata of an entity from the
+// cache with parsing its tags on every call
+func BenchmarkParseMeta(b *testing.B) {
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := parseMeta(&benchMeta{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		e := reflect.TypeOf(benchMeta{})
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := parseStruct(e); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// NameMapper maps the name of a struct field without db tag to its column
+type NameMapper func(field string) string
+
+// nameMapper is the NameMapper set by SetNameMapper
+var (
+	mapperMu   sync.RWMutex
+	nameMapper NameMapper
+)
+
+// SetNameMapper maps exported struct fields without db tag to the columns
+// named by m, like SnakeCase mapping CreatedAt to created_at. Tagged fields
+// keep their tag, db:"-" still excludes a field and relation fields are never
+// mapped. Nil restores the default of ignoring untagged fields. The mapper is
+// used for all gateways and should be set once on start up.
+func SetNameMapper(m NameMapper) {
+
+	mapperMu.Lock()
+	nameMapper = m
+	mapperMu.Unlock()
+
+	// Parsed structs may have been mapped differently
+	metaCache.Range(func(k, _ interface{}) bool {
+		metaCache.Delete(k)
+		return true
+	})
+}
+
+// SnakeCase is a NameMapper converting names like UserID to user_id
+func SnakeCase(field string) string {
+	return snakeCase(field)
+}
+
+// mappedName returns the column of struct field f without db tag according
+// to the NameMapper or an empty string if it is not mapped
+func mappedName(f reflect.StructField, ops []string) string {
+
+	mapperMu.RLock()
+	m := nameMapper
+	mapperMu.RUnlock()
+
+	if m == nil || f.PkgPath != "" || tagValue(ops, tgwHasMany) != "" || tagValue(ops, tgwBelongsTo) != "" {
+		return ""
+	}
+
+	return m(f.Name)
+}
+
+// snakeCase converts a Go name like HTTPLogEntry to http_log_entry
+func snakeCase(name string) string {
+
+	r := []rune(name)
+
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) {
+			// Start a new word at a lower to upper change and before the
+			// last upper case letter of an acronym
+			if i > 0 && (unicode.IsLower(r[i-1]) || unicode.IsDigit(r[i-1]) ||
+				(i+1 < len(r) && unicode.IsLower(r[i+1]) && unicode.IsUpper(r[i-1]))) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// pluralSnake returns the snake cased plural of a Go type name using simple
+// english rules, so Category maps to categories and Address to addresses
+func pluralSnake(name string) string {
+
+	n := snakeCase(name)
+
+	switch {
+	case n == "":
+		return ""
+	case strings.HasSuffix(n, "y") && len(n) > 1 && !strings.ContainsAny(n[len(n)-2:len(n)-1], "aeiou"):
+		return n[:len(n)-1] + "ies"
+	case strings.HasSuffix(n, "s"), strings.HasSuffix(n, "x"), strings.HasSuffix(n, "z"),
+		strings.HasSuffix(n, "ch"), strings.HasSuffix(n, "sh"):
+		return n + "es"
+	}
+
+	return n + "s"
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"time"
+)
+
+// Observer receives a report for every query run by a gateway, e.g. to feed
+// counters and latency histograms. The op is one of create, read, update,
+// delete, select or count. Implementations must be safe for concurrent use.
+type Observer interface {
+	ObserveQuery(op string, table string, d time.Duration, err error)
+}
+
+// WithObserver sets the observer reporting all queries to
+func WithObserver(o Observer) Option {
+	return func(g *Gateway) error {
+		g.observer = o
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Option configures a Gateway on construction
+type Option func(*Gateway) error
+
+// WithTimeout limits the duration of every single query run by the gateway.
+// A zero duration means no limit. On MySQL the limit is also passed to the
+// server for SELECT statements, see Timeout for limits of single calls.
+func WithTimeout(d time.Duration) Option {
+	return func(g *Gateway) error {
+		if d < 0 {
+			return ErrOption
+		}
+		g.timeout = d
+		return nil
+	}
+}
+
+// WithTablePrefix prepends prefix to the name of every table, so users becomes
+// app_users with prefix "app_"
+func WithTablePrefix(prefix string) Option {
+	return func(g *Gateway) error {
+		if prefix != "" && !validIdent(prefix) {
+			return ErrOption
+		}
+		g.prefix = prefix
+		return nil
+	}
+}
+
+// WithSchema qualifies every table not naming a schema itself with schema, so
+// users becomes tenant_1.users with schema "tenant_1"
+func WithSchema(schema string) Option {
+	return func(g *Gateway) error {
+		if schema != "" && !validIdent(schema) {
+			return ErrOption
+		}
+		g.schema = schema
+		return nil
+	}
+}
+
+// WithAffectedCheck makes Update, Delete and their variants return an error
+// matching ErrNotFound if no row was affected. Note that MySQL does not count
+// rows whose values did not change unless the client sets CLIENT_FOUND_ROWS.
+func WithAffectedCheck() Option {
+	return func(g *Gateway) error {
+		g.affected = true
+		return nil
+	}
+}
+
+// checkAffected reports a missing row if configured and no row was affected
+func (g *Gateway) checkAffected(res sql.Result) error {
+
+	if !g.affected {
+		return nil
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return notFoundError{}
+	}
+
+	return nil
+}
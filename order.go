@@ -0,0 +1,173 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Orderer provides the ORDER BY terms of a query. It is implemented by
+// OrderBy and Sorts.
+type Orderer interface {
+	orderTerms(col func(string) string) []string
+}
+
+// Nulls controls where NULL values are placed when ordering
+type Nulls int
+
+// Placement of NULL values
+const (
+	NullsDefault Nulls = iota
+	NullsFirst
+	NullsLast
+)
+
+// Sort is a single ORDER BY term. Lower orders case insensitive by comparing
+// LOWER(Column) and Nulls places NULL values explicitly.
+type Sort struct {
+	Column string
+	Desc   bool
+	Lower  bool
+	Nulls  Nulls
+}
+
+// Sorts orders by its terms in the given order
+type Sorts []Sort
+
+// Asc returns an ascending Sort on column
+func Asc(column string) Sort {
+	return Sort{Column: column}
+}
+
+// Desc returns a descending Sort on column
+func Desc(column string) Sort {
+	return Sort{Column: column, Desc: true}
+}
+
+// orderTerms implements Orderer
+func (o OrderBy) orderTerms(col func(string) string) []string {
+
+	//noinspection GoPreferNilSlice
+	keys := []string{}
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	//noinspection GoPreferNilSlice
+	obs := []string{}
+	for _, k := range keys {
+		obs = append(obs, col(k)+" "+o[k])
+	}
+
+	return obs
+}
+
+// orderTerms implements Orderer
+func (s Sorts) orderTerms(col func(string) string) []string {
+
+	//noinspection GoPreferNilSlice
+	obs := []string{}
+	for _, o := range s {
+
+		c := col(o.Column)
+		if o.Lower {
+			c = "LOWER(" + c + ")"
+		}
+
+		// Emulated by sorting on IS NULL, as not all databases support
+		// NULLS FIRST and NULLS LAST
+		switch o.Nulls {
+		case NullsFirst:
+			obs = append(obs, col(o.Column)+" IS NULL DESC")
+		case NullsLast:
+			obs = append(obs, col(o.Column)+" IS NULL ASC")
+		}
+
+		if o.Desc {
+			obs = append(obs, c+" DESC")
+		} else {
+			obs = append(obs, c+" ASC")
+		}
+	}
+
+	return obs
+}
+
+// orderClause builds the ORDER BY part of a query, col renders column names
+func orderClause(orderby Orderer, col func(string) string) string {
+
+	if orderby == nil {
+		return ""
+	}
+
+	obs := orderby.orderTerms(col)
+	if len(obs) == 0 {
+		return ""
+	}
+
+	return " ORDER BY " + strings.Join(obs, ",")
+}
+
+// OrderError reports ordering by an unknown column or in an invalid
+// direction. It matches ErrOrder.
+type OrderError struct {
+	Column    string
+	Direction string
+}
+
+// Error implements error
+func (e OrderError) Error() string {
+	return fmt.Sprintf("invalid ordering by %q %q", e.Column, e.Direction)
+}
+
+// Is makes OrderError match ErrOrder
+func (e OrderError) Is(target error) bool { return target == ErrOrder }
+
+// checkOrder validates the terms of orderby, which may come from untrusted
+// input. Directions have to be ASC or DESC and columns plain identifiers,
+// unqualified columns also db tags of dest if it is a struct or a slice of
+// them. Qualified "table.column" names refer to joined tables and are not
+// checked against dest.
+func checkOrder(orderby Orderer, dest interface{}) error {
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+
+	switch o := orderby.(type) {
+	case OrderBy:
+		for col, dir := range o {
+			if d := strings.ToUpper(dir); d != "ASC" && d != "DESC" {
+				return OrderError{Column: col, Direction: dir}
+			}
+			cols = append(cols, col)
+		}
+	case Sorts:
+		for _, s := range o {
+			cols = append(cols, s.Column)
+		}
+	}
+
+	m := destMeta(dest)
+	for _, col := range cols {
+		if knownColumn(col, m) != nil {
+			return OrderError{Column: col}
+		}
+	}
+
+	return nil
+}
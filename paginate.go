@@ -0,0 +1,174 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+)
+
+// SelectPage selects at most limit rows matching params into dest, skipping
+// the first offset rows. Use Paginate to also get the total number of rows.
+func (g *Gateway) SelectPage(dest interface{}, params Condition, orderby Orderer, limit, offset int) error {
+	return g.SelectPageContext(context.Background(), dest, params, orderby, limit, offset)
+}
+
+// SelectPageContext is like SelectPage but runs with given context
+func (g *Gateway) SelectPageContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer, limit, offset int) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	if limit < 1 || offset < 0 {
+		return ErrPage
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return err
+	}
+
+	q, args := buildSelect(table, nil, params, orderby, g.softDeleteCol(dest))
+	q = q + g.dialect.Limit(limit, offset)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return g.selectRows(ctx, opSelect, table, dest, q, args...)
+}
+
+// SelectAfter selects at most limit rows into dest whose cursorColumn is past
+// cursorValue, ordered by cursorColumn. Rows are walked descending if desc is
+// set. A nil cursorValue selects the first rows. Unlike offsets this stays
+// fast on large tables, pass the cursorColumn value of the last row to get
+// the next rows. The values of cursorColumn have to be unique, rows sharing
+// the value of the last row of a page are skipped otherwise.
+func (g *Gateway) SelectAfter(dest interface{}, cursorColumn string, cursorValue interface{}, limit int, desc bool) error {
+	return g.SelectAfterContext(context.Background(), dest, cursorColumn, cursorValue, limit, desc)
+}
+
+// SelectAfterContext is like SelectAfter but runs with given context
+func (g *Gateway) SelectAfterContext(ctx context.Context, dest interface{}, cursorColumn string, cursorValue interface{}, limit int, desc bool) error {
+
+	if !validIdent(cursorColumn) {
+		return ErrIdentifier
+	}
+	if err := knownColumn(cursorColumn, destMeta(dest)); err != nil {
+		return err
+	}
+
+	if limit < 1 {
+		return ErrPage
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	op := ">"
+	if desc {
+		op = "<"
+	}
+
+	var cursor Condition
+	if cursorValue != nil {
+		cursor = Selectors{cursorColumn + " " + op: cursorValue}
+	}
+
+	cursor, err = g.scopeFor(cursor, dest)
+	if err != nil {
+		return err
+	}
+
+	where, args := whereClause(cursor)
+
+	q := fmt.Sprintf("SELECT * FROM %s", quoteTable(table)) +
+		withoutDeleted(where, g.softDeleteCol(dest)) +
+		orderClause(Sorts{{Column: cursorColumn, Desc: desc}}, quoteColumn) +
+		g.dialect.Limit(limit, 0)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return g.selectRows(ctx, opSelect, table, dest, q, args...)
+}
+
+// Paginate selects page number page (starting at 1) of perPage rows into dest
+// and returns the total number of rows matching params. Both are read by
+// separate queries, so concurrent writes may make them disagree unless the
+// gateway is bound to a transaction.
+func (g *Gateway) Paginate(dest interface{}, params Condition, orderby Orderer, page, perPage int) (int64, error) {
+	return g.PaginateContext(context.Background(), dest, params, orderby, page, perPage)
+}
+
+// PaginateContext is like Paginate but runs with given context
+func (g *Gateway) PaginateContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer, page, perPage int) (int64, error) {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return 0, err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return 0, err
+	}
+
+	if page < 1 || perPage < 1 {
+		return 0, ErrPage
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return 0, err
+	}
+
+	params, err = g.scopeFor(params, dest)
+	if err != nil {
+		return 0, err
+	}
+
+	softcol := g.softDeleteCol(dest)
+
+	where, cargs := whereClause(params)
+	count := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteTable(table)) + withoutDeleted(where, softcol)
+
+	q, args := buildSelect(table, nil, params, orderby, softcol)
+	q = q + g.dialect.Limit(perPage, (page-1)*perPage)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	// Read both from the same replica
+	rg, done := g.route(opSelect)
+	defer done()
+
+	var total int64
+	if err := rg.get(ctx, opCount, table, &total, count, cargs...); err != nil {
+		return 0, err
+	}
+	if err := rg.selectRows(ctx, opSelect, table, dest, q, args...); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Patch updates only the columns in changes of the entity with given primary
+// key, like for a PATCH request. Columns must be update columns of dest, which
+// is a pointer to an entity of the gateways type and gets the key set. Values
+// may be an Expr or Raw to compute them in sql. The updated column is stamped
+// and the version incremented but not checked.
+func (g *Gateway) Patch(dest interface{}, id interface{}, changes map[string]interface{}) error {
+	return g.PatchContext(context.Background(), dest, id, changes)
+}
+
+// PatchContext is like Patch but runs with given context
+func (g *Gateway) PatchContext(ctx context.Context, dest interface{}, id interface{}, changes map[string]interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := setPriVal(dest, destcfg, id); err != nil {
+		return err
+	}
+
+	if g.audit != "" {
+		return g.audited(ctx, AuditUpdate, dest, func(ag *Gateway) error {
+			return ag.PatchContext(ctx, dest, id, changes)
+		})
+	}
+
+	cols, err := patchCols(destcfg, changes)
+	if err != nil || len(cols) == 0 {
+		return err
+	}
+
+	if err := checkPatchEnums(dest, destcfg, changes); err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	destcfg = g.stamp(dest, destcfg, false)
+
+	//noinspection GoPreferNilSlice
+	assigns := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, col := range cols {
+		v, vargs := valueSQL(changes[col])
+		if inArray(col, destcfg.Encrypted) && v == "?" {
+			vargs = []interface{}{cipherColumn{v: &vargs[0]}}
+		} else if inArray(col, destcfg.JSONCols) && v == "?" {
+			vargs = []interface{}{jsonColumn{v: &vargs[0]}}
+		}
+		assigns = append(assigns, fmt.Sprintf("`%s` = %s", col, v))
+		args = append(args, vargs...)
+	}
+
+	if c := destcfg.Updated; c != "" && inArray(c, destcfg.UpdateCols) && !inArray(c, cols) {
+		if inArray(c, destcfg.NowCols) {
+			assigns = append(assigns, fmt.Sprintf("`%s` = %s", c, serverNow))
+		} else {
+			assigns = append(assigns, fmt.Sprintf("`%s` = ?", c))
+			args = append(args, reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[c]).Interface())
+		}
+	}
+
+	if c := destcfg.Version; c != "" && !inArray(c, cols) {
+		assigns = append(assigns, fmt.Sprintf("`%s` = `%s` + 1", c, c))
+	}
+
+	q := fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s",
+		quoteTable(table),
+		strings.Join(assigns, ","),
+		strings.Join(quoteSelectSet(destcfg.PrimaryDBs), " AND "),
+	)
+
+	q, args, err = g.scoped(q, append(args, getPriVals(dest, destcfg)...), destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opUpdate, table, q, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	g.changed(opUpdate, dest)
+
+	return nil
+}
+
+// patchCols returns the sorted columns of changes, which all have to be
+// update columns other than the primary key
+func patchCols(destcfg *tabMeta, changes map[string]interface{}) ([]string, error) {
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	for col := range changes {
+		if !inArray(col, destcfg.UpdateCols) || inArray(col, destcfg.PrimaryDBs) {
+			return nil, ErrUnknownCol
+		}
+		cols = append(cols, col)
+	}
+
+	// Stable order keeps queries cacheable as prepared statements
+	sort.Strings(cols)
+
+	return cols, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"strings"
+)
+
+// Query is a chainable query on the table of a gateway. Every method returns
+// a modified copy, so a Query can be reused as base for several queries.
+type Query struct {
+	g        *Gateway
+	conds    []Condition
+	cols     []string
+	distinct bool
+	orderby  Orderer
+	limit    int
+	offset   int
+}
+
+// Query starts a new chainable query
+func (g *Gateway) Query() *Query {
+	return &Query{g: g, limit: -1}
+}
+
+// Where adds a condition, all conditions of a query have to match
+func (q *Query) Where(cond Condition) *Query {
+	c := *q
+	c.conds = append(q.conds[:len(q.conds):len(q.conds)], cond)
+	return &c
+}
+
+// Columns restricts the query to given columns instead of all
+func (q *Query) Columns(cols ...string) *Query {
+	c := *q
+	c.cols = cols
+	return &c
+}
+
+// Distinct removes duplicate rows from the result, usually combined with
+// Columns
+func (q *Query) Distinct() *Query {
+	c := *q
+	c.distinct = true
+	return &c
+}
+
+// OrderBy sets the ordering of the query
+func (q *Query) OrderBy(orderby Orderer) *Query {
+	c := *q
+	c.orderby = orderby
+	return &c
+}
+
+// Limit sets the maximum number of rows, a negative limit means no limit
+func (q *Query) Limit(limit int) *Query {
+	c := *q
+	c.limit = limit
+	return &c
+}
+
+// Offset sets the number of rows to skip
+func (q *Query) Offset(offset int) *Query {
+	c := *q
+	c.offset = offset
+	return &c
+}
+
+// All selects all matching rows into the slice dest points to
+func (q *Query) All(dest interface{}) error {
+	return q.AllContext(context.Background(), dest)
+}
+
+// AllContext is like All but runs with given context
+func (q *Query) AllContext(ctx context.Context, dest interface{}) error {
+
+	if err := checkColumns(dest, q.cols); err != nil {
+		return err
+	}
+
+	table, err := q.g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	s, args, err := q.build(table, dest)
+	if err != nil {
+		return err
+	}
+	s = s + q.limitClause(q.limit) + q.g.lockClause()
+
+	ctx, cancel := q.g.context(ctx)
+	defer cancel()
+
+	if err := q.g.selectRows(ctx, opSelect, table, dest, s, args...); err != nil {
+		return err
+	}
+
+	return q.g.preloadAll(ctx, dest)
+}
+
+// One reads the first matching row into dest and returns an error matching
+// ErrNotFound if there is none
+func (q *Query) One(dest interface{}) error {
+	return q.OneContext(context.Background(), dest)
+}
+
+// OneContext is like One but runs with given context
+func (q *Query) OneContext(ctx context.Context, dest interface{}) error {
+
+	if err := checkColumns(dest, q.cols); err != nil {
+		return err
+	}
+
+	table, err := q.g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	s, args, err := q.build(table, dest)
+	if err != nil {
+		return err
+	}
+	s = s + q.limitClause(1) + q.g.lockClause()
+
+	ctx, cancel := q.g.context(ctx)
+	defer cancel()
+
+	if err := q.g.get(ctx, opRead, table, dest, s, args...); err != nil {
+		return notFound(err)
+	}
+
+	return q.g.preloadAll(ctx, dest)
+}
+
+// Count returns the number of matching rows of the gateways table, ignoring
+// columns, distinct, ordering, limit and offset
+func (q *Query) Count() (int64, error) {
+	return q.CountContext(context.Background())
+}
+
+// CountContext is like Count but runs with given context
+func (q *Query) CountContext(ctx context.Context) (int64, error) {
+	return q.g.CountContext(ctx, And(q.conds...))
+}
+
+// build builds the SELECT statement of the query without limit
+func (q *Query) build(table string, dest interface{}) (string, []interface{}, error) {
+	if err := checkOrder(q.orderby, dest); err != nil {
+		return "", nil, err
+	}
+	if err := checkCondition(And(q.conds...), dest); err != nil {
+		return "", nil, err
+	}
+	params, err := q.g.scopeFor(And(q.conds...), dest)
+	if err != nil {
+		return "", nil, err
+	}
+	s, args := buildSelect(table, q.cols, params, q.orderby, q.g.softDeleteCol(dest))
+	if q.distinct {
+		s = "SELECT DISTINCT " + strings.TrimPrefix(s, "SELECT ")
+	}
+	return s, args, nil
+}
+
+// limitClause renders given limit and the offset of the query
+func (q *Query) limitClause(limit int) string {
+	if limit < 0 && q.offset <= 0 {
+		return ""
+	}
+	return q.g.dialect.Limit(limit, q.offset)
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// WithReadOnly rejects every statement of the gateway changing data or
+// schema with ErrReadOnly, for gateways over views or analytics replicas.
+// Transactions may still be started for consistent reads.
+func WithReadOnly() Option {
+	return func(g *Gateway) error {
+		g.readOnly = true
+		return nil
+	}
+}
+
+// NewReadOnlyGateway returns a read-only gateway for table, see WithReadOnly,
+// exposing only the reading methods of the Reader interface
+func NewReadOnlyGateway(dbconn sqlx.ExtContext, table string, opts ...Option) (Reader, error) {
+	return NewGateway(dbconn, table, append(append([]Option{}, opts...), WithReadOnly())...)
+}
+
+// writable returns ErrReadOnly for statements of operations other than reads
+// on read-only gateways
+func (g *Gateway) writable(op string) error {
+	if g.readOnly && op != opRead && op != opSelect && op != opCount {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestReadOnly checks that read-only gateways refuse every write before it
+// reaches the database
+func TestReadOnly(t *testing.T) {
+
+	tests := []struct {
+		name string
+		op   func(g *Gateway) error
+	}{
+		{"create", func(g *Gateway) error {
+			return g.Create(&testUser{Name: "b"})
+		}},
+		{"create many", func(g *Gateway) error {
+			return g.CreateMany(&[]testUser{{Name: "b"}}, 0)
+		}},
+		{"upsert", func(g *Gateway) error {
+			return g.Upsert(&testUser{ID: 1, Name: "b"})
+		}},
+		{"update", func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "b"})
+		}},
+		{"update partial", func(g *Gateway) error {
+			return g.UpdatePartial(&testUser{ID: 1, Name: "b"}, "name")
+		}},
+		{"update many", func(g *Gateway) error {
+			return g.UpdateMany(&[]testUser{{ID: 1, Name: "b"}}, BatchAbort)
+		}},
+		{"update where", func(g *Gateway) error {
+			_, err := g.UpdateWhere(map[string]interface{}{"name": "b"}, Selectors{"id": 1})
+			return err
+		}},
+		{"increment", func(g *Gateway) error {
+			return g.Increment(&testUser{ID: 1}, "age", 1)
+		}},
+		{"delete", func(g *Gateway) error {
+			return g.Delete(&testUser{ID: 1})
+		}},
+		{"delete where", func(g *Gateway) error {
+			_, err := g.DeleteWhere(Selectors{"id": 1})
+			return err
+		}},
+		{"delete by ids", func(g *Gateway) error {
+			_, err := g.DeleteByIDs(&testUser{}, 1)
+			return err
+		}},
+		{"truncate", func(g *Gateway) error {
+			return g.Truncate()
+		}},
+		{"create table", func(g *Gateway) error {
+			return g.CreateTable(&testUser{})
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &testConn{DB: testDB(t, testUsers)}
+			testCreate(t, testGateway(t, c, "users"), &testUser{Name: "a"})
+			n := c.count()
+
+			g := testGateway(t, c, "users", WithReadOnly(), WithDeleteAll())
+			if err := tc.op(g); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("err = %v, want ErrReadOnly", err)
+			}
+			if c.count() != n {
+				t.Errorf("%d statements reached the database", c.count()-n)
+			}
+			if got := testCount(t, c.DB, "users", "id = 1 AND name = 'a' AND age = 0"); got != 1 {
+				t.Error("the row was changed")
+			}
+		})
+	}
+}
+
+// TestReadOnlyReads checks that read-only gateways still read, also within
+// transactions
+func TestReadOnlyReads(t *testing.T) {
+
+	db := testDB(t, testUsers)
+	testCreate(t, testGateway(t, db, "users"), &testUser{Name: "a"})
+
+	r, err := NewReadOnlyGateway(db, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Read(&testUser{ID: 1}); err != nil {
+		t.Errorf("Read() = %v", err)
+	}
+	if n, err := r.Count(nil); err != nil || n != 1 {
+		t.Errorf("Count() = %d, %v, want 1", n, err)
+	}
+
+	err = r.(*Gateway).WithTx(func(txg *Gateway) error {
+		var users []testUser
+		if err := txg.Select(&users, nil, nil); err != nil || len(users) != 1 {
+			t.Errorf("Select() = %v, %+v", err, users)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
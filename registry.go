@@ -0,0 +1,118 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"sync"
+)
+
+// Registry holds one gateway per entity type, so the application shares their
+// prepared statements and parsed metadata instead of creating gateways ad hoc.
+// It is safe for concurrent use.
+type Registry struct {
+	dbconn sqlx.ExtContext
+	opts   []Option
+	mu     sync.RWMutex
+	gws    map[reflect.Type]*Gateway
+}
+
+// NewRegistry returns an empty Registry creating its gateways on dbconn with
+// given options
+func NewRegistry(dbconn sqlx.ExtContext, opts ...Option) *Registry {
+	return &Registry{
+		dbconn: dbconn,
+		opts:   opts,
+		gws:    map[reflect.Type]*Gateway{},
+	}
+}
+
+// Register creates the gateway of the entity type dest refers to on table,
+// applying opts after the options of the registry. An empty table is resolved
+// like by NewGatewayFor. The soft delete column of the entity applies to
+// reads not bound to it, see WithSoftDeleteColumn. Registering a type twice
+// fails with ErrRegistered.
+func (r *Registry) Register(dest interface{}, table string, opts ...Option) error {
+
+	if dest == nil {
+		return ErrStructConfig
+	}
+
+	t := baseType(reflect.TypeOf(dest))
+	if _, err := structMeta(t); err != nil {
+		return err
+	}
+
+	opts = append(append([]Option{}, r.opts...), opts...)
+
+	var g *Gateway
+	var err error
+	if table == "" {
+		g, err = NewGatewayFor(r.dbconn, dest, opts...)
+	} else {
+		g, err = NewGateway(r.dbconn, table, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	g.defaultSoftDelete(dest)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.gws[t]; ok {
+		return ErrRegistered
+	}
+
+	r.gws[t] = g
+
+	return nil
+}
+
+// For returns the gateway registered for the entity type dest refers to, which
+// may be a struct, a pointer or a slice of them, or ErrUnregistered
+func (r *Registry) For(dest interface{}) (*Gateway, error) {
+
+	if dest == nil {
+		return nil, ErrUnregistered
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	g, ok := r.gws[baseType(reflect.TypeOf(dest))]
+	if !ok {
+		return nil, ErrUnregistered
+	}
+
+	return g, nil
+}
+
+// Close releases the prepared statements of all registered gateways
+func (r *Registry) Close() error {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var err error
+	for _, g := range r.gws {
+		if cerr := g.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
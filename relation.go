@@ -0,0 +1,312 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Relation tags. A has many field is a slice of child entities whose fk
+// column refers to the primary key of the parent, a belongs to field holds
+// the entity the fk column of its own table refers to:
+//
+//	Orders []Order `tgw:"hasmany=orders,fk=user_id"`
+//	User   *User   `tgw:"belongsto=users,fk=user_id"`
+const (
+	tgwHasMany   = "hasmany="
+	tgwBelongsTo = "belongsto="
+	tgwFK        = "fk="
+)
+
+// relation describes a relation field of an entity
+type relation struct {
+	field   reflect.StructField
+	table   string
+	fk      string
+	hasMany bool
+}
+
+// Preload returns a copy of the gateway loading given relation fields with
+// Read, ReadMany, Select and Query. Each relation is loaded by a single IN
+// query for all read entities.
+func (g *Gateway) Preload(relations ...string) *Gateway {
+	pg := *g
+	pg.preload = append(append([]string{}, g.preload...), relations...)
+	return &pg
+}
+
+// preloadAll loads the configured relations of the entities in dest
+func (g *Gateway) preloadAll(ctx context.Context, dest interface{}) error {
+
+	if len(g.preload) == 0 {
+		return nil
+	}
+
+	ents := entityValues(reflect.ValueOf(dest))
+	if len(ents) == 0 {
+		return nil
+	}
+
+	for _, name := range g.preload {
+		rel, err := parseRelation(ents[0].Type(), name)
+		if err != nil {
+			return err
+		}
+		if rel.hasMany {
+			err = g.loadHasMany(ctx, ents, rel)
+		} else {
+			err = g.loadBelongsTo(ctx, ents, rel)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseRelation reads the relation tags of field name of entity type t
+func parseRelation(t reflect.Type, name string) (*relation, error) {
+
+	f, ok := t.FieldByName(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRelation, name)
+	}
+
+	ops := strings.Split(f.Tag.Get(tagTGW), ",")
+	rel := &relation{field: f, fk: tagValue(ops, tgwFK)}
+
+	if rel.table = tagValue(ops, tgwHasMany); rel.table != "" {
+		rel.hasMany = true
+		if f.Type.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("%w: %s", ErrRelation, name)
+		}
+	} else {
+		rel.table = tagValue(ops, tgwBelongsTo)
+	}
+
+	if rel.table == "" || !validTable(rel.table) || !validIdent(rel.fk) || baseType(f.Type).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %s", ErrRelation, name)
+	}
+
+	return rel, nil
+}
+
+// loadHasMany selects the children of all ents and appends them to the
+// relation field of their parent
+func (g *Gateway) loadHasMany(ctx context.Context, ents []reflect.Value, rel *relation) error {
+
+	pcfg, err := structMeta(ents[0].Type())
+	if err != nil {
+		return err
+	}
+	if len(pcfg.PrimaryDBs) != 1 {
+		return fmt.Errorf("%w: %s needs a single primary key", ErrRelation, rel.field.Name)
+	}
+
+	parents := relKeys{}
+	for _, e := range ents {
+		f := e.FieldByIndex(rel.field.Index)
+		f.Set(reflect.MakeSlice(f.Type(), 0, 0))
+		parents.add(e.FieldByIndex(pcfg.Fields[pcfg.PrimaryDBs[0]]), e)
+	}
+
+	children, err := g.loadRelated(ctx, rel, rel.fk, parents.args)
+	if err != nil {
+		return err
+	}
+
+	ccfg, err := structMeta(baseType(rel.field.Type))
+	if err != nil {
+		return err
+	}
+	idx, ok := ccfg.Fields[rel.fk]
+	if !ok {
+		return fmt.Errorf("%w: %s has no column %s", ErrRelation, rel.field.Name, rel.fk)
+	}
+
+	for x := 0; x < children.Len(); x++ {
+		c := children.Index(x)
+		for _, p := range parents.get(reflect.Indirect(c).FieldByIndex(idx)) {
+			f := p.FieldByIndex(rel.field.Index)
+			f.Set(reflect.Append(f, c))
+		}
+	}
+
+	return nil
+}
+
+// loadBelongsTo selects the entities the fk columns of ents refer to and sets
+// the relation field
+func (g *Gateway) loadBelongsTo(ctx context.Context, ents []reflect.Value, rel *relation) error {
+
+	ecfg, err := structMeta(ents[0].Type())
+	if err != nil {
+		return err
+	}
+	idx, ok := ecfg.Fields[rel.fk]
+	if !ok {
+		return fmt.Errorf("%w: %s has no column %s", ErrRelation, rel.field.Name, rel.fk)
+	}
+
+	rcfg, err := structMeta(baseType(rel.field.Type))
+	if err != nil {
+		return err
+	}
+	if len(rcfg.PrimaryDBs) != 1 {
+		return fmt.Errorf("%w: %s needs a single primary key", ErrRelation, rel.field.Name)
+	}
+
+	owners := relKeys{}
+	for _, e := range ents {
+		owners.add(e.FieldByIndex(idx), e)
+	}
+
+	related, err := g.loadRelated(ctx, rel, rcfg.PrimaryDBs[0], owners.args)
+	if err != nil {
+		return err
+	}
+
+	for x := 0; x < related.Len(); x++ {
+		r := related.Index(x)
+		for _, e := range owners.get(reflect.Indirect(r).FieldByIndex(rcfg.Fields[rcfg.PrimaryDBs[0]])) {
+			f := e.FieldByIndex(rel.field.Index)
+			if f.Kind() == reflect.Ptr {
+				p := reflect.New(f.Type().Elem())
+				p.Elem().Set(reflect.Indirect(r))
+				f.Set(p)
+			} else {
+				f.Set(reflect.Indirect(r))
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadRelated selects all rows of the relation table whose col is one of keys
+// into a new slice of the relation fields element type
+func (g *Gateway) loadRelated(ctx context.Context, rel *relation, col string, keys []interface{}) (reflect.Value, error) {
+
+	et := rel.field.Type
+	if rel.hasMany {
+		et = et.Elem()
+	}
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+
+	rows := reflect.New(reflect.SliceOf(et))
+	if len(keys) == 0 {
+		return rows.Elem(), nil
+	}
+
+	table := g.qualify(rel.table)
+	dest := rows.Interface()
+
+	params, err := g.scopeFor(Selectors{col + " IN": keys}, dest)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	q, args := buildSelect(table, nil, params, nil, g.softDeleteCol(dest))
+
+	if err := g.selectRows(ctx, opSelect, table, dest, q, args...); err != nil {
+		return reflect.Value{}, err
+	}
+
+	if rel.hasMany && rel.field.Type.Elem().Kind() == reflect.Ptr {
+		ptrs := reflect.MakeSlice(rel.field.Type, 0, rows.Elem().Len())
+		for x := 0; x < rows.Elem().Len(); x++ {
+			ptrs = reflect.Append(ptrs, rows.Elem().Index(x).Addr())
+		}
+		return ptrs, nil
+	}
+
+	return rows.Elem(), nil
+}
+
+// entityValues returns the addressable entities dest points to, which may be
+// a struct or a slice of structs or struct pointers
+func entityValues(v reflect.Value) []reflect.Value {
+
+	//noinspection GoPreferNilSlice
+	ents := []reflect.Value{}
+
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		ents = append(ents, v)
+	case reflect.Slice:
+		for x := 0; x < v.Len(); x++ {
+			if e := reflect.Indirect(v.Index(x)); e.IsValid() && e.Kind() == reflect.Struct {
+				ents = append(ents, e)
+			}
+		}
+	}
+
+	return ents
+}
+
+// relKeys groups entities by the value of a key field. Keys are compared by
+// their printed value so differing integer types of both sides match.
+type relKeys struct {
+	ents map[string][]reflect.Value
+	args []interface{}
+}
+
+// add registers entity e under key field v, skipping NULL keys
+func (r *relKeys) add(v reflect.Value, e reflect.Value) {
+	val, ok := relValue(v)
+	if !ok {
+		return
+	}
+	if r.ents == nil {
+		r.ents = map[string][]reflect.Value{}
+	}
+	k := fmt.Sprint(val)
+	if _, ok := r.ents[k]; !ok {
+		r.args = append(r.args, val)
+	}
+	r.ents[k] = append(r.ents[k], e)
+}
+
+// get returns the entities registered under key field v
+func (r *relKeys) get(v reflect.Value) []reflect.Value {
+	val, ok := relValue(v)
+	if !ok {
+		return nil
+	}
+	return r.ents[fmt.Sprint(val)]
+}
+
+// relValue returns the value of a key field or false if it is NULL
+func relValue(v reflect.Value) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if vr, ok := v.Interface().(driver.Valuer); ok {
+		val, err := vr.Value()
+		return val, err == nil && val != nil
+	}
+	return v.Interface(), true
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"github.com/jmoiron/sqlx"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaPolicy decides which replica a read runs on
+type ReplicaPolicy int
+
+// Supported replica policies
+const (
+	// RoundRobin spreads reads evenly across all replicas
+	RoundRobin ReplicaPolicy = iota
+	// LeastLatency sends reads to the replica answering fastest recently
+	LeastLatency
+)
+
+// replicaSet holds the read replicas of a gateway, shared by all its copies
+type replicaSet struct {
+	replicas []*replica
+	policy   ReplicaPolicy
+	next     uint64
+	written  int64
+}
+
+// replica is a single read replica
+type replica struct {
+	db      *sqlx.DB
+	latency int64
+	once    sync.Once
+	stmts   *stmtCache
+}
+
+// WithReplicas routes Read, Select, Count and all other reads outside of
+// transactions to given replicas, picked by policy. Writes always run on the
+// handle passed to NewGateway. Replicas may lag behind, see WithReadAfterWrite
+// and Primary.
+func WithReplicas(policy ReplicaPolicy, replicas ...*sqlx.DB) Option {
+	return func(g *Gateway) error {
+		if len(replicas) == 0 || (policy != RoundRobin && policy != LeastLatency) {
+			return ErrOption
+		}
+		rs := &replicaSet{policy: policy}
+		for _, db := range replicas {
+			if db == nil {
+				return ErrOption
+			}
+			rs.replicas = append(rs.replicas, &replica{db: db})
+		}
+		g.replicas = rs
+		return nil
+	}
+}
+
+// WithReadAfterWrite pins reads to the primary for d after every write of the
+// gateway or any of its copies, so changes are seen even if replicas lag
+func WithReadAfterWrite(d time.Duration) Option {
+	return func(g *Gateway) error {
+		if d < 0 {
+			return ErrOption
+		}
+		g.pin = d
+		return nil
+	}
+}
+
+// Primary returns a copy of the gateway running all reads on the primary
+func (g *Gateway) Primary() *Gateway {
+	pg := *g
+	pg.replicas = nil
+	return &pg
+}
+
+// route returns the gateway a query of op runs through, which is a copy
+// bound to a replica for reads if configured, and a function to call once the
+// query is done
+func (g *Gateway) route(op string) (*Gateway, func()) {
+
+	if g.replicas == nil || g.tx != nil {
+		return g, func() {}
+	}
+
+	if op != opRead && op != opSelect && op != opCount {
+		if g.pin > 0 {
+			atomic.StoreInt64(&g.replicas.written, time.Now().UnixNano())
+		}
+		return g, func() {}
+	}
+
+	if g.pin > 0 && time.Since(time.Unix(0, atomic.LoadInt64(&g.replicas.written))) < g.pin {
+		return g, func() {}
+	}
+
+	r := g.replicas.pick()
+
+	rg := *g
+	rg.dbx = r.db
+	rg.ext = r.db
+	rg.replicas = nil
+	if g.stmts != nil {
+		rg.stmts = r.cache(g.stmts.size)
+	}
+
+	start := time.Now()
+	return &rg, func() { r.observe(time.Since(start)) }
+}
+
+// pick selects the replica for the next read
+func (rs *replicaSet) pick() *replica {
+
+	if rs.policy == RoundRobin {
+		n := atomic.AddUint64(&rs.next, 1)
+		return rs.replicas[(n-1)%uint64(len(rs.replicas))]
+	}
+
+	best := rs.replicas[0]
+	for _, r := range rs.replicas[1:] {
+		if atomic.LoadInt64(&r.latency) < atomic.LoadInt64(&best.latency) {
+			best = r
+		}
+	}
+
+	return best
+}
+
+// observe adds the duration of a read to the moving average latency
+func (r *replica) observe(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&r.latency)
+		avg := old + (int64(d)-old)/8
+		if old == 0 {
+			avg = int64(d)
+		}
+		if atomic.CompareAndSwapInt64(&r.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// cache returns the statement cache of the replica, created on first use
+func (r *replica) cache(size int) *stmtCache {
+	r.once.Do(func() {
+		r.stmts = newStmtCache(size)
+	})
+	return r.stmts
+}
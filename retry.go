@@ -0,0 +1,151 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how operations failing with a transient error like a
+// deadlock are retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every further
+	// retry up to MaxBackoff if that is set
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable classifies errors worth retrying, IsTransient if nil
+	Retryable func(err error) bool
+}
+
+// WithRetry retries single queries and transactions started by the gateway
+// according to policy. Queries inside a transaction are never retried on
+// their own as the database rolled back the whole transaction, instead the
+// transaction is run again, so functions passed to WithTx, Transact or
+// FindInBatches have to be safe to be called more than once.
+func WithRetry(policy RetryPolicy) Option {
+	return func(g *Gateway) error {
+		if policy.MaxAttempts < 1 || policy.Backoff < 0 || policy.MaxBackoff < 0 {
+			return ErrOption
+		}
+		g.retries = &policy
+		return nil
+	}
+}
+
+// mysqlTransient lists MySQL error numbers of deadlocks and lock wait
+// timeouts
+var mysqlTransient = []int64{1205, 1213}
+
+// pgTransient lists the SQLSTATE codes of serialization failures and
+// deadlocks
+var pgTransient = []string{"40001", "40P01"}
+
+// mysqlErrRe matches the error number in messages of the MySQL driver
+var mysqlErrRe = regexp.MustCompile(`^Error (\d+)\b`)
+
+// IsTransient reports whether err is a deadlock, lock wait timeout or
+// serialization failure of MySQL or Postgres, which may succeed if retried.
+// Driver errors are recognized without depending on the drivers.
+func IsTransient(err error) bool {
+
+	for ; err != nil; err = errors.Unwrap(err) {
+
+		if s, ok := err.(interface{ SQLState() string }); ok && inArray(s.SQLState(), pgTransient) {
+			return true
+		}
+
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() == reflect.Struct {
+			// MySQLError.Number of go-sql-driver/mysql
+			if f := v.FieldByName("Number"); f.IsValid() && isInteger(f.Kind()) && inInt(intValue(f), mysqlTransient) {
+				return true
+			}
+			// Error.Code of lib/pq
+			if f := v.FieldByName("Code"); f.IsValid() && f.Kind() == reflect.String && inArray(f.String(), pgTransient) {
+				return true
+			}
+		}
+
+		if m := mysqlErrRe.FindStringSubmatch(err.Error()); m != nil {
+			if n, perr := strconv.ParseInt(m[1], 10, 64); perr == nil && inInt(n, mysqlTransient) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// retry runs fn until it succeeds, fails with an error not worth retrying or
+// the retry policy is exhausted. Inside transactions fn runs once only.
+func (g *Gateway) retry(ctx context.Context, fn func() error) error {
+
+	if g.retries == nil || g.tx != nil {
+		return fn()
+	}
+
+	p := g.retries
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsTransient
+	}
+
+	delay := p.Backoff
+	for attempt := 1; ; attempt++ {
+
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		delay *= 2
+		if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+			delay = p.MaxBackoff
+		}
+	}
+}
+
+// intValue returns the value of a signed or unsigned integer
+func intValue(v reflect.Value) int64 {
+	if isSigned(v.Kind()) {
+		return v.Int()
+	}
+	return int64(v.Uint())
+}
+
+// inInt checks if given needle is in given haystack
+func inInt(needle int64, haystack []int64) bool {
+	for _, v := range haystack {
+		if v == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testMySQLErr mimics the error of go-sql-driver/mysql
+type testMySQLErr struct {
+	Number  uint16
+	Message string
+}
+
+func (e *testMySQLErr) Error() string { return e.Message }
+
+// testPQErr mimics the error of lib/pq
+type testPQErr struct {
+	Code string
+}
+
+func (e *testPQErr) Error() string { return "pq: " + e.Code }
+
+// testPgxErr mimics the error of pgx, which reports its SQLSTATE by method
+type testPgxErr string
+
+func (e testPgxErr) Error() string    { return "ERROR: " + string(e) }
+func (e testPgxErr) SQLState() string { return string(e) }
+
+// TestIsTransient checks the classification of driver errors
+func TestIsTransient(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", errors.New("syntax error"), false},
+		{"mysql deadlock", &testMySQLErr{Number: 1213}, true},
+		{"mysql lock wait", &testMySQLErr{Number: 1205}, true},
+		{"mysql duplicate", &testMySQLErr{Number: 1062}, false},
+		{"mysql wrapped", fmt.Errorf("update: %w", &testMySQLErr{Number: 1213}), true},
+		{"mysql message", errors.New("Error 1205 (HY000): Lock wait timeout exceeded"), true},
+		{"mysql other message", errors.New("Error 1062 (23000): Duplicate entry"), false},
+		{"pq serialization", &testPQErr{Code: "40001"}, true},
+		{"pq deadlock", &testPQErr{Code: "40P01"}, true},
+		{"pq unique", &testPQErr{Code: "23505"}, false},
+		{"sqlstate", testPgxErr("40001"), true},
+		{"sqlstate other", testPgxErr("23505"), false},
+		{"sqlstate wrapped", fmt.Errorf("select: %w", testPgxErr("40P01")), true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsTransient(tc.err); got != tc.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestRetry checks how often failing statements are attempted
+func TestRetry(t *testing.T) {
+
+	deadlock := &testMySQLErr{Number: 1213, Message: "Error 1213: Deadlock found"}
+
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		policy   RetryPolicy
+		op       func(g *Gateway) error
+		attempts int
+		wantErr  bool
+	}{
+		{"select succeeds", 2, deadlock, RetryPolicy{MaxAttempts: 3}, func(g *Gateway) error {
+			var users []testUser
+			return g.Select(&users, nil, nil)
+		}, 3, false},
+		{"update succeeds", 1, deadlock, RetryPolicy{MaxAttempts: 3}, func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "b"})
+		}, 2, false},
+		{"exhausted", 5, deadlock, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "b"})
+		}, 3, true},
+		{"not transient", 5, errors.New("disk full"), RetryPolicy{MaxAttempts: 3}, func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "b"})
+		}, 1, true},
+		{"custom classifier", 1, errors.New("disk full"), RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return true }}, func(g *Gateway) error {
+			return g.Update(&testUser{ID: 1, Name: "b"})
+		}, 2, false},
+		{"cancelled", 5, deadlock, RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}, func(g *Gateway) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			return g.UpdateContext(ctx, &testUser{ID: 1, Name: "b"})
+		}, 1, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &testConn{DB: testDB(t, testUsers)}
+			g := testGateway(t, c, "users", WithRetry(tc.policy))
+			testCreate(t, g, &testUser{Name: "a"})
+
+			attempts, failures := 0, tc.failures
+			c.fail = func(q string) error {
+				attempts++
+				if failures == 0 {
+					return nil
+				}
+				failures--
+				return tc.err
+			}
+
+			if err := tc.op(g); (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if attempts != tc.attempts {
+				t.Errorf("%d attempts, want %d", attempts, tc.attempts)
+			}
+		})
+	}
+}
+
+// TestRetryTransaction checks that transactions are run again as a whole
+// instead of retrying single statements within them
+func TestRetryTransaction(t *testing.T) {
+
+	db := testDB(t, testUsers)
+	g := testGateway(t, db, "users", WithRetry(RetryPolicy{MaxAttempts: 3}))
+
+	runs := 0
+	err := g.WithTx(func(txg *Gateway) error {
+		runs++
+		if err := txg.Create(&testUser{Name: "a"}); err != nil {
+			return err
+		}
+		if runs == 1 {
+			return testPgxErr("40001")
+		}
+		return nil
+	})
+	if err != nil || runs != 2 {
+		t.Fatalf("WithTx() = %v after %d runs, want 2", err, runs)
+	}
+
+	if n := testCount(t, db, "users", "1 = 1"); n != 1 {
+		t.Errorf("%d rows, want the one of the second run", n)
+	}
+}
+
+// TestWithRetry checks the validation of the retry policy
+func TestWithRetry(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+	}{
+		{"no attempts", RetryPolicy{}},
+		{"negative backoff", RetryPolicy{MaxAttempts: 2, Backoff: -time.Second}},
+		{"negative max backoff", RetryPolicy{MaxAttempts: 2, MaxBackoff: -time.Second}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewGateway(testDB(t), "users", WithRetry(tc.policy)); !errors.Is(err, ErrOption) {
+				t.Fatalf("NewGateway() = %v, want ErrOption", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// WithReturning makes Create, Upsert, Update and UpdatePartial re-read the
+// written row via RETURNING on dialects supporting it, so defaults, triggers
+// and timestamps set by the database are visible in the entity. Without
+// columns the whole row is read. Other dialects write as usual, use
+// UpdateReturning there.
+func WithReturning(cols ...string) Option {
+	return func(g *Gateway) error {
+		if !validIdent(cols...) {
+			return ErrOption
+		}
+		g.returning = append([]string{}, cols...)
+		return nil
+	}
+}
+
+// returningClause returns the RETURNING clause re-reading written rows or an
+// empty string if disabled or not supported
+func (g *Gateway) returningClause() string {
+	if g.returning == nil || !g.dialect.Returning() {
+		return ""
+	}
+	if len(g.returning) == 0 {
+		return " RETURNING *"
+	}
+	return " RETURNING " + strings.Join(quoteIdents(g.returning), ",")
+}
+
+// update runs UPDATE statement q of entity, re-reading the row into dest if
+// RETURNING is enabled
+func (g *Gateway) update(ctx context.Context, table string, dest interface{}, destcfg *tabMeta, q string, args ...interface{}) (sql.Result, error) {
+
+	rc := g.returningClause()
+	if rc == "" {
+		return g.exec(ctx, opUpdate, table, q, args...)
+	}
+
+	// The version read back is already incremented, checkVersion does it again
+	var version reflect.Value
+	if destcfg.Version != "" {
+		f := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[destcfg.Version])
+		version = reflect.New(f.Type()).Elem()
+		version.Set(f)
+		defer func() { f.Set(version) }()
+	}
+
+	err := g.get(ctx, opUpdate, table, dest, q+rc, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return driver.RowsAffected(0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
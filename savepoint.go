@@ -0,0 +1,126 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// savepointSeq numbers the savepoints of nested transactions
+var savepointSeq uint64
+
+// Savepoint sets a savepoint named name in the transaction the gateway is
+// bound to. Writes after it can be undone by RollbackTo while keeping the
+// transaction and earlier writes.
+func (g *Gateway) Savepoint(name string) error {
+	return g.SavepointContext(context.Background(), name)
+}
+
+// SavepointContext is like Savepoint but runs with given context
+func (g *Gateway) SavepointContext(ctx context.Context, name string) error {
+
+	if err := g.savepointExec(ctx, "SAVEPOINT `%s`", name); err != nil {
+		return err
+	}
+
+	g.changes.mark(name)
+
+	return nil
+}
+
+// RollbackTo undoes all writes after the savepoint named name, which stays
+// set. Change events of the undone writes are dropped.
+func (g *Gateway) RollbackTo(name string) error {
+	return g.RollbackToContext(context.Background(), name)
+}
+
+// RollbackToContext is like RollbackTo but runs with given context
+func (g *Gateway) RollbackToContext(ctx context.Context, name string) error {
+
+	if err := g.savepointExec(ctx, "ROLLBACK TO SAVEPOINT `%s`", name); err != nil {
+		return err
+	}
+
+	g.changes.rollbackTo(name)
+
+	return nil
+}
+
+// ReleaseSavepoint removes the savepoint named name, keeping all writes
+func (g *Gateway) ReleaseSavepoint(name string) error {
+	return g.ReleaseSavepointContext(context.Background(), name)
+}
+
+// ReleaseSavepointContext is like ReleaseSavepoint but runs with given context
+func (g *Gateway) ReleaseSavepointContext(ctx context.Context, name string) error {
+
+	if err := g.savepointExec(ctx, "RELEASE SAVEPOINT `%s`", name); err != nil {
+		return err
+	}
+
+	g.changes.release(name)
+
+	return nil
+}
+
+// savepointExec runs the savepoint statement format on the transaction of the
+// gateway
+func (g *Gateway) savepointExec(ctx context.Context, format string, name string) error {
+
+	if g.tx == nil {
+		return ErrNoTx
+	}
+
+	if !validIdent(name) {
+		return ErrIdentifier
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	_, err := g.tx.ExecContext(ctx, translate(g.dialect, fmt.Sprintf(format, name)))
+
+	return err
+}
+
+// nested runs fn within a savepoint of the transaction the gateway is bound
+// to, rolling back to it if fn returns an error or panics
+func (g *Gateway) nested(ctx context.Context, fn func(txg *Gateway) error) (err error) {
+
+	name := fmt.Sprintf("tgw_%d", atomic.AddUint64(&savepointSeq, 1))
+
+	if err := g.SavepointContext(ctx, name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = g.RollbackToContext(ctx, name)
+			panic(p)
+		}
+	}()
+
+	if err = fn(g); err != nil {
+		if rerr := g.RollbackToContext(ctx, name); rerr != nil {
+			return rerr
+		}
+		_ = g.ReleaseSavepointContext(ctx, name)
+		return err
+	}
+
+	return g.ReleaseSavepointContext(ctx, name)
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestSavepoints checks which writes of a transaction survive savepoints and
+// nested transactions and that change events of undone writes are dropped
+func TestSavepoints(t *testing.T) {
+
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name  string
+		tx    func(t *testing.T, txg *Gateway) error
+		names []string
+	}{
+		{"rollback to", func(t *testing.T, txg *Gateway) error {
+			if err := txg.Savepoint("sp"); err != nil {
+				return err
+			}
+			testCreate(t, txg, &testUser{Name: "drop"})
+			return txg.RollbackTo("sp")
+		}, []string{"keep"}},
+		{"release", func(t *testing.T, txg *Gateway) error {
+			if err := txg.Savepoint("sp"); err != nil {
+				return err
+			}
+			testCreate(t, txg, &testUser{Name: "b"})
+			return txg.ReleaseSavepoint("sp")
+		}, []string{"keep", "b"}},
+		{"rollback to twice", func(t *testing.T, txg *Gateway) error {
+			if err := txg.Savepoint("sp"); err != nil {
+				return err
+			}
+			testCreate(t, txg, &testUser{Name: "drop"})
+			if err := txg.RollbackTo("sp"); err != nil {
+				return err
+			}
+			testCreate(t, txg, &testUser{Name: "drop2"})
+			return txg.RollbackTo("sp")
+		}, []string{"keep"}},
+		{"nested failing", func(t *testing.T, txg *Gateway) error {
+			err := txg.WithTx(func(ng *Gateway) error {
+				testCreate(t, ng, &testUser{Name: "drop"})
+				return boom
+			})
+			if !errors.Is(err, boom) {
+				return err
+			}
+			return nil
+		}, []string{"keep"}},
+		{"nested succeeding", func(t *testing.T, txg *Gateway) error {
+			return txg.WithTx(func(ng *Gateway) error {
+				return ng.Create(&testUser{Name: "b"})
+			})
+		}, []string{"keep", "b"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []string
+			g := testGateway(t, testDB(t, testUsers), "users", OnChange(func(ev Event) {
+				events = append(events, ev.Op)
+			}))
+
+			err := g.WithTx(func(txg *Gateway) error {
+				testCreate(t, txg, &testUser{Name: "keep"})
+				return tc.tx(t, txg)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var users []testUser
+			if err := g.Select(&users, nil, OrderBy{"id": "ASC"}); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, u := range users {
+				names = append(names, u.Name)
+			}
+			if len(names) != len(tc.names) || len(events) != len(tc.names) {
+				t.Fatalf("rows %v and %d events, want %v", names, len(events), tc.names)
+			}
+			for i := range names {
+				if names[i] != tc.names[i] {
+					t.Errorf("rows %v, want %v", names, tc.names)
+				}
+			}
+		})
+	}
+}
+
+// TestSavepointErrors checks the savepoint calls refused before reaching the
+// database
+func TestSavepointErrors(t *testing.T) {
+
+	g := testGateway(t, testDB(t, testUsers), "users")
+
+	tests := []struct {
+		name string
+		g    *Gateway
+		sp   string
+		err  error
+	}{
+		{"no transaction", g, "sp", ErrNoTx},
+		{"invalid name", nil, "sp; DROP TABLE users", ErrIdentifier},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sg := tc.g
+			if sg == nil {
+				txg, err := g.BeginTx(context.Background(), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer func() { _ = txg.Rollback() }()
+				sg = txg
+			}
+			for _, fn := range []func(string) error{sg.Savepoint, sg.RollbackTo, sg.ReleaseSavepoint} {
+				if err := fn(tc.sp); !errors.Is(err, tc.err) {
+					t.Errorf("err = %v, want %v", err, tc.err)
+				}
+			}
+		})
+	}
+}
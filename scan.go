@@ -0,0 +1,241 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"container/list"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"reflect"
+	"sync"
+)
+
+// scanMeta returns the struct meta of dest if its rows can not be scanned by
+// sqlx directly, e.g. because of json or encrypted columns, prefixed nested
+// structs or fields named by the NameMapper. It returns nil otherwise.
+func scanMeta(dest interface{}) *tabMeta {
+
+	t := baseType(reflect.TypeOf(dest))
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	m, err := structMeta(t)
+	if err != nil || (len(m.JSONCols) == 0 && len(m.Encrypted) == 0 && !m.Nested && !m.Mapped) {
+		return nil
+	}
+
+	return m
+}
+
+// scanOne scans the first row into dest and closes rows. It returns
+// sql.ErrNoRows if there is none.
+func scanOne(rows *sqlx.Rows, dest interface{}, m *tabMeta, c Cipher) error {
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	if err := scanStruct(rows, reflect.ValueOf(dest).Elem(), m, c); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// scanAll appends all rows to the slice dest points to and closes rows
+func scanAll(rows *sqlx.Rows, dest interface{}, m *tabMeta, c Cipher) error {
+
+	defer rows.Close()
+
+	slice := reflect.ValueOf(dest).Elem()
+	elem := slice.Type().Elem()
+	isPtr := elem.Kind() == reflect.Ptr
+	if isPtr {
+		elem = elem.Elem()
+	}
+
+	for rows.Next() {
+		v := reflect.New(elem)
+		if err := scanStruct(rows, v.Elem(), m, c); err != nil {
+			return err
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, v))
+		} else {
+			slice.Set(reflect.Append(slice, v.Elem()))
+		}
+	}
+
+	return rows.Err()
+}
+
+// scanStruct scans the current row into struct value v, decrypting encrypted
+// columns with c
+func scanStruct(rows *sqlx.Rows, v reflect.Value, m *tabMeta, c Cipher) error {
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	targets := make([]interface{}, len(cols))
+	for i, col := range cols {
+		if _, ok := m.Fields[col]; !ok {
+			return fmt.Errorf("missing destination name %s in %s", col, v.Type())
+		}
+		targets[i] = scanTarget(v, col, m, c)
+	}
+
+	return rows.Scan(targets...)
+}
+
+// scanTarget returns the scan destination of column col of struct value v
+func scanTarget(v reflect.Value, col string, m *tabMeta, c Cipher) interface{} {
+	ptr := v.FieldByIndex(m.Fields[col]).Addr().Interface()
+	if inArray(col, m.Encrypted) {
+		return &cipherColumn{v: ptr, c: c}
+	}
+	if inArray(col, m.JSONCols) {
+		return &jsonColumn{v: ptr}
+	}
+	return ptr
+}
+
+// namedPlan is a named statement compiled to placeholders and the columns
+// bound to them in order
+type namedPlan struct {
+	key  string
+	q    string
+	cols []string
+}
+
+// maxNamedPlans limits the number of cached plans, as statements of partial
+// updates and gateways for dynamic tables may differ on every call
+const maxNamedPlans = 1024
+
+// planCache holds the plans of named statements by their text, dropping the
+// least recently used ones once size is exceeded
+type planCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	plans map[string]*list.Element
+}
+
+// namedPlans caches the plans of all named statements
+var namedPlans = &planCache{size: maxNamedPlans, ll: list.New(), plans: map[string]*list.Element{}}
+
+// get returns the plan of q or nil
+func (c *planCache) get(q string) *namedPlan {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.plans[q]
+	if !ok {
+		return nil
+	}
+
+	c.ll.MoveToFront(el)
+
+	return el.Value.(*namedPlan)
+}
+
+// put adds plan p, evicting the least recently used plan if full
+func (c *planCache) put(p *namedPlan) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.plans[p.key]; ok {
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.plans[p.key] = c.ll.PushFront(p)
+
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.plans, el.Value.(*namedPlan).key)
+	}
+}
+
+// bindNamed binds the named parameters of q to the columns of the entity dest
+// points to. Statements are compiled once and their arguments taken from the
+// cached field indexes of m.
+func bindNamed(q string, dest interface{}, m *tabMeta) (string, []interface{}, error) {
+
+	p, err := planNamed(q, m)
+	if err != nil {
+		return "", nil, err
+	}
+
+	v := reflect.ValueOf(dest).Elem()
+
+	args := make([]interface{}, len(p.cols))
+	for i, col := range p.cols {
+		args[i] = bindValue(v.FieldByIndex(m.Fields[col]), col, m)
+	}
+
+	return p.q, args, nil
+}
+
+// planNamed returns the cached plan of q, compiling it with the column names
+// of m as arguments, so their order is reported by sqlx
+func planNamed(q string, m *tabMeta) (*namedPlan, error) {
+
+	if p := namedPlans.get(q); p != nil {
+		return p, nil
+	}
+
+	names := make(map[string]interface{}, len(m.Fields))
+	for col := range m.Fields {
+		names[col] = col
+	}
+
+	bq, args, err := sqlx.Named(q, names)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &namedPlan{key: q, q: bq, cols: make([]string, len(args))}
+	for i, a := range args {
+		p.cols[i] = a.(string)
+	}
+
+	namedPlans.put(p)
+
+	return p, nil
+}
+
+// bindValue returns the argument of column col held by field f, wrapping
+// encrypted and json columns
+func bindValue(f reflect.Value, col string, m *tabMeta) interface{} {
+	if inArray(col, m.Encrypted) {
+		return cipherColumn{v: f.Addr().Interface()}
+	}
+	if inArray(col, m.JSONCols) {
+		return jsonColumn{v: f.Addr().Interface()}
+	}
+	return f.Interface()
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"github.com/jmoiron/sqlx"
+	"testing"
+)
+
+// benchNamed is an entity sqlx can bind named parameters of directly
+type benchNamed struct {
+	ID    uint64 `db:"id" tgw:"primary"`
+	Name  string `db:"name" tgw:"insert,update"`
+	Email string `db:"email" tgw:"insert,update"`
+	Age   int    `db:"age" tgw:"insert,update"`
+}
+
+// BenchmarkBindNamed compares binding an update with cached plans to
+// compiling it with sqlx on every call
+func BenchmarkBindNamed(b *testing.B) {
+
+	m, err := parseMeta(&benchNamed{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	e := &benchNamed{ID: 1, Name: "name", Email: "mail", Age: 42}
+	q := "UPDATE users SET name=:name, email=:email, age=:age WHERE id=:id"
+
+	b.Run("sqlx", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := sqlx.Named(q, e); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("planned", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := bindNamed(q, e, m); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
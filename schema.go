@@ -0,0 +1,301 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaError lists the differences between a struct and its table. Missing
+// holds db tags without a table column, Extra holds table columns without a
+// db tag and Mismatched columns whose database type can not hold the field,
+// like "age TEXT". It matches ErrSchema.
+type SchemaError struct {
+	Table      string
+	Missing    []string
+	Extra      []string
+	Mismatched []string
+}
+
+// Error implements error
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf(
+		"%s: %s (missing columns: %s; extra columns: %s; mismatched types: %s)",
+		ErrSchema.Error(),
+		e.Table,
+		strings.Join(e.Missing, ","),
+		strings.Join(e.Extra, ","),
+		strings.Join(e.Mismatched, ","),
+	)
+}
+
+// Unwrap returns ErrSchema
+func (e *SchemaError) Unwrap() error {
+	return ErrSchema
+}
+
+// VerifySchema is like ValidateSchema but runs with the background context
+func (g *Gateway) VerifySchema(dest interface{}) error {
+	return g.ValidateSchema(context.Background(), dest)
+}
+
+// VerifySchemaContext is the same as ValidateSchema
+func (g *Gateway) VerifySchemaContext(ctx context.Context, dest interface{}) error {
+	return g.ValidateSchema(ctx, dest)
+}
+
+// ValidateSchema compares the db tags of dest against the columns of its table
+// and their types and returns a *SchemaError if they differ. Columns are read
+// from information_schema.columns on MySQL and Postgres and pragma_table_info
+// on SQLite, other dialects use the types reported by the driver. It is meant
+// to be called once on startup.
+func (g *Gateway) ValidateSchema(ctx context.Context, dest interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	cols, err := g.tableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+
+	e := &SchemaError{Table: table, Missing: []string{}, Extra: []string{}, Mismatched: []string{}}
+
+	names := make([]string, len(cols))
+	t := baseType(reflect.TypeOf(dest))
+	for i, col := range cols {
+		names[i] = col.name
+		idx, ok := destcfg.Fields[col.name]
+		if !ok {
+			e.Extra = append(e.Extra, col.name)
+			continue
+		}
+		if inArray(col.name, destcfg.JSONCols) {
+			continue
+		}
+		if !typeFits(t.FieldByIndex(idx).Type, col.typ) {
+			e.Mismatched = append(e.Mismatched, col.name+" "+col.typ)
+		}
+	}
+
+	for name := range destcfg.Fields {
+		if !inArray(name, names) {
+			e.Missing = append(e.Missing, name)
+		}
+	}
+
+	if len(e.Missing) == 0 && len(e.Extra) == 0 && len(e.Mismatched) == 0 {
+		return nil
+	}
+
+	sort.Strings(e.Missing)
+	sort.Strings(e.Extra)
+	sort.Strings(e.Mismatched)
+
+	return e
+}
+
+// tableColumn is a column of a table and its database type
+type tableColumn struct {
+	name string
+	typ  string
+}
+
+// tableColumns reads the columns of table from the catalog of the gateways
+// dialect or, if it has none, from an empty result of the table
+func (g *Gateway) tableColumns(ctx context.Context, table string) ([]tableColumn, error) {
+
+	schema, name := "", table
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		schema, name = table[:i], table[i+1:]
+	}
+
+	var q string
+	args := []interface{}{name}
+
+	switch g.dialect.Name() {
+	case "sqlite":
+		q = "SELECT name, type FROM pragma_table_info(?)"
+		if schema != "" {
+			q = "SELECT name, type FROM pragma_table_info(?, ?)"
+			args = append(args, schema)
+		}
+	case "mysql", "postgres":
+		q = "SELECT column_name, data_type FROM information_schema.columns WHERE table_name = ? AND table_schema = "
+		switch {
+		case schema != "":
+			q = q + "?"
+			args = append(args, schema)
+		case g.dialect.Name() == "mysql":
+			q = q + "DATABASE()"
+		default:
+			q = q + "current_schema()"
+		}
+		q = q + " ORDER BY ordinal_position"
+	default:
+		return g.resultColumns(ctx, table)
+	}
+
+	// Hints name the table of the gateway, not the catalog
+	cg := *g
+	cg.hints = nil
+	cg.indexHint = nil
+
+	rows, err := cg.queryRows(ctx, opRead, table, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	//noinspection GoPreferNilSlice
+	cols := []tableColumn{}
+	for rows.Next() {
+		var c tableColumn
+		if err := rows.Scan(&c.name, &c.typ); err != nil {
+			return nil, err
+		}
+		c.typ = strings.ToUpper(c.typ)
+		cols = append(cols, c)
+	}
+
+	return cols, rows.Err()
+}
+
+// resultColumns reads the columns of table and their types as reported by the
+// driver for an empty result
+func (g *Gateway) resultColumns(ctx context.Context, table string) ([]tableColumn, error) {
+
+	rows, err := g.queryRows(ctx, opRead, table, fmt.Sprintf("SELECT * FROM %s", quoteTable(table))+g.dialect.Limit(0, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]tableColumn, len(types))
+	for i, ct := range types {
+		cols[i] = tableColumn{name: ct.Name(), typ: ct.DatabaseTypeName()}
+	}
+
+	return cols, nil
+}
+
+// Families of database types
+const (
+	famInt    = "int"
+	famFloat  = "float"
+	famText   = "text"
+	famBool   = "bool"
+	famTime   = "time"
+	famBinary = "binary"
+	famDec    = "decimal"
+)
+
+// typeFamilies maps substrings of database type names to their family, more
+// specific ones first
+var typeFamilies = []struct {
+	sub string
+	fam string
+}{
+	{"POINT", ""}, {"INTERVAL", ""},
+	{"BOOL", famBool}, {"BIT", famBool},
+	{"INT", famInt}, {"SERIAL", famInt},
+	{"REAL", famFloat}, {"DOUBLE", famFloat}, {"FLOAT", famFloat}, {"NUMERIC", famDec}, {"DECIMAL", famDec},
+	{"DATE", famTime}, {"TIME", famTime},
+	{"CHAR", famText}, {"TEXT", famText}, {"CLOB", famText}, {"UUID", famText}, {"ENUM", famText}, {"JSON", famText},
+	{"BLOB", famBinary}, {"BYTEA", famBinary}, {"BINARY", famBinary},
+}
+
+// typeFamily returns the family of database type name or an empty string if
+// unknown
+func typeFamily(name string) string {
+	name = strings.ToUpper(name)
+	for _, f := range typeFamilies {
+		if strings.Contains(name, f.sub) {
+			return f.fam
+		}
+	}
+	return ""
+}
+
+// typeFits checks if a column of database type name can hold a field of type
+// t. Unknown types on either side always fit.
+func typeFits(t reflect.Type, name string) bool {
+
+	db := typeFamily(name)
+	if db == "" {
+		return true
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var fits []string
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(sql.NullTime{}):
+		// SQLite and others may store times as text or unix time
+		fits = []string{famTime, famText, famInt}
+	case reflect.TypeOf(sql.NullString{}):
+		fits = []string{famText, famDec}
+	case reflect.TypeOf(sql.NullInt64{}), reflect.TypeOf(sql.NullInt32{}):
+		fits = []string{famInt}
+	case reflect.TypeOf(sql.NullFloat64{}):
+		fits = []string{famFloat, famInt, famDec}
+	case reflect.TypeOf(sql.NullBool{}):
+		fits = []string{famBool, famInt}
+	}
+
+	if fits == nil {
+		switch k := t.Kind(); {
+		case k == reflect.Bool:
+			// MySQL stores booleans as TINYINT(1)
+			fits = []string{famBool, famInt}
+		case isInteger(k):
+			fits = []string{famInt}
+		case k == reflect.Float32 || k == reflect.Float64:
+			fits = []string{famFloat, famInt, famDec}
+		case k == reflect.String:
+			// Decimals are read as strings to keep their precision
+			fits = []string{famText, famTime, famDec}
+		case k == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+			fits = []string{famBinary, famText}
+		default:
+			return true
+		}
+	}
+
+	return inArray(db, fits)
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// likeEscape is the escape character used in LIKE patterns
+const likeEscape = "!"
+
+// likeEscaper escapes wildcards of user input for LIKE patterns
+var likeEscaper = strings.NewReplacer(
+	likeEscape, likeEscape+likeEscape,
+	"%", likeEscape+"%",
+	"_", likeEscape+"_",
+)
+
+// SearchLike selects all rows into dest where any of columns contains term.
+// Wildcards in term are matched literally.
+func (g *Gateway) SearchLike(dest interface{}, columns []string, term string, orderby Orderer) error {
+	return g.SearchLikeContext(context.Background(), dest, columns, term, orderby)
+}
+
+// SearchLikeContext is like SearchLike but runs with given context
+func (g *Gateway) SearchLikeContext(ctx context.Context, dest interface{}, columns []string, term string, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+
+	if len(columns) == 0 || !validIdent(columns...) {
+		return ErrIdentifier
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	pattern := "%" + likeEscaper.Replace(term) + "%"
+
+	//noinspection GoPreferNilSlice
+	conds := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, col := range quoteIdents(columns) {
+		conds = append(conds, fmt.Sprintf("%s LIKE ? ESCAPE '%s'", col, likeEscape))
+		args = append(args, pattern)
+	}
+
+	search, err := g.scopeFor(Raw("("+strings.Join(conds, " OR ")+")", args...), dest)
+	if err != nil {
+		return err
+	}
+
+	where, args := whereClause(search)
+	where = withoutDeleted(where, g.softDeleteCol(dest))
+	q := fmt.Sprintf("SELECT * FROM %s", quoteTable(table)) + where + orderClause(orderby, quoteColumn)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	err = g.selectRows(ctx, opSelect, table, dest, q, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Search selects the rows into dest whose columns tagged fulltext match term
+// and params, most relevant first, limited to limit rows unless it is zero.
+// MySQL matches the columns in boolean mode and needs a FULLTEXT index over
+// exactly them, PostgreSQL matches their to_tsvector against the
+// plainto_tsquery of term. Other dialects fall back to SearchLike semantics
+// without relevance ordering.
+func (g *Gateway) Search(dest interface{}, term string, params Condition, limit int) error {
+	return g.SearchContext(context.Background(), dest, term, params, limit)
+}
+
+// SearchContext is like Search but runs with given context
+func (g *Gateway) SearchContext(ctx context.Context, dest interface{}, term string, params Condition, limit int) error {
+
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	if limit < 0 {
+		return ErrPage
+	}
+
+	m := destMeta(dest)
+	if m == nil || len(m.FullText) == 0 {
+		return ErrNoFullText
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	match, rank := g.fullText(m.FullText, term)
+
+	cond, err := g.scopeFor(And(match, params), dest)
+	if err != nil {
+		return err
+	}
+
+	where, args := whereClause(cond)
+	where = withoutDeleted(where, g.softDeleteCol(dest))
+	q := fmt.Sprintf("SELECT * FROM %s", quoteTable(table)) + where
+
+	if rank.SQL != "" {
+		q = q + " ORDER BY " + rank.SQL + " DESC"
+		args = append(args, rank.Args...)
+	}
+
+	if limit > 0 {
+		q = q + g.dialect.Limit(limit, 0)
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return g.selectRows(ctx, opSelect, table, dest, q, args...)
+}
+
+// fullText returns the condition matching term against cols in the dialect of
+// the gateway and the expression ranking the matches, which is empty if the
+// dialect has none
+func (g *Gateway) fullText(cols []string, term string) (RawSQL, RawSQL) {
+
+	quoted := quoteIdents(cols)
+
+	switch g.dialect.Name() {
+	case "mysql":
+		e := fmt.Sprintf("MATCH(%s) AGAINST (? IN BOOLEAN MODE)", strings.Join(quoted, ","))
+		return Raw(e, term), Raw(e, term)
+	case "postgres":
+		//noinspection GoPreferNilSlice
+		parts := []string{}
+		for _, c := range quoted {
+			parts = append(parts, fmt.Sprintf("coalesce(%s, '')", c))
+		}
+		doc := "to_tsvector(" + strings.Join(parts, " || ' ' || ") + ")"
+		return Raw(doc+" @@ plainto_tsquery(?)", term), Raw("ts_rank("+doc+", plainto_tsquery(?))", term)
+	}
+
+	pattern := "%" + likeEscaper.Replace(term) + "%"
+
+	//noinspection GoPreferNilSlice
+	conds := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, c := range quoted {
+		conds = append(conds, fmt.Sprintf("%s LIKE ? ESCAPE '%s'", c, likeEscape))
+		args = append(args, pattern)
+	}
+
+	return Raw("("+strings.Join(conds, " OR ")+")", args...), RawSQL{}
+}
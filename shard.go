@@ -0,0 +1,94 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+// ShardResolver computes the physical table holding entity from its logical
+// table, like orders_07 for orders from a hash of the customer ID. The entity
+// is passed as given to the gateway, usually a pointer to a struct.
+type ShardResolver func(table string, entity interface{}) (string, error)
+
+// WithShardResolver spreads the rows of every table across shard tables
+// computed by fn. Create, Read, Update and Delete pass their entity to fn,
+// all other queries need a gateway bound to a shard by ForShard.
+func WithShardResolver(fn ShardResolver) Option {
+	return func(g *Gateway) error {
+		g.shard = fn
+		return nil
+	}
+}
+
+// ForShard returns a copy of the gateway whose queries not bound to a single
+// entity, like Select, Count or ReadMany, run on the shard of entity. Only the
+// shard key fields of entity have to be set.
+func (g *Gateway) ForShard(entity interface{}) *Gateway {
+	sg := *g
+	sg.shardKey = entity
+	return &sg
+}
+
+// entityTable resolves the table of dest like tableName but picks the shard
+// of dest itself
+func (g *Gateway) entityTable(dest interface{}) (string, error) {
+	return g.resolveTable(dest, dest)
+}
+
+// batchTable resolves the table of a batch of entities, which all have to be
+// on the same shard
+func (g *Gateway) batchTable(dest interface{}, elems []interface{}) (string, error) {
+
+	if g.shard == nil {
+		return g.tableName(dest)
+	}
+
+	table, err := g.resolveTable(dest, elems[0])
+	if err != nil {
+		return "", err
+	}
+
+	for _, e := range elems[1:] {
+		t, err := g.resolveTable(dest, e)
+		if err != nil {
+			return "", err
+		}
+		if t != table {
+			return "", ErrShardMix
+		}
+	}
+
+	return table, nil
+}
+
+// shardTable maps table to the shard of entity if sharding is configured
+func (g *Gateway) shardTable(table string, entity interface{}) (string, error) {
+
+	if g.shard == nil {
+		return table, nil
+	}
+
+	if entity == nil {
+		return "", ErrNoShard
+	}
+
+	shard, err := g.shard(table, entity)
+	if err != nil {
+		return "", err
+	}
+
+	if !validTable(shard) {
+		return "", ErrIdentifier
+	}
+
+	return shard, nil
+}
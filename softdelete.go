@@ -0,0 +1,220 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Unscoped returns a copy of the gateway whose reads include soft deleted rows
+func (g *Gateway) Unscoped() *Gateway {
+	ug := *g
+	ug.unscoped = true
+	return &ug
+}
+
+// Restore clears the soft delete marker of entity
+func (g *Gateway) Restore(dest interface{}) error {
+	return g.RestoreContext(context.Background(), dest)
+}
+
+// RestoreContext is like Restore but runs with given context
+func (g *Gateway) RestoreContext(ctx context.Context, dest interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if destcfg.SoftDelete == "" {
+		return ErrNoSoftDelete
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	q, args := buildMarkDeleted(table, dest, destcfg, nil)
+
+	q, args, err = g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opUpdate, table, q, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	f := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[destcfg.SoftDelete])
+	f.Set(reflect.Zero(f.Type()))
+
+	g.changed(opUpdate, dest)
+
+	return nil
+}
+
+// HardDelete removes entity from database even if it supports soft deletes
+func (g *Gateway) HardDelete(dest interface{}) error {
+	return g.HardDeleteContext(context.Background(), dest)
+}
+
+// HardDeleteContext is like HardDelete but runs with given context
+func (g *Gateway) HardDeleteContext(ctx context.Context, dest interface{}) error {
+
+	if g.audit != "" {
+		return g.audited(ctx, AuditDelete, dest, func(ag *Gateway) error {
+			return ag.HardDeleteContext(ctx, dest)
+		})
+	}
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := runHook(ctx, hookBeforeDelete, dest); err != nil {
+		return err
+	}
+
+	q, args := buildDelete(table, dest, withoutSoftDelete(destcfg))
+
+	q, args, err = g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opDelete, table, q, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	g.changed(opDelete, dest)
+
+	return runHook(ctx, hookAfterDelete, dest)
+}
+
+// readMeta returns the metadata used for reading entities, which ignores the
+// soft delete column on unscoped gateways
+func (g *Gateway) readMeta(destcfg *tabMeta) *tabMeta {
+	if g.unscoped {
+		return withoutSoftDelete(destcfg)
+	}
+	return destcfg
+}
+
+// withoutSoftDelete returns a copy of destcfg without soft delete column
+func withoutSoftDelete(destcfg *tabMeta) *tabMeta {
+	m := *destcfg
+	m.SoftDelete = ""
+	return &m
+}
+
+// WithSoftDeleteColumn names the soft delete column of the gateways table,
+// used to skip soft deleted rows in reads not bound to an entity like Count,
+// Exists, Pluck, Sum or Query.Count. Gateways created by NewGatewayFor or a
+// Registry take it from the entity.
+func WithSoftDeleteColumn(col string) Option {
+	return func(g *Gateway) error {
+		if col != "" && !validIdent(col) {
+			return ErrOption
+		}
+		g.softCol = col
+		return nil
+	}
+}
+
+// defaultSoftDelete sets the soft delete column of the gateway to the one of
+// the entity type dest refers to unless it was named already
+func (g *Gateway) defaultSoftDelete(dest interface{}) {
+	if g.softCol != "" {
+		return
+	}
+	if m, err := structMeta(baseType(reflect.TypeOf(dest))); err == nil {
+		g.softCol = m.SoftDelete
+	}
+}
+
+// readScope limits params of reads not bound to an entity to the tenant of
+// the gateway and skips soft deleted rows unless the gateway is unscoped
+func (g *Gateway) readScope(params Condition) (Condition, error) {
+
+	params, err := g.scope(params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if col := g.softDeleteCol(nil); col != "" {
+		return restrict(params, Selectors{col: IsNull}), nil
+	}
+
+	return params, nil
+}
+
+// softDeleteCol returns the soft delete column of the entity type dest refers
+// to or an empty string if it has none or the gateway is unscoped. A nil dest
+// refers to the gateways table, see WithSoftDeleteColumn.
+func (g *Gateway) softDeleteCol(dest interface{}) string {
+	if g.unscoped {
+		return ""
+	}
+	if dest == nil {
+		return g.softCol
+	}
+	t := baseType(reflect.TypeOf(dest))
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	m, err := structMeta(t)
+	if err != nil {
+		return ""
+	}
+	return m.SoftDelete
+}
+
+// withoutDeleted extends given WHERE clause to skip rows whose soft delete
+// column col is set. An empty col leaves the clause untouched.
+func withoutDeleted(where, col string) string {
+	if col == "" {
+		return where
+	}
+	cond := fmt.Sprintf("`%s` IS NULL", col)
+	if where == "" {
+		return " WHERE " + cond
+	}
+	return where + " AND " + cond
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testSoft is an entity with a soft delete column
+type testSoft struct {
+	ID        uint64     `db:"id" tgw:"primary"`
+	Grp       string     `db:"grp" tgw:"insert,update"`
+	Score     int        `db:"score" tgw:"insert,update"`
+	DeletedAt *time.Time `db:"deleted_at" tgw:"softdelete"`
+}
+
+func (testSoft) TableName() string { return "soft" }
+
+// testSofts creates the table of testSoft
+const testSofts = "CREATE TABLE soft (id INTEGER PRIMARY KEY AUTOINCREMENT, grp TEXT, score INTEGER, deleted_at DATETIME)"
+
+// testSoftGateway returns a gateway holding the rows a/1, a/2 and b/3 of
+// testSoft, the second one soft deleted
+func testSoftGateway(t *testing.T, opts ...Option) (*Gateway, func(where string) int) {
+
+	t.Helper()
+
+	db := testDB(t, testSofts)
+	g, err := NewGatewayFor(db, &testSoft{}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCreate(t, g, &testSoft{Grp: "a", Score: 1}, &testSoft{Grp: "a", Score: 2}, &testSoft{Grp: "b", Score: 3})
+	if err := g.Delete(&testSoft{ID: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	return g, func(where string) int { return testCount(t, db, "soft", where) }
+}
+
+// TestSoftDeleteReads checks that reads skip soft deleted rows unless the
+// gateway is unscoped
+func TestSoftDeleteReads(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		read     func(g *Gateway) (int, error)
+		scoped   int
+		unscoped int
+	}{
+		{"read", func(g *Gateway) (int, error) {
+			err := g.Read(&testSoft{ID: 2})
+			if errors.Is(err, ErrNotFound) {
+				return 0, nil
+			}
+			return 1, err
+		}, 0, 1},
+		{"read many", func(g *Gateway) (int, error) {
+			var rs []testSoft
+			err := g.ReadMany(&rs, []interface{}{1, 2})
+			return len(rs), err
+		}, 1, 2},
+		{"select", func(g *Gateway) (int, error) {
+			var rs []testSoft
+			err := g.Select(&rs, Selectors{"grp": "a"}, nil)
+			return len(rs), err
+		}, 1, 2},
+		{"select one", func(g *Gateway) (int, error) {
+			err := g.SelectOne(&testSoft{}, Selectors{"score": 2}, nil)
+			if errors.Is(err, ErrNotFound) {
+				return 0, nil
+			}
+			return 1, err
+		}, 0, 1},
+		{"count", func(g *Gateway) (int, error) {
+			n, err := g.Count(Selectors{"grp": "a"})
+			return int(n), err
+		}, 1, 2},
+		{"count all", func(g *Gateway) (int, error) {
+			n, err := g.Count(nil)
+			return int(n), err
+		}, 2, 3},
+		{"exists", func(g *Gateway) (int, error) {
+			ok, err := g.Exists(Selectors{"score": 2})
+			if ok {
+				return 1, err
+			}
+			return 0, err
+		}, 0, 1},
+		{"sum", func(g *Gateway) (int, error) {
+			s, err := g.Sum("score", nil)
+			return int(s), err
+		}, 4, 6},
+		{"pluck", func(g *Gateway) (int, error) {
+			var scores []int
+			err := g.Pluck("score", &scores, nil)
+			return len(scores), err
+		}, 2, 3},
+		{"query count", func(g *Gateway) (int, error) {
+			n, err := g.Query().Where(Selectors{"score >": 0}).Count()
+			return int(n), err
+		}, 2, 3},
+		{"group by", func(g *Gateway) (int, error) {
+			var groups []struct {
+				Grp string `db:"grp"`
+				N   int    `db:"n"`
+			}
+			err := g.GroupBy(&groups, Grouping{
+				Columns:    []string{"grp"},
+				Aggregates: []Aggregate{{Func: "COUNT", Column: "*", Alias: "n"}},
+			}, Selectors{"grp": "a"}, nil)
+			if err != nil || len(groups) != 1 {
+				return 0, err
+			}
+			return groups[0].N, nil
+		}, 1, 2},
+		{"paginate", func(g *Gateway) (int, error) {
+			var rs []testSoft
+			n, err := g.Paginate(&rs, nil, nil, 1, 10)
+			if int(n) != len(rs) {
+				return -1, err
+			}
+			return len(rs), err
+		}, 2, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, _ := testSoftGateway(t)
+			if n, err := tc.read(g); err != nil || n != tc.scoped {
+				t.Errorf("scoped = %d, %v, want %d", n, err, tc.scoped)
+			}
+			if n, err := tc.read(g.Unscoped()); err != nil || n != tc.unscoped {
+				t.Errorf("unscoped = %d, %v, want %d", n, err, tc.unscoped)
+			}
+		})
+	}
+}
+
+// TestSoftDeleteWrites checks that deletes mark rows instead of removing them
+// and that writes leave soft deleted rows alone
+func TestSoftDeleteWrites(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		write   func(g *Gateway) (int64, error)
+		n       int64
+		deleted int
+		rows    int
+	}{
+		{"delete", func(g *Gateway) (int64, error) {
+			s := testSoft{ID: 1}
+			if err := g.Delete(&s); err != nil || s.DeletedAt == nil {
+				return 0, err
+			}
+			return 1, nil
+		}, 1, 2, 3},
+		{"delete where", func(g *Gateway) (int64, error) {
+			return g.DeleteWhere(Selectors{"grp": "a"})
+		}, 1, 2, 3},
+		{"delete by ids", func(g *Gateway) (int64, error) {
+			return g.DeleteByIDs(&testSoft{}, 1, 2, 3)
+		}, 2, 3, 3},
+		{"update where", func(g *Gateway) (int64, error) {
+			return g.UpdateWhere(map[string]interface{}{"grp": "c"}, Selectors{"grp": "a"})
+		}, 1, 1, 3},
+		{"hard delete", func(g *Gateway) (int64, error) {
+			return 1, g.HardDelete(&testSoft{ID: 2})
+		}, 1, 0, 2},
+		{"truncate", func(g *Gateway) (int64, error) {
+			return 0, g.Truncate()
+		}, 0, 0, 0},
+		{"restore", func(g *Gateway) (int64, error) {
+			s := testSoft{ID: 2, DeletedAt: &time.Time{}}
+			if err := g.Restore(&s); err != nil || s.DeletedAt != nil {
+				return 0, err
+			}
+			return 1, nil
+		}, 1, 0, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g, count := testSoftGateway(t, WithDeleteAll())
+			if n, err := tc.write(g); err != nil || n != tc.n {
+				t.Fatalf("write = %d, %v, want %d", n, err, tc.n)
+			}
+			if n := count("deleted_at IS NOT NULL"); n != tc.deleted {
+				t.Errorf("%d rows marked deleted, want %d", n, tc.deleted)
+			}
+			if n := count("1 = 1"); n != tc.rows {
+				t.Errorf("%d rows left, want %d", n, tc.rows)
+			}
+		})
+	}
+}
+
+// TestSoftDeleteTwice checks that deleting a soft deleted row again does not
+// move its marker and counts as missing
+func TestSoftDeleteTwice(t *testing.T) {
+
+	g, count := testSoftGateway(t, WithAffectedCheck())
+
+	if err := g.Delete(&testSoft{ID: 2}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete() = %v, want ErrNotFound", err)
+	}
+
+	if n := count("deleted_at IS NOT NULL"); n != 1 {
+		t.Errorf("%d rows marked deleted, want 1", n)
+	}
+}
+
+// TestRestoreNoSoftDelete checks that only entities with a soft delete
+// column can be restored
+func TestRestoreNoSoftDelete(t *testing.T) {
+	g := testGateway(t, testDB(t, testUsers), "users")
+	if err := g.Restore(&testUser{ID: 1}); !errors.Is(err, ErrNoSoftDelete) {
+		t.Fatalf("Restore() = %v, want ErrNoSoftDelete", err)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"container/list"
+	"context"
+	"github.com/jmoiron/sqlx"
+	"sync"
+)
+
+// stmtCache holds prepared statements by their query string. If size is set
+// the least recently used statements are closed once it is exceeded.
+type stmtCache struct {
+	mu    sync.Mutex
+	size  int
+	stmts map[string]*stmtEntry
+	lru   *list.List
+}
+
+// stmtEntry is a cached statement. Statements in use when being evicted are
+// closed by the last user.
+type stmtEntry struct {
+	s       *sqlx.Stmt
+	elem    *list.Element
+	refs    int
+	evicted bool
+}
+
+// WithStmtCache enables caching of prepared statements. Statements are
+// prepared lazily on first use and reused afterwards, call Close to release
+// them.
+func WithStmtCache() Option {
+	return WithStmtCacheSize(0)
+}
+
+// WithStmtCacheSize is like WithStmtCache but keeps at most size statements,
+// closing the least recently used ones. A size of zero means no limit. The
+// connection must be able to prepare statements.
+func WithStmtCacheSize(size int) Option {
+	return func(g *Gateway) error {
+		if _, ok := g.ext.(sqlx.PreparerContext); size < 0 || !ok {
+			return ErrOption
+		}
+		g.stmts = newStmtCache(size)
+		return nil
+	}
+}
+
+// newStmtCache returns an empty cache keeping at most size statements
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		stmts: map[string]*stmtEntry{},
+		lru:   list.New(),
+	}
+}
+
+// Close releases all cached prepared statements
+func (g *Gateway) Close() error {
+
+	if g.stmts == nil {
+		return nil
+	}
+
+	err := g.stmts.close()
+
+	if g.replicas != nil {
+		for _, r := range g.replicas.replicas {
+			if r.stmts == nil {
+				continue
+			}
+			if cerr := r.stmts.close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+
+	return err
+}
+
+// close evicts and closes all cached statements
+func (c *stmtCache) close() error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for q, e := range c.stmts {
+		if cerr := c.evict(q, e); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// stmt returns the cached statement for q, preparing it if needed, and a
+// function to call once the statement was used. Inside a transaction already
+// cached statements are bound to it, others are prepared on the transaction
+// only, as preparing on the pool may need a second connection.
+func (g *Gateway) stmt(ctx context.Context, q string) (*sqlx.Stmt, func(), error) {
+
+	if g.tx == nil {
+		return g.cachedStmt(ctx, q)
+	}
+
+	if e := g.stmts.acquire(q); e != nil {
+		return g.tx.StmtxContext(ctx, e.s), func() { g.stmts.release(e) }, nil
+	}
+
+	s, err := g.tx.PreparexContext(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, func() {}, nil
+}
+
+// cachedStmt returns the cached statement for q, preparing it if needed
+func (g *Gateway) cachedStmt(ctx context.Context, q string) (*sqlx.Stmt, func(), error) {
+
+	if e := g.stmts.acquire(q); e != nil {
+		return e.s, func() { g.stmts.release(e) }, nil
+	}
+
+	s, err := sqlx.PreparexContext(ctx, g.ext.(sqlx.PreparerContext), q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := g.stmts
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another goroutine may have been faster
+	if e, ok := c.stmts[q]; ok {
+		_ = s.Close()
+		e.refs++
+		c.lru.MoveToFront(e.elem)
+		return e.s, func() { c.release(e) }, nil
+	}
+
+	e := &stmtEntry{s: s, refs: 1}
+	e.elem = c.lru.PushFront(q)
+	c.stmts[q] = e
+
+	if c.size > 0 && c.lru.Len() > c.size {
+		old := c.lru.Back()
+		_ = c.evict(old.Value.(string), c.stmts[old.Value.(string)])
+	}
+
+	return s, func() { c.release(e) }, nil
+}
+
+// acquire returns the cached entry for q marked as in use or nil
+func (c *stmtCache) acquire(q string) *stmtEntry {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.stmts[q]
+	if !ok {
+		return nil
+	}
+
+	e.refs++
+	c.lru.MoveToFront(e.elem)
+
+	return e
+}
+
+// release marks a use of entry as finished, closing it if it was evicted
+func (c *stmtCache) release(e *stmtEntry) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.refs--
+	if e.evicted && e.refs == 0 {
+		_ = e.s.Close()
+	}
+}
+
+// evict removes entry of q from the cache and closes it unless it is in use.
+// The caller must hold the lock.
+func (c *stmtCache) evict(q string, e *stmtEntry) error {
+
+	delete(c.stmts, q)
+	c.lru.Remove(e.elem)
+	e.evicted = true
+
+	if e.refs > 0 {
+		return nil
+	}
+
+	return e.s.Close()
+}
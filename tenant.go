@@ -0,0 +1,159 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"reflect"
+)
+
+// ForTenant returns a copy of the gateway bound to tenant id. All its queries
+// only see and change rows whose tenant column holds id and entities written
+// get id set in their field tagged tenant, which must also be tagged insert.
+// Queries not bound to an entity like Count need WithTenantColumn. Upserts
+// can not be limited to the tenant, keep primary keys unique across tenants.
+func (g *Gateway) ForTenant(id interface{}) *Gateway {
+	tg := *g
+	tg.tenant = id
+	return &tg
+}
+
+// WithTenantColumn names the tenant column of the gateways table, used by
+// queries not bound to an entity like Count or DeleteWhere and by entities
+// without a field tagged tenant
+func WithTenantColumn(col string) Option {
+	return func(g *Gateway) error {
+		if col != "" && !validIdent(col) {
+			return ErrOption
+		}
+		g.tenantCol = col
+		return nil
+	}
+}
+
+// tenantColumn returns the tenant column for entities described by destcfg,
+// which may be nil for queries not bound to an entity
+func (g *Gateway) tenantColumn(destcfg *tabMeta) string {
+	if destcfg != nil && destcfg.Tenant != "" {
+		return destcfg.Tenant
+	}
+	return g.tenantCol
+}
+
+// tenantCond returns the condition limiting queries to the tenant of the
+// gateway or nil if it is not bound to one
+func (g *Gateway) tenantCond(destcfg *tabMeta) (Condition, error) {
+
+	if g.tenant == nil {
+		return nil, nil
+	}
+
+	col := g.tenantColumn(destcfg)
+	if col == "" {
+		return nil, ErrNoTenant
+	}
+
+	return Selectors{col: g.tenant}, nil
+}
+
+// tenantCondFor is like tenantCond for the entity type dest refers to
+func (g *Gateway) tenantCondFor(dest interface{}) (Condition, error) {
+
+	if g.tenant == nil {
+		return nil, nil
+	}
+
+	var destcfg *tabMeta
+	if t := baseType(reflect.TypeOf(dest)); t.Kind() == reflect.Struct {
+		m, err := structMeta(t)
+		if err != nil {
+			return nil, err
+		}
+		destcfg = m
+	}
+
+	return g.tenantCond(destcfg)
+}
+
+// scope limits params to the tenant of the gateway for entities described by
+// destcfg, which may be nil for queries not bound to an entity
+func (g *Gateway) scope(params Condition, destcfg *tabMeta) (Condition, error) {
+	tc, err := g.tenantCond(destcfg)
+	if err != nil || tc == nil {
+		return params, err
+	}
+	return restrict(params, tc), nil
+}
+
+// scopeFor is like scope for the entity type dest refers to
+func (g *Gateway) scopeFor(params Condition, dest interface{}) (Condition, error) {
+	tc, err := g.tenantCondFor(dest)
+	if err != nil || tc == nil {
+		return params, err
+	}
+	return restrict(params, tc), nil
+}
+
+// restrict combines params with condition c, like the tenant condition.
+// Params are grouped so raw sql holding an OR can not widen the result beyond
+// c.
+func restrict(params, c Condition) Condition {
+	if params == nil {
+		return c
+	}
+	return And(grouped{params}, c)
+}
+
+// grouped wraps a condition in parentheses
+type grouped struct {
+	c Condition
+}
+
+// condition implements Condition
+func (gr grouped) condition(col func(string) string) (string, []interface{}) {
+	t, args := gr.c.condition(col)
+	if t == "" {
+		return t, args
+	}
+	return "(" + t + ")", args
+}
+
+// setTenant writes the tenant of the gateway to the tenant field of entity
+func (g *Gateway) setTenant(dest interface{}, destcfg *tabMeta) error {
+
+	if g.tenant == nil {
+		return nil
+	}
+
+	idx, ok := destcfg.Fields[g.tenantColumn(destcfg)]
+	if !ok {
+		return ErrNoTenant
+	}
+
+	return setField(reflect.ValueOf(dest).Elem().FieldByIndex(idx), g.tenant)
+}
+
+// scoped appends the tenant condition for entities described by destcfg to
+// query q ending with its WHERE clause
+func (g *Gateway) scoped(q string, args []interface{}, destcfg *tabMeta) (string, []interface{}, error) {
+
+	tc, err := g.tenantCond(destcfg)
+	if err != nil || tc == nil {
+		return q, args, err
+	}
+
+	cond, cargs := tc.condition(quoteColumn)
+
+	return q + " AND " + cond, append(args, cargs...), nil
+}
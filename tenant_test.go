@@ -0,0 +1,152 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"testing"
+)
+
+// testDoc is an entity with a tenant column
+type testDoc struct {
+	ID     int64  `db:"id" tgw:"primary"`
+	Tenant int64  `db:"tenant_id" tgw:"insert,tenant"`
+	Title  string `db:"title" tgw:"insert,update"`
+}
+
+// testDocs creates the table of testDoc
+const testDocs = "CREATE TABLE docs (id INTEGER PRIMARY KEY AUTOINCREMENT, tenant_id INTEGER, title TEXT)"
+
+// TestTenantScope checks that a gateway bound to a tenant neither sees nor
+// changes the rows of other tenants
+func TestTenantScope(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		run   func(g *Gateway) (int64, error)
+		n     int64
+		other int
+	}{
+		{"read", func(g *Gateway) (int64, error) {
+			err := g.Read(&testDoc{ID: 1})
+			if errors.Is(err, ErrNotFound) {
+				return 0, nil
+			}
+			return 1, err
+		}, 0, 1},
+		{"select raw or", func(g *Gateway) (int64, error) {
+			var docs []testDoc
+			err := g.Select(&docs, Raw("1 = 1 OR 1 = 1"), nil)
+			return int64(len(docs)), err
+		}, 1, 1},
+		{"count", func(g *Gateway) (int64, error) {
+			return g.Count(nil)
+		}, 1, 1},
+		{"pluck", func(g *Gateway) (int64, error) {
+			var titles []string
+			err := g.Pluck("title", &titles, nil)
+			return int64(len(titles)), err
+		}, 1, 1},
+		{"query", func(g *Gateway) (int64, error) {
+			var docs []testDoc
+			err := g.Query().All(&docs)
+			return int64(len(docs)), err
+		}, 1, 1},
+		{"update", func(g *Gateway) (int64, error) {
+			d := testDoc{ID: 1, Title: "x"}
+			if err := g.Update(&d); err != nil || d.Tenant != 2 {
+				return 0, err
+			}
+			return 1, nil
+		}, 1, 1},
+		{"update where", func(g *Gateway) (int64, error) {
+			return g.UpdateWhere(map[string]interface{}{"title": "x"}, Selectors{"title": "a"})
+		}, 0, 1},
+		{"delete", func(g *Gateway) (int64, error) {
+			return 1, g.Delete(&testDoc{ID: 1})
+		}, 1, 1},
+		{"delete where", func(g *Gateway) (int64, error) {
+			return g.DeleteWhere(Selectors{"title": "a"})
+		}, 0, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := testDB(t, testDocs)
+			g := testGateway(t, db, "docs", WithTenantColumn("tenant_id"))
+			a, b := g.ForTenant(int64(1)), g.ForTenant(int64(2))
+
+			docA, docB := testDoc{Title: "a"}, testDoc{Title: "b"}
+			testCreate(t, a, &docA)
+			testCreate(t, b, &docB)
+			if docA.Tenant != 1 || docB.Tenant != 2 {
+				t.Fatalf("tenants = %d, %d, want 1, 2", docA.Tenant, docB.Tenant)
+			}
+
+			if n, err := tc.run(b); err != nil || n != tc.n {
+				t.Fatalf("run = %d, %v, want %d", n, err, tc.n)
+			}
+			if n := testCount(t, db, "docs", "tenant_id = 1 AND title = 'a'"); n != tc.other {
+				t.Errorf("%d rows of the other tenant left, want %d", n, tc.other)
+			}
+		})
+	}
+}
+
+// TestNoTenant checks that binding a gateway to a tenant needs a tenant
+// column to scope by
+func TestNoTenant(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts []Option
+		run  func(g *Gateway) error
+	}{
+		{"count without column", nil, func(g *Gateway) error {
+			_, err := g.Count(nil)
+			return err
+		}},
+		{"select without column", nil, func(g *Gateway) error {
+			var users []testUser
+			return g.Select(&users, nil, nil)
+		}},
+		{"delete where without column", nil, func(g *Gateway) error {
+			_, err := g.DeleteWhere(Selectors{"name": "a"})
+			return err
+		}},
+		{"create without field", []Option{WithTenantColumn("tenant_id")}, func(g *Gateway) error {
+			return g.Create(&testUser{Name: "a"})
+		}},
+		{"create many without field", []Option{WithTenantColumn("tenant_id")}, func(g *Gateway) error {
+			return g.CreateMany(&[]testUser{{Name: "a"}}, 0)
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := testGateway(t, testDB(t, testUsers), "users", tc.opts...)
+			if err := tc.run(g.ForTenant(1)); !errors.Is(err, ErrNoTenant) {
+				t.Fatalf("err = %v, want ErrNoTenant", err)
+			}
+		})
+	}
+}
+
+// TestWithTenantColumn checks the validation of the tenant column option
+func TestWithTenantColumn(t *testing.T) {
+	if _, err := NewGateway(testDB(t), "docs", WithTenantColumn("tenant id")); !errors.Is(err, ErrOption) {
+		t.Fatalf("NewGateway() = %v, want ErrOption", err)
+	}
+}
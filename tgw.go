@@ -15,11 +15,17 @@
 package tgw
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"reflect"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Struct tags
@@ -29,185 +35,1303 @@ const (
 	tgwPrimary = "primary"
 	tgwInsert  = "insert"
 	tgwUpdate  = "update"
+	tgwNoAuto  = "noauto"
+	tgwOmit    = "omitempty"
+	tgwJSON    = "json"
+	tgwEncrypt = "encrypted"
+	tgwTable   = "table="
+	tgwSoft    = "softdelete"
+	tgwCreated = "created"
+	tgwUpdated = "updated"
+	tgwVersion = "version"
+	tgwTenant  = "tenant"
+	tgwType    = "type="
+	tgwNotNull = "notnull"
+	tgwDefault = "default="
+	tgwEnum    = "enum="
+	tgwFTS     = "fulltext"
 )
 
 // Gateway is the main struct
 type Gateway struct {
-	dbx   *sqlx.DB
-	table string
+	dbx        *sqlx.DB
+	ext        sqlx.ExtContext
+	tx         *sqlx.Tx
+	dialect    Dialect
+	table      string
+	timeout    time.Duration
+	stmts      *stmtCache
+	observer   Observer
+	idgen      IDGenerator
+	unscoped   bool
+	softCol    string
+	srvtime    bool
+	affected   bool
+	prefix     string
+	schema     string
+	tenant     interface{}
+	tenantCol  string
+	shard      ShardResolver
+	shardKey   interface{}
+	replicas   *replicaSet
+	pin        time.Duration
+	retries    *RetryPolicy
+	logger     Logger
+	slow       time.Duration
+	slowLog    Logger
+	tracer     Tracer
+	returning  []string
+	lock       LockMode
+	deleteAll  bool
+	preload    []string
+	cipher     Cipher
+	audit      string
+	onChange   []func(Event)
+	changes    *changeQueue
+	cache      *readCache
+	cacheMiss  time.Duration
+	validators []func(context.Context, interface{}) error
+	loc        *time.Location
+	readOnly   bool
+	indexHint  *indexHint
+	hints      []string
 }
 
-// Selectors holds query parameters for simple selects
+// Reader covers the reading entity operations of a Gateway, see
+// NewReadOnlyGateway
+type Reader interface {
+	Read(dest interface{}) error
+	ReadContext(ctx context.Context, dest interface{}) error
+	ReadMany(dest interface{}, ids []interface{}) error
+	ReadManyContext(ctx context.Context, dest interface{}, ids []interface{}) error
+	ReadByIDs(dest interface{}, ids ...interface{}) error
+	ReadByIDsContext(ctx context.Context, dest interface{}, ids ...interface{}) error
+	Select(dest interface{}, params Condition, orderby Orderer) error
+	SelectContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer) error
+	SelectOne(dest interface{}, params Condition, orderby Orderer) error
+	SelectOneContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer) error
+	Count(params Condition) (int64, error)
+	CountContext(ctx context.Context, params Condition) (int64, error)
+	Exists(params Condition) (bool, error)
+	ExistsContext(ctx context.Context, params Condition) (bool, error)
+}
+
+// Gatewayer covers the entity operations of a Gateway. Code depending on it
+// instead of *Gateway can be tested against a MemGateway.
+type Gatewayer interface {
+	Reader
+	Create(dest interface{}) error
+	CreateContext(ctx context.Context, dest interface{}) error
+	CreateMany(dest interface{}, chunkSize int) error
+	CreateManyContext(ctx context.Context, dest interface{}, chunkSize int) error
+	Upsert(dest interface{}) error
+	UpsertContext(ctx context.Context, dest interface{}) error
+	CreateIgnore(dest interface{}) (bool, error)
+	CreateIgnoreContext(ctx context.Context, dest interface{}) (bool, error)
+	Replace(dest interface{}) (bool, error)
+	ReplaceContext(ctx context.Context, dest interface{}) (bool, error)
+	Update(dest interface{}) error
+	UpdateContext(ctx context.Context, dest interface{}) error
+	UpdatePartial(dest interface{}, cols ...string) error
+	UpdatePartialContext(ctx context.Context, dest interface{}, cols ...string) error
+	UpdateColumns(dest interface{}, cols ...string) error
+	UpdateColumnsContext(ctx context.Context, dest interface{}, cols ...string) error
+	Increment(dest interface{}, column string, delta int64) error
+	IncrementContext(ctx context.Context, dest interface{}, column string, delta int64) error
+	Patch(dest interface{}, id interface{}, changes map[string]interface{}) error
+	PatchContext(ctx context.Context, dest interface{}, id interface{}, changes map[string]interface{}) error
+	Delete(dest interface{}) error
+	DeleteContext(ctx context.Context, dest interface{}) error
+	DeleteByIDs(dest interface{}, ids ...interface{}) (int64, error)
+	DeleteByIDsContext(ctx context.Context, dest interface{}, ids ...interface{}) (int64, error)
+	DeleteWhere(params Condition) (int64, error)
+	DeleteWhereContext(ctx context.Context, params Condition) (int64, error)
+}
+
+// compile time check of the implementation
+var _ Gatewayer = (*Gateway)(nil)
+
+// TableNamer can be implemented by entities to provide their own table name
+type TableNamer interface {
+	TableName() string
+}
+
+// insertMode selects how an INSERT handles rows conflicting with existing ones
+type insertMode int
+
+// Insert modes
+const (
+	insertPlain insertMode = iota
+	insertUpsert
+	insertIgnore
+	insertReplace
+)
+
+// Selectors holds query parameters for simple selects. Keys are column names,
+// optionally followed by an operator like "age >=", "name LIKE" or
+// "status IN", which expands slice values. Without operator columns are
+// compared for equality, the value IsNull or IsNotNull checks for NULL. Nil,
+// nil pointers and invalid sql.Null* values compared with "=" or "!=" check
+// for NULL too.
 type Selectors map[string]interface{}
 
-// OrderBy holds ordering informations for queries
-type OrderBy map[string]string
+// OrderBy holds ordering informations for queries. As maps are unordered the
+// columns are sorted by name, use Sorts to order by multiple columns.
+type OrderBy map[string]string
+
+// tabMeta stores informations about given struct
+type tabMeta struct {
+	PrimaryNames []string
+	PrimaryDBs   []string
+	PrimaryIdx   [][]int
+	NoAuto       bool
+	Generate     string
+	InsertCols   []string
+	UpdateCols   []string
+	OmitEmpty    []string
+	JSONCols     []string
+	Encrypted    []string
+	FullText     []string
+	SoftDelete   string
+	Created      string
+	Updated      string
+	NowCols      []string
+	Version      string
+	Tenant       string
+	Nested       bool
+	Mapped       bool
+	Fields       map[string][]int
+	Defaults     map[string]string
+	Enums        map[string][]string
+}
+
+// Errors...
+var (
+	ErrStructConfig = errors.New("invalid or incomplete tags for given struct")
+	ErrNoPrimary    = errors.New("no primary key found")
+	// Deprecated: composite primary keys are supported and ErrMultiPrimary is
+	// no longer returned
+	ErrMultiPrimary = errors.New("multiple primary keys not yet supported")
+	ErrNoTable      = errors.New("no table name given or found")
+	ErrIdentifier   = errors.New("invalid identifier")
+	ErrUnknownCol   = errors.New("unknown or not updatable column")
+	ErrOption       = errors.New("invalid gateway option")
+	ErrNotFound     = errors.New("entity not found")
+	ErrPage         = errors.New("invalid page or page size")
+	ErrSchema       = errors.New("struct does not match table schema")
+	ErrNoTx         = errors.New("gateway is not bound to a transaction")
+	ErrTxActive     = errors.New("gateway is already bound to a transaction")
+	ErrNoBegin      = errors.New("connection cannot begin transactions")
+	ErrPrimaryType  = errors.New("value does not fit the primary key type")
+	ErrBatchKeys    = errors.New("entities of a batch must all have or all lack primary keys")
+	ErrNoSoftDelete = errors.New("entity has no soft delete column")
+	ErrStaleObject  = errors.New("entity was changed or removed concurrently")
+	ErrNoTenant     = errors.New("no tenant column known for tenant bound gateway")
+	ErrNoShard      = errors.New("sharded query needs a gateway bound to a shard")
+	ErrShardMix     = errors.New("batch entities belong to different shards")
+	ErrDuplicate    = errors.New("entity with same primary key exists")
+	ErrUnsupported  = errors.New("operation not supported by in-memory gateway")
+	ErrOrder        = errors.New("invalid ordering column or direction")
+	ErrNotAllowed   = errors.New("changing all rows requires WithDeleteAll")
+	ErrColumnType   = errors.New("no sql type known for field, add a type tag")
+	ErrNoPreparer   = errors.New("database handle does not support prepared statements")
+	ErrRelation     = errors.New("unknown or invalid relation")
+	ErrNoCipher     = errors.New("encrypted column needs a gateway cipher")
+	ErrCipher       = errors.New("can not encrypt or decrypt column")
+	ErrValidation   = errors.New("entity failed validation")
+	ErrEnum         = errors.New("value not allowed for enum column")
+	ErrReadOnly     = errors.New("gateway is read-only")
+	ErrHint         = errors.New("invalid index or optimizer hint")
+	ErrNoFullText   = errors.New("entity has no columns tagged fulltext")
+	ErrRegistered   = errors.New("entity type already registered")
+	ErrUnregistered = errors.New("entity type not registered")
+)
+
+// notFoundError matches ErrNotFound and unwraps to sql.ErrNoRows
+type notFoundError struct{}
+
+func (notFoundError) Error() string        { return ErrNotFound.Error() }
+func (notFoundError) Is(target error) bool { return target == ErrNotFound }
+func (notFoundError) Unwrap() error        { return sql.ErrNoRows }
+
+// identRe matches plain sql identifiers safe to be used in queries
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Types of fields holding a single column value despite being structs
+var (
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// NewGateway returns a new instance of Gateway. The table may be left empty,
+// if entities provide their own name via TableNamer or a table tag. Besides a
+// *sqlx.DB any sqlx.ExtContext is accepted, like a wrapped connection or a
+// mock. A *sqlx.Tx binds the gateway to that transaction. Other connections
+// can only start transactions if they provide a BeginTxx method.
+func NewGateway(dbconn sqlx.ExtContext, table string, opts ...Option) (*Gateway, error) {
+
+	g := &Gateway{
+		table:   table,
+		ext:     dbconn,
+		dialect: dialectFor(dbconn.DriverName()),
+	}
+
+	switch c := dbconn.(type) {
+	case *sqlx.DB:
+		g.dbx = c
+	case *sqlx.Tx:
+		g.tx = c
+	}
+
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// NewGatewayFor returns a new Gateway for the table of given entity, named by
+// its TableNamer method or table tag. Without either the snake cased plural
+// of the type name is used, so User maps to users.
+func NewGatewayFor(dbconn sqlx.ExtContext, entity interface{}, opts ...Option) (*Gateway, error) {
+
+	g, err := NewGateway(dbconn, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := g.rawTableName(entity)
+	if errors.Is(err, ErrNoTable) {
+		table, err = pluralSnake(baseType(reflect.TypeOf(entity)).Name()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !validTable(table) {
+		return nil, ErrNoTable
+	}
+
+	g.table = table
+	g.defaultSoftDelete(entity)
+
+	return g, nil
+}
+
+// Create writes entity to database. Columns tagged omitempty holding the zero
+// value, like a nil pointer, are skipped and get the default of the database.
+// Other nil pointers and invalid sql.Null* values are written as NULL.
+func (g *Gateway) Create(dest interface{}) error {
+	return g.CreateContext(context.Background(), dest)
+}
+
+// CreateContext is like Create but runs with given context
+func (g *Gateway) CreateContext(ctx context.Context, dest interface{}) error {
+	return g.insert(ctx, dest, insertPlain)
+}
+
+// Upsert writes entity to database or updates its update columns if a row
+// with the same key already exists
+func (g *Gateway) Upsert(dest interface{}) error {
+	return g.UpsertContext(context.Background(), dest)
+}
+
+// UpsertContext is like Upsert but runs with given context
+func (g *Gateway) UpsertContext(ctx context.Context, dest interface{}) error {
+	_, err := g.insertWith(ctx, dest, insertUpsert)
+	return err
+}
+
+// CreateIgnore writes entity to database unless it conflicts with an existing
+// row, using INSERT IGNORE on MySQL and ON CONFLICT DO NOTHING elsewhere. It
+// reports whether the row was written.
+func (g *Gateway) CreateIgnore(dest interface{}) (bool, error) {
+	return g.CreateIgnoreContext(context.Background(), dest)
+}
+
+// CreateIgnoreContext is like CreateIgnore but runs with given context
+func (g *Gateway) CreateIgnoreContext(ctx context.Context, dest interface{}) (bool, error) {
+	return g.insertWith(ctx, dest, insertIgnore)
+}
+
+// Replace writes entity to database, replacing all insert columns of a
+// conflicting row. MySQL and SQLite use REPLACE INTO, which deletes the old
+// row first, PostgreSQL updates it. It reports whether a row was written.
+func (g *Gateway) Replace(dest interface{}) (bool, error) {
+	return g.ReplaceContext(context.Background(), dest)
+}
+
+// ReplaceContext is like Replace but runs with given context
+func (g *Gateway) ReplaceContext(ctx context.Context, dest interface{}) (bool, error) {
+	return g.insertWith(ctx, dest, insertReplace)
+}
+
+// insert writes entity to database handling conflicts according to mode and
+// runs its create hooks
+func (g *Gateway) insert(ctx context.Context, dest interface{}, mode insertMode) error {
+	_, err := g.insertWith(ctx, dest, mode)
+	return err
+}
+
+// insertWith is like insert but reports whether a row was written. Ignored
+// rows do not run the after create hook.
+func (g *Gateway) insertWith(ctx context.Context, dest interface{}, mode insertMode) (bool, error) {
+
+	if g.audit != "" {
+		written := false
+		err := g.audited(ctx, AuditCreate, dest, func(ag *Gateway) (err error) {
+			written, err = ag.insertWith(ctx, dest, mode)
+			return err
+		})
+		return written, err
+	}
+
+	if err := runHook(ctx, hookBeforeCreate, dest); err != nil {
+		return false, err
+	}
+
+	written, err := g.insertRow(ctx, dest, mode)
+	if err != nil || (!written && mode == insertIgnore) {
+		return written, err
+	}
+
+	if written {
+		g.changed(opCreate, dest)
+	}
+
+	return written, runHook(ctx, hookAfterCreate, dest)
+}
+
+// insertRow writes entity to database handling conflicts according to mode
+// and reports whether a row was written
+func (g *Gateway) insertRow(ctx context.Context, dest interface{}, mode insertMode) (bool, error) {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return false, err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return false, err
+	}
+
+	if err := g.generateID(dest, destcfg); err != nil {
+		return false, err
+	}
+
+	if err := g.setTenant(dest, destcfg); err != nil {
+		return false, err
+	}
+
+	if err := setDefaults(dest, destcfg); err != nil {
+		return false, err
+	}
+
+	if err := g.validate(ctx, dest); err != nil {
+		return false, err
+	}
+
+	destcfg = g.stamp(dest, destcfg, true)
+	destcfg = omitZero(dest, destcfg)
+
+	q, args, err := buildCreate(table, dest, destcfg)
+	if err != nil {
+		return false, err
+	}
+
+	q = g.conflictClause(q, destcfg, mode)
+
+	_, auto := insertCols(dest, destcfg)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	if rc := g.returningClause(); rc != "" {
+		err = g.get(ctx, opCreate, table, dest, q+rc, args...)
+		if errors.Is(err, sql.ErrNoRows) && mode != insertPlain {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	pri := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.PrimaryIdx[0])
+
+	// Databases like PostgreSQL do not support LastInsertId
+	if auto && g.dialect.Returning() {
+		q = q + fmt.Sprintf(" RETURNING `%s`", destcfg.PrimaryDBs[0])
+		err = g.get(ctx, opCreate, table, pri.Addr().Interface(), q, args...)
+		if errors.Is(err, sql.ErrNoRows) && mode != insertPlain {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	res, err := g.exec(ctx, opCreate, table, q, args...)
+	if err != nil {
+		return false, err
+	}
+
+	if mode != insertPlain {
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return false, nil
+		}
+	}
+
+	if !auto {
+		return true, nil
+	}
+
+	insertID, err := res.LastInsertId()
+	if noInsertID(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Nothing was inserted
+	if insertID == 0 && mode != insertPlain {
+		return false, nil
+	}
+
+	if isSigned(pri.Kind()) {
+		pri.SetInt(insertID)
+	} else {
+		pri.SetUint(uint64(insertID))
+	}
+
+	return true, nil
+}
+
+// conflictClause adapts INSERT statement q to handle conflicts according to
+// mode
+func (g *Gateway) conflictClause(q string, destcfg *tabMeta, mode insertMode) string {
+
+	mysql := g.dialect.Name() == "mysql"
+
+	switch mode {
+	case insertUpsert:
+		return q + g.dialect.Upsert(destcfg.PrimaryDBs, updateCols(destcfg))
+	case insertIgnore:
+		if mysql {
+			return "INSERT IGNORE" + strings.TrimPrefix(q, "INSERT")
+		}
+		return q + " ON CONFLICT DO NOTHING"
+	case insertReplace:
+		if mysql || g.dialect.Name() == "sqlite" {
+			return "REPLACE" + strings.TrimPrefix(q, "INSERT")
+		}
+		//noinspection GoPreferNilSlice
+		cols := []string{}
+		for _, col := range destcfg.InsertCols {
+			if !inArray(col, destcfg.PrimaryDBs) {
+				cols = append(cols, col)
+			}
+		}
+		return q + g.dialect.Upsert(destcfg.PrimaryDBs, cols)
+	}
+
+	return q
+}
+
+// noInsertID checks if err reports that the driver does not support
+// LastInsertId. The row is written anyway, its key is left unset then.
+func noInsertID(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "LastInsertId")
+}
+
+// updateCols returns the update columns of entity without its primary key
+func updateCols(destcfg *tabMeta) []string {
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	for _, col := range destcfg.UpdateCols {
+		if !inArray(col, destcfg.PrimaryDBs) {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// Read returns entity with given ID from database
+func (g *Gateway) Read(dest interface{}) error {
+	return g.ReadContext(context.Background(), dest)
+}
+
+// ReadContext is like Read but runs with given context
+func (g *Gateway) ReadContext(ctx context.Context, dest interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	if key, ok := g.cacheKey(table, dest, destcfg); ok {
+		err = g.cache.read(ctx, key, dest, destcfg, g.cacheMiss, func() error {
+			return g.readRow(ctx, table, dest, destcfg)
+		})
+	} else {
+		err = g.readRow(ctx, table, dest, destcfg)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return g.preloadAll(ctx, dest)
+}
+
+// readRow reads the row of entity dest from table
+func (g *Gateway) readRow(ctx context.Context, table string, dest interface{}, destcfg *tabMeta) error {
+
+	q, args := buildRead(table, dest, g.readMeta(destcfg), nil)
+
+	q, args, err := g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+	q = q + g.lockClause()
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return notFound(g.get(ctx, opRead, table, dest, q, args...))
+}
+
+// ReadMany reads all entities with given IDs into the slice dest points to.
+// For composite keys each ID is a []interface{} holding the key values.
+func (g *Gateway) ReadMany(dest interface{}, ids []interface{}) error {
+	return g.ReadManyContext(context.Background(), dest, ids)
+}
+
+// ReadManyContext is like ReadMany but runs with given context
+func (g *Gateway) ReadManyContext(ctx context.Context, dest interface{}, ids []interface{}) error {
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		s := reflect.ValueOf(dest).Elem()
+		s.Set(reflect.MakeSlice(s.Type(), 0, 0))
+		return nil
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	q, args, err := buildReadMany(table, g.readMeta(destcfg), ids)
+	if err != nil {
+		return err
+	}
+
+	q, args, err = g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+	q = q + g.lockClause()
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	err = g.selectRows(ctx, opRead, table, dest, q, args...)
+	if err != nil {
+		return err
+	}
+
+	return g.preloadAll(ctx, dest)
+}
+
+// ReadByIDs is like ReadMany taking the IDs as arguments
+func (g *Gateway) ReadByIDs(dest interface{}, ids ...interface{}) error {
+	return g.ReadManyContext(context.Background(), dest, ids)
+}
+
+// ReadByIDsContext is like ReadByIDs but runs with given context
+func (g *Gateway) ReadByIDsContext(ctx context.Context, dest interface{}, ids ...interface{}) error {
+	return g.ReadManyContext(ctx, dest, ids)
+}
+
+// Update updates entity in database. Columns tagged omitempty are skipped
+// while holding the zero value.
+func (g *Gateway) Update(dest interface{}) error {
+	return g.UpdateContext(context.Background(), dest)
+}
+
+// UpdateContext is like Update but runs with given context
+func (g *Gateway) UpdateContext(ctx context.Context, dest interface{}) error {
+
+	if g.audit != "" {
+		return g.audited(ctx, AuditUpdate, dest, func(ag *Gateway) error {
+			return ag.UpdateContext(ctx, dest)
+		})
+	}
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := runHook(ctx, hookBeforeUpdate, dest); err != nil {
+		return err
+	}
+
+	if err := g.validate(ctx, dest); err != nil {
+		return err
+	}
+
+	if err := g.setTenant(dest, destcfg); err != nil {
+		return err
+	}
+
+	destcfg = g.stamp(dest, destcfg, false)
+
+	set := updateSet(dest, destcfg)
+	if len(set) == 0 && destcfg.Version == "" {
+		return nil
+	}
+
+	q, args, err := buildUpdate(table, dest, destcfg, set)
+	if err != nil {
+		return err
+	}
+
+	q, args, err = g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.update(ctx, table, dest, destcfg, q, args...)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkVersion(res, dest, destcfg); err != nil {
+		return err
+	}
+
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	g.changed(opUpdate, dest)
+
+	return runHook(ctx, hookAfterUpdate, dest)
+}
+
+// UpdateReturning updates entity in database and reads it back afterwards,
+// so dest reflects values set by database defaults or triggers. Dialects
+// supporting RETURNING do both in a single statement.
+func (g *Gateway) UpdateReturning(dest interface{}) error {
+	return g.UpdateReturningContext(context.Background(), dest)
+}
+
+// UpdateReturningContext is like UpdateReturning but runs with given context
+func (g *Gateway) UpdateReturningContext(ctx context.Context, dest interface{}) error {
+
+	if g.dialect.Returning() {
+		rg := *g
+		if rg.returning == nil {
+			rg.returning = []string{}
+		}
+		return rg.UpdateContext(ctx, dest)
+	}
+
+	err := g.UpdateContext(ctx, dest)
+	if err != nil {
+		return err
+	}
+
+	return g.ReadContext(ctx, dest)
+}
+
+// UpdatePartial updates only some columns of entity in database. Without
+// explicit column names all update columns holding a non-zero value are
+// written. The primary key is never part of the SET clause.
+func (g *Gateway) UpdatePartial(dest interface{}, cols ...string) error {
+	return g.UpdatePartialContext(context.Background(), dest, cols...)
+}
+
+// UpdatePartialContext is like UpdatePartial but runs with given context
+func (g *Gateway) UpdatePartialContext(ctx context.Context, dest interface{}, cols ...string) error {
+
+	if g.audit != "" {
+		return g.audited(ctx, AuditUpdate, dest, func(ag *Gateway) error {
+			return ag.UpdatePartialContext(ctx, dest, cols...)
+		})
+	}
+
+	destcfg, err := parseMeta(dest)
+	if err != nil {
+		return err
+	}
+
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	for _, col := range cols {
+		if !inArray(col, destcfg.UpdateCols) || inArray(col, destcfg.PrimaryDBs) {
+			return ErrUnknownCol
+		}
+	}
+
+	if err := runHook(ctx, hookBeforeUpdate, dest); err != nil {
+		return err
+	}
+
+	if err := g.validate(ctx, dest); err != nil {
+		return err
+	}
+
+	set := partialCols(dest, destcfg, cols)
+	if len(set) == 0 {
+		return nil
+	}
+
+	if err := g.setTenant(dest, destcfg); err != nil {
+		return err
+	}
+
+	destcfg = g.stamp(dest, destcfg, false)
+
+	q, args, err := buildUpdate(table, dest, destcfg, set)
+	if err != nil {
+		return err
+	}
+
+	q, args, err = g.scoped(q, args, destcfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.update(ctx, table, dest, destcfg, q, args...)
+
+	if err != nil {
+		return err
+	}
+
+	if err := checkVersion(res, dest, destcfg); err != nil {
+		return err
+	}
+
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	g.changed(opUpdate, dest)
+
+	return runHook(ctx, hookAfterUpdate, dest)
+}
+
+// UpdateColumns updates only given columns of entity in database. Unlike
+// UpdatePartial nothing is written without columns.
+func (g *Gateway) UpdateColumns(dest interface{}, cols ...string) error {
+	return g.UpdateColumnsContext(context.Background(), dest, cols...)
+}
+
+// UpdateColumnsContext is like UpdateColumns but runs with given context
+func (g *Gateway) UpdateColumnsContext(ctx context.Context, dest interface{}, cols ...string) error {
+	if len(cols) == 0 {
+		return nil
+	}
+	return g.UpdatePartialContext(ctx, dest, cols...)
+}
+
+// updateSet returns the update columns of entity without those tagged
+// omitempty holding the zero value
+func updateSet(dest interface{}, destcfg *tabMeta) []string {
+
+	if len(destcfg.OmitEmpty) == 0 {
+		return destcfg.UpdateCols
+	}
+
+	r := reflect.ValueOf(dest).Elem()
+
+	//noinspection GoPreferNilSlice
+	set := []string{}
+	for _, col := range destcfg.UpdateCols {
+		if inArray(col, destcfg.OmitEmpty) && r.FieldByIndex(destcfg.Fields[col]).IsZero() {
+			continue
+		}
+		set = append(set, col)
+	}
+
+	return set
+}
+
+// omitZero returns a copy of destcfg without the insert and update columns of
+// entity tagged omitempty holding the zero value, like nil pointers or invalid
+// sql.Null* values, which are left to the database default on creation
+func omitZero(dest interface{}, destcfg *tabMeta) *tabMeta {
+
+	if len(destcfg.OmitEmpty) == 0 {
+		return destcfg
+	}
+
+	r := reflect.ValueOf(dest).Elem()
 
-// tabMeta stores informations about given struct
-type tabMeta struct {
-	PrimaryName string
-	PrimaryDB   string
-	InsertCols  []string
-	UpdateCols  []string
+	keep := func(cols []string) []string {
+		//noinspection GoPreferNilSlice
+		kept := []string{}
+		for _, col := range cols {
+			if inArray(col, destcfg.OmitEmpty) && r.FieldByIndex(destcfg.Fields[col]).IsZero() {
+				continue
+			}
+			kept = append(kept, col)
+		}
+		return kept
+	}
+
+	m := *destcfg
+	m.InsertCols = keep(destcfg.InsertCols)
+	m.UpdateCols = keep(destcfg.UpdateCols)
+
+	return &m
 }
 
-// Errors...
-var (
-	ErrStructConfig = errors.New("invalid or incomplete tags for given struct")
-	ErrNoPrimary    = errors.New("no primary key found")
-	ErrMultiPrimary = errors.New("multiple primary keys not yet supported")
-)
+// partialCols returns the columns UpdatePartial writes for entity, given cols
+// or all update columns holding a non-zero value, plus the updated column
+func partialCols(dest interface{}, destcfg *tabMeta, cols []string) []string {
 
-// NewGateway returns a new instance of Gateway
-func NewGateway(dbconn *sqlx.DB, table string) (*Gateway, error) {
-	return &Gateway{
-		table: table,
-		dbx:   dbconn,
-	}, nil
+	r := reflect.ValueOf(dest).Elem()
+
+	//noinspection GoPreferNilSlice
+	set := []string{}
+	for _, col := range destcfg.UpdateCols {
+		if inArray(col, destcfg.PrimaryDBs) {
+			continue
+		}
+		if len(cols) > 0 {
+			if inArray(col, cols) {
+				set = append(set, col)
+			}
+			continue
+		}
+		if col != destcfg.Updated && !r.FieldByIndex(destcfg.Fields[col]).IsZero() {
+			set = append(set, col)
+		}
+	}
+
+	if len(set) > 0 && inArray(destcfg.Updated, destcfg.UpdateCols) && !inArray(destcfg.Updated, set) {
+		set = append(set, destcfg.Updated)
+	}
+
+	return set
 }
 
-// Create writes entity to database
-func (g *Gateway) Create(dest interface{}) error {
+// Delete removes entity with given ID from database. Entities with a field
+// tagged softdelete are only marked as deleted and skipped by reads.
+func (g *Gateway) Delete(dest interface{}) error {
+	return g.DeleteContext(context.Background(), dest)
+}
+
+// DeleteContext is like Delete but runs with given context
+func (g *Gateway) DeleteContext(ctx context.Context, dest interface{}) error {
+
+	if g.audit != "" {
+		return g.audited(ctx, AuditDelete, dest, func(ag *Gateway) error {
+			return ag.DeleteContext(ctx, dest)
+		})
+	}
 
 	destcfg, err := parseMeta(dest)
 	if err != nil {
 		return err
 	}
 
-	q := fmt.Sprintf(
-		"INSERT INTO `%s` (%s) VALUES (%s)",
-		g.table,
-		strings.Join(quoteIdents(destcfg.InsertCols), ","),
-		strings.Join(quoteNamedValues(destcfg.InsertCols), ","),
-	)
+	table, err := g.entityTable(dest)
+	if err != nil {
+		return err
+	}
+
+	if err := runHook(ctx, hookBeforeDelete, dest); err != nil {
+		return err
+	}
+
+	q, args := buildDelete(table, dest, destcfg)
 
-	res, err := g.dbx.NamedExec(q, dest)
+	q, args, err = g.scoped(q, args, destcfg)
 	if err != nil {
 		return err
 	}
 
-	insertID, err := res.LastInsertId()
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opDelete, table, q, args...)
+
 	if err != nil {
 		return err
 	}
 
-	reflect.ValueOf(dest).Elem().FieldByName(destcfg.PrimaryName).SetUint(uint64(insertID))
+	if err := g.checkAffected(res); err != nil {
+		return err
+	}
+
+	if destcfg.SoftDelete != "" {
+		setTime(reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[destcfg.SoftDelete]), args[0].(time.Time))
+	}
 
-	return nil
+	g.changed(opDelete, dest)
+
+	return runHook(ctx, hookAfterDelete, dest)
 }
 
-// Read returns entity with given ID from database
-func (g *Gateway) Read(dest interface{}) error {
+// DeleteByIDs deletes all entities of the type dest refers to with given IDs
+// in a single statement and returns the number of affected rows. For
+// composite keys each ID is a []interface{} holding the key values. Entities
+// with a soft delete column are marked deleted. Hooks are not run.
+func (g *Gateway) DeleteByIDs(dest interface{}, ids ...interface{}) (int64, error) {
+	return g.DeleteByIDsContext(context.Background(), dest, ids...)
+}
+
+// DeleteByIDsContext is like DeleteByIDs but runs with given context
+func (g *Gateway) DeleteByIDsContext(ctx context.Context, dest interface{}, ids ...interface{}) (int64, error) {
 
 	destcfg, err := parseMeta(dest)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
 	}
 
-	q := fmt.Sprintf(
-		"SELECT * FROM `%s` WHERE `%s` = ?",
-		g.table,
-		destcfg.PrimaryDB,
-	)
+	table, err := g.tableName(dest)
+	if err != nil {
+		return 0, err
+	}
 
-	err = g.dbx.Get(dest, q, getPriVal(dest, destcfg))
+	q, args, err := buildDeleteMany(table, destcfg, ids, time.Now())
+	if err != nil {
+		return 0, err
+	}
 
+	q, args, err = g.scoped(q, args, destcfg)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opDelete, table, q, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	g.changedTable(opDelete, table)
+
+	return res.RowsAffected()
 }
 
-// Update updates entity in database
-func (g *Gateway) Update(dest interface{}) error {
+// Select is a simple select interface using a map as query parameters.
+func (g *Gateway) Select(dest interface{}, params Condition, orderby Orderer) error {
+	return g.SelectContext(context.Background(), dest, params, orderby)
+}
 
-	destcfg, err := parseMeta(dest)
+// SelectContext is like Select but runs with given context
+func (g *Gateway) SelectContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer) error {
+
+	if err := checkOrder(orderby, dest); err != nil {
+		return err
+	}
+	if err := checkCondition(params, dest); err != nil {
+		return err
+	}
+
+	table, err := g.tableName(dest)
+	if err != nil {
+		return err
+	}
+
+	params, err = g.scopeFor(params, dest)
 	if err != nil {
 		return err
 	}
 
-	q := fmt.Sprintf(
-		"UPDATE `%s` SET %s WHERE `%s` = :%s",
-		g.table,
-		strings.Join(quoteUpdateSet(destcfg.UpdateCols), ","),
-		destcfg.PrimaryDB,
-		destcfg.PrimaryDB,
-	)
+	q, args := buildSelect(table, nil, params, orderby, g.softDeleteCol(dest))
+	q = q + g.lockClause()
 
-	_, err = g.dbx.NamedExec(q, dest)
+	ctx, cancel := g.context(ctx)
+	defer cancel()
 
+	err = g.selectRows(ctx, opSelect, table, dest, q, args...)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return g.preloadAll(ctx, dest)
 }
 
-// Delete removes entity with given ID from database
-func (g *Gateway) Delete(dest interface{}) error {
+// SelectOne reads the first row matching params in given order into dest and
+// returns an error matching ErrNotFound if there is none
+func (g *Gateway) SelectOne(dest interface{}, params Condition, orderby Orderer) error {
+	return g.SelectOneContext(context.Background(), dest, params, orderby)
+}
 
-	destcfg, err := parseMeta(dest)
+// SelectOneContext is like SelectOne but runs with given context
+func (g *Gateway) SelectOneContext(ctx context.Context, dest interface{}, params Condition, orderby Orderer) error {
+	return g.Query().Where(params).OrderBy(orderby).OneContext(ctx, dest)
+}
+
+// FirstOrCreate reads the first row matching params into dest or creates dest
+// if there is none, reporting whether it was created. Both run in one
+// transaction, a unique index still is the only safe guard against
+// concurrent inserts.
+func (g *Gateway) FirstOrCreate(dest interface{}, params Condition) (bool, error) {
+	return g.FirstOrCreateContext(context.Background(), dest, params)
+}
+
+// FirstOrCreateContext is like FirstOrCreate but runs with given context
+func (g *Gateway) FirstOrCreateContext(ctx context.Context, dest interface{}, params Condition) (bool, error) {
+
+	created := false
+
+	err := g.transact(ctx, nil, func(txg *Gateway) error {
+		err := txg.SelectOneContext(ctx, dest, params, nil)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		created = true
+		return txg.CreateContext(ctx, dest)
+	})
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	q := fmt.Sprintf(
-		"DELETE FROM `%s` WHERE `%s` = ?",
-		g.table,
-		destcfg.PrimaryDB,
-	)
+	return created, nil
+}
 
-	_, err = g.dbx.Exec(q, getPriVal(dest, destcfg))
+// whereClause builds the WHERE part of a query and its arguments from given
+// condition. It returns an empty string if there is nothing to filter.
+func whereClause(params Condition) (string, []interface{}) {
 
-	if err != nil {
-		return err
+	if params == nil {
+		//noinspection GoPreferNilSlice
+		return "", []interface{}{}
 	}
 
-	return nil
+	cond, args := params.condition(quoteColumn)
+
+	if cond == "" {
+		return "", args
+	}
+
+	return " WHERE " + cond, args
 }
 
-// Select is a simple select interface using a map as query parameters.
-func (g *Gateway) Select(dest interface{}, params Selectors, orderby OrderBy) error {
+// context derives the context for a single query from ctx, limited by the
+// gateways timeout if one is configured
+func (g *Gateway) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.timeout > 0 {
+		return context.WithTimeout(ctx, g.timeout)
+	}
+	return context.WithCancel(ctx)
+}
 
-	//noinspection GoPreferNilSlice
-	args := []interface{}{}
+// tableName resolves the table for given entity or slice of entities. A
+// TableName method wins over a table tag which wins over the gateways table.
+// The configured prefix and schema are applied to the result, a sharded table
+// is resolved for the shard the gateway is bound to.
+func (g *Gateway) tableName(dest interface{}) (string, error) {
+	return g.resolveTable(dest, g.shardKey)
+}
 
-	//noinspection GoPreferNilSlice
-	names := []string{}
+// resolveTable resolves the table of dest on the shard of entity
+func (g *Gateway) resolveTable(dest interface{}, entity interface{}) (string, error) {
 
-	for k, v := range params {
-		args = append(args, v)
-		names = append(names, k)
+	table, err := g.rawTableName(dest)
+	if err != nil {
+		return "", err
 	}
 
-	q := fmt.Sprintf("SELECT * FROM `%s`", g.table)
-	if len(names) > 0 {
-		q = q + " " + fmt.Sprintf("WHERE %s", strings.Join(quoteSelectSet(names), " AND "))
+	table, err = g.shardTable(table, entity)
+	if err != nil {
+		return "", err
 	}
 
-	if len(orderby) > 0 {
-		//noinspection GoPreferNilSlice
-		obs := []string{}
-		for k, v := range orderby {
-			obs = append(obs, k+" "+v)
+	return g.qualify(table), nil
+}
+
+// rawTableName resolves the table name of dest without prefix and schema
+func (g *Gateway) rawTableName(dest interface{}) (string, error) {
+
+	t := baseType(reflect.TypeOf(dest))
+
+	if n, ok := reflect.New(t).Interface().(TableNamer); ok && n.TableName() != "" {
+		return n.TableName(), nil
+	}
+
+	if t.Kind() == reflect.Struct {
+		for x := 0; x < t.NumField(); x++ {
+			for _, op := range strings.Split(t.Field(x).Tag.Get(tagTGW), ",") {
+				if strings.HasPrefix(op, tgwTable) && len(op) > len(tgwTable) {
+					return strings.TrimPrefix(op, tgwTable), nil
+				}
+			}
 		}
-		q = q + " ORDER BY " + strings.Join(obs, ",")
 	}
 
-	err := g.dbx.Select(dest, q, args...)
+	if g.table == "" {
+		return "", ErrNoTable
+	}
+
+	return g.table, nil
+}
+
+// defaultTable returns the qualified table of the gateway itself
+func (g *Gateway) defaultTable() (string, error) {
+
+	if g.table == "" {
+		return "", ErrNoTable
+	}
+
+	table, err := g.shardTable(g.table, g.shardKey)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	return g.qualify(table), nil
+}
+
+// qualify applies the configured prefix and schema to table. Names already
+// holding a schema keep it.
+func (g *Gateway) qualify(table string) string {
+	if g.prefix == "" && g.schema == "" {
+		return table
+	}
+	parts := strings.Split(table, ".")
+	parts[len(parts)-1] = g.prefix + parts[len(parts)-1]
+	if g.schema != "" && len(parts) == 1 {
+		parts = append([]string{g.schema}, parts...)
+	}
+	return strings.Join(parts, ".")
+}
+
+// baseType dereferences pointers and slices down to the entity type
+func baseType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// notFound translates sql.ErrNoRows into an error matching ErrNotFound and
+// passes all other errors unchanged
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFoundError{}
+	}
+	return err
+}
+
+// getPriVals returns given interfaces primary key values
+func getPriVals(dest interface{}, destcfg *tabMeta) []interface{} {
+	r := reflect.Indirect(reflect.ValueOf(dest).Elem())
+	vals := make([]interface{}, len(destcfg.PrimaryNames))
+	for i, idx := range destcfg.PrimaryIdx {
+		vals[i] = r.FieldByIndex(idx).Interface()
+	}
+	return vals
+}
+
+// quoteTable quotes a table name. Schema qualified names like
+// "analytics.events" get each part quoted separately.
+func quoteTable(table string) string {
+	return strings.Join(quoteIdents(strings.Split(table, ".")), ".")
+}
+
+// quoteColumn quotes a column name. Qualified names like "users.name" get
+// each part quoted separately.
+func quoteColumn(name string) string {
+	return quoteTable(name)
+}
+
+// validTable checks if given table name consists of plain sql identifiers
+func validTable(table string) bool {
+	return validIdent(strings.Split(table, ".")...)
+}
+
+// setPriVal sets given interfaces primary key to id, converting between
+// numeric types if needed. Composite keys expect id to be a []interface{}
+// holding the values in field order.
+func setPriVal(dest interface{}, destcfg *tabMeta, id interface{}) error {
+
+	if len(destcfg.PrimaryNames) > 1 {
+		ids, ok := id.([]interface{})
+		if !ok || len(ids) != len(destcfg.PrimaryNames) {
+			return ErrPrimaryType
+		}
+		for i, idx := range destcfg.PrimaryIdx {
+			if err := setField(reflect.ValueOf(dest).Elem().FieldByIndex(idx), ids[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return setField(reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.PrimaryIdx[0]), id)
+}
+
+// setField assigns id to primary key field f, converting between numeric
+// types if needed
+func setField(f reflect.Value, id interface{}) error {
+
+	v := reflect.ValueOf(id)
+
+	if !v.IsValid() {
+		return ErrPrimaryType
+	}
+
+	if v.Type() != f.Type() && !(isNumeric(v.Kind()) && isNumeric(f.Kind())) {
+		if !v.Type().ConvertibleTo(f.Type()) || v.Kind() != f.Kind() {
+			return ErrPrimaryType
+		}
 	}
 
+	f.Set(v.Convert(f.Type()))
+
 	return nil
 }
 
-// getPriVal returns given interfaces primary key value
-func getPriVal(dest interface{}, destcfg *tabMeta) uint64 {
-	r := reflect.ValueOf(dest).Elem()
-	f := reflect.Indirect(r).FieldByName(destcfg.PrimaryName)
-	return f.Uint()
+// isInteger checks if given kind is a signed or unsigned integer kind
+func isInteger(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Uint64
+}
+
+// isSigned checks if given kind is a signed integer kind
+func isSigned(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+// isNumeric checks if given kind is an integer or float kind
+func isNumeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
 }
 
 // quoteIdents decorates given array by quoting query elements
@@ -215,7 +1339,7 @@ func quoteIdents(names []string) []string {
 	//noinspection GoPreferNilSlice
 	n := []string{}
 	for _, name := range names {
-		n = append(n, fmt.Sprintf("`%s`", name))
+		n = append(n, "`"+strings.Replace(name, "`", "``", -1)+"`")
 	}
 	return n
 }
@@ -250,31 +1374,110 @@ func quoteNamedValues(names []string) []string {
 	return n
 }
 
-// parseMeta reads struct and returns config
+// parseMeta reads struct, or the element struct of a slice, and returns config
 func parseMeta(dest interface{}) (*tabMeta, error) {
 
+	s, err := structMeta(baseType(reflect.TypeOf(dest)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.PrimaryNames) == 0 || inArray("", s.PrimaryDBs) {
+		return nil, ErrNoPrimary
+	}
+
+	if len(s.InsertCols) == 0 {
+		return nil, ErrStructConfig
+	}
+
+	// The tenant has to be written with every new row
+	if s.Tenant != "" && !inArray(s.Tenant, s.InsertCols) {
+		return nil, ErrStructConfig
+	}
+
+	// Encrypted values can not be looked up or decoded as json
+	for _, col := range s.Encrypted {
+		if inArray(col, s.PrimaryDBs) || inArray(col, s.JSONCols) {
+			return nil, ErrStructConfig
+		}
+	}
+
+	if s.Version != "" {
+		f := baseType(reflect.TypeOf(dest)).FieldByIndex(s.Fields[s.Version])
+		if !isInteger(f.Type.Kind()) {
+			return nil, ErrStructConfig
+		}
+	}
+
+	return s, nil
+}
+
+// metaCache holds the parsed *tabMeta of every struct type seen so far
+var metaCache sync.Map
+
+// structMeta returns the tag informations of given struct type without
+// checking them for completeness. Types are parsed once and cached, the
+// returned metadata is shared and must not be modified.
+func structMeta(e reflect.Type) (*tabMeta, error) {
+
+	if m, ok := metaCache.Load(e); ok {
+		return m.(*tabMeta), nil
+	}
+
+	m, err := parseStruct(e)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := metaCache.LoadOrStore(e, m)
+	return actual.(*tabMeta), nil
+}
+
+// parseStruct collects the tag informations of given struct type
+func parseStruct(e reflect.Type) (*tabMeta, error) {
+
 	s := tabMeta{
-		PrimaryName: "",
-		PrimaryDB:   "",
-		InsertCols:  []string{},
-		UpdateCols:  []string{},
+		PrimaryNames: []string{},
+		PrimaryDBs:   []string{},
+		PrimaryIdx:   [][]int{},
+		InsertCols:   []string{},
+		UpdateCols:   []string{},
+		OmitEmpty:    []string{},
+		JSONCols:     []string{},
+		Encrypted:    []string{},
+		FullText:     []string{},
+		NowCols:      []string{},
+		Fields:       map[string][]int{},
+		Defaults:     map[string]string{},
+		Enums:        map[string][]string{},
 	}
 
-	e := reflect.TypeOf(dest).Elem()
-	for x := 0; x < e.NumField(); x++ {
+	for _, f := range structFields(e) {
 
-		f := e.Field(x)
+		dbname, ops := f.col, f.ops
+		s.Nested = s.Nested || f.nested
+		s.Mapped = s.Mapped || f.mapped
 
-		dbname := f.Tag.Get(tagDB)
-		ops := strings.Split(f.Tag.Get(tagTGW), ",")
+		if dbname != "" && dbname != "-" {
+			// Fields of embedded structs are shadowed by shallower ones
+			if _, ok := s.Fields[dbname]; ok {
+				continue
+			}
+			s.Fields[dbname] = f.Index
+		}
 
-		// Mark only once as primary
+		// Multiple primary fields form a composite key
 		if inArray(tgwPrimary, ops) {
-			if s.PrimaryName != "" {
-				return nil, ErrMultiPrimary
+			s.PrimaryNames = append(s.PrimaryNames, f.Name)
+			s.PrimaryDBs = append(s.PrimaryDBs, dbname)
+			s.PrimaryIdx = append(s.PrimaryIdx, f.Index)
+			s.NoAuto = s.NoAuto || inArray(tgwNoAuto, ops)
+			if inArray(genUUID, ops) {
+				s.Generate = genUUID
+			}
+			if inArray(genULID, ops) {
+				s.Generate = genULID
 			}
-			s.PrimaryName = f.Name
-			s.PrimaryDB = dbname
 		}
 
 		if inArray(tgwInsert, ops) {
@@ -283,17 +1486,137 @@ func parseMeta(dest interface{}) (*tabMeta, error) {
 		if inArray(tgwUpdate, ops) {
 			s.UpdateCols = append(s.UpdateCols, dbname)
 		}
+		if inArray(tgwOmit, ops) {
+			s.OmitEmpty = append(s.OmitEmpty, dbname)
+		}
+		if inArray(tgwJSON, ops) {
+			s.JSONCols = append(s.JSONCols, dbname)
+		}
+		if inArray(tgwEncrypt, ops) {
+			s.Encrypted = append(s.Encrypted, dbname)
+		}
+		if inArray(tgwFTS, ops) {
+			s.FullText = append(s.FullText, dbname)
+		}
+		if inArray(tgwSoft, ops) {
+			s.SoftDelete = dbname
+		}
+		if inArray(tgwCreated, ops) {
+			s.Created = dbname
+		}
+		if inArray(tgwUpdated, ops) {
+			s.Updated = dbname
+		}
+		if inArray(tgwVersion, ops) {
+			s.Version = dbname
+		}
+		if inArray(tgwTenant, ops) {
+			s.Tenant = dbname
+		}
+		if def := tagValue(ops, tgwDefault); def != "" {
+			// Invalid defaults are reported right away, not on the first create
+			if _, err := defaultValue(f.Type, def, time.Time{}); err != nil {
+				return nil, err
+			}
+			s.Defaults[dbname] = def
+		}
+		if enum := tagValue(ops, tgwEnum); enum != "" {
+			s.Enums[dbname] = parseEnum(enum)
+		}
 	}
 
-	if s.PrimaryName == "" || s.PrimaryDB == "" {
-		return nil, ErrNoPrimary
+	return &s, nil
+}
+
+// colField is a struct field mapped to a column
+type colField struct {
+	reflect.StructField
+	col    string
+	ops    []string
+	nested bool
+	mapped bool
+}
+
+// structFields returns the fields of struct type e, flattening untagged
+// anonymous struct fields like sqlx does. Shallower fields come first, the
+// index of embedded fields is relative to e. Tagged struct fields are
+// expanded into prefixed columns, so Address with tag addr maps its Street to
+// addr_street. The tgw options of such a field apply to all its columns.
+func structFields(e reflect.Type) []colField {
+
+	//noinspection GoPreferNilSlice
+	fields := []colField{}
+
+	//noinspection GoPreferNilSlice
+	embedded := []reflect.StructField{}
+
+	for x := 0; x < e.NumField(); x++ {
+
+		f := e.Field(x)
+		dbname, tagged := f.Tag.Lookup(tagDB)
+		ops := strings.Split(f.Tag.Get(tagTGW), ",")
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && dbname == "" {
+			embedded = append(embedded, f)
+			continue
+		}
+
+		mapped := false
+		if !tagged {
+			dbname = mappedName(f, ops)
+			mapped = dbname != ""
+		}
+
+		if !isNested(f.Type, dbname, ops) {
+			fields = append(fields, colField{StructField: f, col: dbname, ops: ops, mapped: mapped})
+			continue
+		}
+
+		for _, n := range structFields(f.Type) {
+			if n.col == "" || n.col == "-" {
+				continue
+			}
+			n.Index = append(append([]int{}, f.Index...), n.Index...)
+			n.col = dbname + "_" + n.col
+			n.ops = append(append([]string{}, ops...), n.ops...)
+			n.nested = true
+			fields = append(fields, n)
+		}
 	}
 
-	if len(s.InsertCols) == 0 {
-		return nil, ErrStructConfig
+	for _, em := range embedded {
+		for _, f := range structFields(em.Type) {
+			f.Index = append(append([]int{}, em.Index...), f.Index...)
+			fields = append(fields, f)
+		}
 	}
 
-	return &s, nil
+	return fields
+}
+
+// isNested checks if a field of type t is a struct to expand into prefixed
+// columns rather than a single value like time.Time or a json column
+func isNested(t reflect.Type, dbname string, ops []string) bool {
+
+	if t.Kind() != reflect.Struct || dbname == "" || dbname == "-" || inArray(tgwJSON, ops) {
+		return false
+	}
+
+	if t.Implements(valuerType) || reflect.PtrTo(t).Implements(scannerType) {
+		return false
+	}
+
+	return t != reflect.TypeOf(time.Time{})
+}
+
+// validIdent checks if all given names are plain sql identifiers
+func validIdent(names ...string) bool {
+	for _, name := range names {
+		if !identRe.MatchString(name) {
+			return false
+		}
+	}
+	return true
 }
 
 // inArray checks if given needle is in given haystack
@@ -0,0 +1,247 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"sync"
+	"testing"
+)
+
+// testUser is the entity most tests work with, stored in testUsers
+type testUser struct {
+	ID   uint64 `db:"id" tgw:"primary"`
+	Name string `db:"name" tgw:"insert,update"`
+	Age  int    `db:"age" tgw:"insert,update"`
+}
+
+// testUsers creates the table of testUser
+const testUsers = "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL DEFAULT '', age INTEGER NOT NULL DEFAULT 0)"
+
+// testDB returns an in-memory SQLite database after running given statements.
+// It is closed when the test finishes.
+func testDB(t *testing.T, stmts ...string) *sqlx.DB {
+
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection would open a database of its own
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	for _, q := range stmts {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+// testGateway returns a gateway for table of db, failing the test on error
+func testGateway(t *testing.T, db sqlx.ExtContext, table string, opts ...Option) *Gateway {
+	t.Helper()
+	g, err := NewGateway(db, table, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// testCreate creates all entities, failing the test on error
+func testCreate(t *testing.T, g Gatewayer, entities ...interface{}) {
+	t.Helper()
+	for _, e := range entities {
+		if err := g.Create(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testCount returns the number of rows in table matching the sql condition
+// where, bypassing the gateway
+func testCount(t *testing.T, db *sqlx.DB, table, where string) int {
+	t.Helper()
+	var n int
+	if err := db.Get(&n, "SELECT COUNT(*) FROM "+table+" WHERE "+where); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// testConn is a connection recording the statements run on it. Fail, if set,
+// may fail statements before they reach the database.
+type testConn struct {
+	*sqlx.DB
+	mu    sync.Mutex
+	stmts []string
+	fail  func(q string) error
+}
+
+// run records statement q and returns the error it should fail with
+func (c *testConn) run(q string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stmts = append(c.stmts, q)
+	if c.fail != nil {
+		return c.fail(q)
+	}
+	return nil
+}
+
+// count returns the number of statements run
+func (c *testConn) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.stmts)
+}
+
+// ExecContext implements sqlx.ExecerContext
+func (c *testConn) ExecContext(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	if err := c.run(q); err != nil {
+		return nil, err
+	}
+	return c.DB.ExecContext(ctx, q, args...)
+}
+
+// QueryxContext implements sqlx.QueryerContext
+func (c *testConn) QueryxContext(ctx context.Context, q string, args ...interface{}) (*sqlx.Rows, error) {
+	if err := c.run(q); err != nil {
+		return nil, err
+	}
+	return c.DB.QueryxContext(ctx, q, args...)
+}
+
+// QueryRowxContext implements sqlx.QueryerContext. Rows can not carry an
+// error of their own, so fail is not applied.
+func (c *testConn) QueryRowxContext(ctx context.Context, q string, args ...interface{}) *sqlx.Row {
+	c.mu.Lock()
+	c.stmts = append(c.stmts, q)
+	c.mu.Unlock()
+	return c.DB.QueryRowxContext(ctx, q, args...)
+}
+
+// TestCRUD checks the round trip of an entity through the basic operations
+func TestCRUD(t *testing.T) {
+
+	g := testGateway(t, testDB(t, testUsers), "users")
+
+	u := testUser{Name: "a", Age: 3}
+	if err := g.Create(&u); err != nil || u.ID != 1 {
+		t.Fatalf("Create() = %v, id %d", err, u.ID)
+	}
+
+	r := testUser{ID: u.ID}
+	if err := g.Read(&r); err != nil || r != u {
+		t.Fatalf("Read() = %v, %+v", err, r)
+	}
+
+	u.Name = "b"
+	if err := g.Update(&u); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []testUser
+	if err := g.Select(&all, Selectors{"name": "b"}, nil); err != nil || len(all) != 1 || all[0] != u {
+		t.Fatalf("Select() = %v, %+v", err, all)
+	}
+
+	if err := g.Delete(&u); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Read(&testUser{ID: u.ID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read() after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+// TestNotFound checks the operations reporting missing rows with an error
+// matching ErrNotFound
+func TestNotFound(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts []Option
+		op   func(g *Gateway) error
+	}{
+		{"read", nil, func(g *Gateway) error {
+			return g.Read(&testUser{ID: 9})
+		}},
+		{"select one", nil, func(g *Gateway) error {
+			return g.SelectOne(&testUser{}, Selectors{"name": "x"}, nil)
+		}},
+		{"update", []Option{WithAffectedCheck()}, func(g *Gateway) error {
+			return g.Update(&testUser{ID: 9, Name: "x"})
+		}},
+		{"update partial", []Option{WithAffectedCheck()}, func(g *Gateway) error {
+			return g.UpdatePartial(&testUser{ID: 9, Name: "x"})
+		}},
+		{"delete", []Option{WithAffectedCheck()}, func(g *Gateway) error {
+			return g.Delete(&testUser{ID: 9})
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			db := testDB(t, testUsers)
+			g := testGateway(t, db, "users", tc.opts...)
+			testCreate(t, g, &testUser{Name: "a"})
+			err := tc.op(g)
+			if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("err = %v does not unwrap to sql.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+// TestAffectedCheck checks that writes hitting a row pass the affected check
+// and writes without it are not checked
+func TestAffectedCheck(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts []Option
+		id   uint64
+		err  error
+	}{
+		{"existing row", []Option{WithAffectedCheck()}, 1, nil},
+		{"missing row", []Option{WithAffectedCheck()}, 9, ErrNotFound},
+		{"missing row unchecked", nil, 9, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := testGateway(t, testDB(t, testUsers), "users", tc.opts...)
+			testCreate(t, g, &testUser{Name: "a"})
+			if err := g.Update(&testUser{ID: tc.id, Name: "b"}); !errors.Is(err, tc.err) {
+				t.Errorf("Update() = %v, want %v", err, tc.err)
+			}
+			if err := g.Delete(&testUser{ID: tc.id}); !errors.Is(err, tc.err) {
+				t.Errorf("Delete() = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tgwfixture loads fixtures into the database for integration tests.
+// A fixture file is a YAML or JSON mapping of table names to lists of rows,
+// each row mapping column names to values. Tables are loaded in the order of
+// the file, so referenced rows can be listed first.
+package tgwfixture
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/mrccnt/go-table-gateway"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"reflect"
+)
+
+// Errors...
+var (
+	ErrType    = errors.New("fixture type must be a pointer to a struct")
+	ErrTable   = errors.New("no type registered for fixture table")
+	ErrFormat  = errors.New("fixtures must map tables to lists of rows")
+	ErrNoBegin = errors.New("connection can not begin transactions")
+)
+
+// Loader inserts fixtures through gateways of the registered tables
+type Loader struct {
+	dbconn sqlx.ExtContext
+	opts   []tgw.Option
+	types  map[string]reflect.Type
+}
+
+// txBeginner is implemented by connections able to start transactions
+type txBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// New returns a Loader inserting on dbconn. Options configure the gateways
+// of all tables.
+func New(dbconn sqlx.ExtContext, opts ...tgw.Option) *Loader {
+	return &Loader{dbconn: dbconn, opts: opts, types: map[string]reflect.Type{}}
+}
+
+// Register maps rows of table to the struct type proto points to
+func (l *Loader) Register(table string, proto interface{}) error {
+
+	t := reflect.TypeOf(proto)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return ErrType
+	}
+
+	l.types[table] = t.Elem()
+
+	return nil
+}
+
+// Load inserts the fixtures of data on tx or on the connection of the loader
+// if tx is nil
+func (l *Loader) Load(ctx context.Context, tx *sqlx.Tx, data []byte) error {
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return ErrFormat
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		table := root.Content[i].Value
+		var rows []map[string]interface{}
+		if err := root.Content[i+1].Decode(&rows); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrFormat, table, err)
+		}
+		if err := l.insert(ctx, tx, table, rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadFiles inserts the fixtures of all files at paths like Load
+func (l *Loader) LoadFiles(ctx context.Context, tx *sqlx.Tx, paths ...string) error {
+
+	for _, p := range paths {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := l.Load(ctx, tx, data); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	return nil
+}
+
+// Run loads the fixtures of files at paths in a new transaction, calls fn with
+// it and rolls it back afterwards, so every test starts from the same data.
+// Bind gateways used by fn to the transaction with BindTx.
+func (l *Loader) Run(ctx context.Context, fn func(tx *sqlx.Tx) error, paths ...string) error {
+
+	b, ok := l.dbconn.(txBeginner)
+	if !ok {
+		return ErrNoBegin
+	}
+
+	tx, err := b.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := l.LoadFiles(ctx, tx, paths...); err != nil {
+		return err
+	}
+
+	return fn(tx)
+}
+
+// insert creates rows of table through a gateway on tx or the connection
+func (l *Loader) insert(ctx context.Context, tx *sqlx.Tx, table string, rows []map[string]interface{}) error {
+
+	t, ok := l.types[table]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTable, table)
+	}
+
+	g, err := tgw.NewGateway(l.dbconn, table, l.opts...)
+	if err != nil {
+		return err
+	}
+
+	if tx != nil {
+		g = g.BindTx(tx)
+	}
+
+	for n, row := range rows {
+		dest := reflect.New(t).Interface()
+		for col, v := range row {
+			if err := setColumn(dest, col, v); err != nil {
+				return fmt.Errorf("%s row %d column %s: %w", table, n+1, col, err)
+			}
+		}
+		if err := g.CreateContext(ctx, dest); err != nil {
+			return fmt.Errorf("%s row %d: %w", table, n+1, err)
+		}
+	}
+
+	return nil
+}
+
+// setColumn assigns the decoded fixture value v to column col of dest. Scanner
+// fields scan v, byte slices take strings as is, other fields are decoded
+// from the json encoding of v.
+func setColumn(dest interface{}, col string, v interface{}) error {
+
+	ptr, err := tgw.ColumnPtr(dest, col)
+	if err != nil {
+		return err
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if s, ok := ptr.(sql.Scanner); ok {
+		return s.Scan(scanValue(v))
+	}
+
+	if b, ok := ptr.(*[]byte); ok {
+		if s, ok := v.(string); ok {
+			*b = []byte(s)
+			return nil
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, ptr)
+}
+
+// scanValue converts the decoded fixture value v to a driver value
+func scanValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return int64(x)
+	case uint64:
+		return int64(x)
+	}
+	return v
+}
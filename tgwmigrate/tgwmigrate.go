@@ -0,0 +1,279 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tgwmigrate applies versioned schema migrations, keeping track of
+// them in a table written through a table gateway
+package tgwmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/mrccnt/go-table-gateway"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// Table is the name of the table tracking applied migrations
+const Table = "schema_migrations"
+
+// Errors...
+var (
+	ErrVersion   = errors.New("migration versions must be positive and unique")
+	ErrNoDown    = errors.New("migration can not be reverted")
+	ErrNoPending = errors.New("no applied migration to revert")
+	ErrLocked    = errors.New("migration lock could not be taken")
+)
+
+// Migration is a single schema change. Up and Down hold sql run as a single
+// statement, UpFunc and DownFunc Go functions, both run in a transaction with
+// the write of the tracking table. Functions take precedence over sql. Note
+// that MySQL commits DDL statements like CREATE or ALTER TABLE implicitly, so
+// a failing migration may leave its earlier statements applied there.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	UpFunc   func(ctx context.Context, tx *sqlx.Tx) error
+	DownFunc func(ctx context.Context, tx *sqlx.Tx) error
+}
+
+// record is a row of the tracking table
+type record struct {
+	Version   int64     `db:"version" tgw:"primary,noauto,insert"`
+	Name      string    `db:"name" tgw:"insert,type=VARCHAR(255)"`
+	AppliedAt time.Time `db:"applied_at" tgw:"insert,created"`
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	dbconn     sqlx.ExtContext
+	g          *tgw.Gateway
+	migrations []Migration
+}
+
+// New returns a Migrator for given migrations, which are applied ordered by
+// their version. Options configure the gateway of the tracking table.
+func New(dbconn sqlx.ExtContext, migrations []Migration, opts ...tgw.Option) (*Migrator, error) {
+
+	ms := append([]Migration{}, migrations...)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+
+	for i, m := range ms {
+		if m.Version < 1 || (i > 0 && ms[i-1].Version == m.Version) {
+			return nil, ErrVersion
+		}
+	}
+
+	g, err := tgw.NewGateway(dbconn, Table, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{dbconn: dbconn, g: g, migrations: ms}, nil
+}
+
+// Migrate applies all pending migrations in order, each in its own
+// transaction, and stops at the first failing one. On MySQL and PostgreSQL it
+// holds a lock while doing so, concurrent calls of other processes wait for it
+// to be released until ctx is done.
+func (m *Migrator) Migrate(ctx context.Context) error {
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	done := map[int64]bool{}
+	for _, v := range applied {
+		done[v] = true
+	}
+
+	for _, mig := range m.migrations {
+		if done[mig.Version] {
+			continue
+		}
+		if err := m.up(ctx, mig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rollback reverts the last applied migration, holding the lock of Migrate
+func (m *Migrator) Rollback(ctx context.Context) error {
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		return ErrNoPending
+	}
+
+	last := applied[len(applied)-1]
+	for _, mig := range m.migrations {
+		if mig.Version == last {
+			return m.down(ctx, mig)
+		}
+	}
+
+	return ErrNoDown
+}
+
+// Applied returns the versions of all applied migrations in ascending order,
+// creating the tracking table if needed
+func (m *Migrator) Applied(ctx context.Context) ([]int64, error) {
+
+	if err := m.g.CreateTableContext(ctx, &record{}); err != nil {
+		return nil, err
+	}
+
+	//noinspection GoPreferNilSlice
+	rs := []record{}
+	if err := m.g.SelectContext(ctx, &rs, nil, tgw.Sorts{tgw.Asc("version")}); err != nil {
+		return nil, err
+	}
+
+	//noinspection GoPreferNilSlice
+	versions := []int64{}
+	for _, r := range rs {
+		versions = append(versions, r.Version)
+	}
+
+	return versions, nil
+}
+
+// up applies mig and records it
+func (m *Migrator) up(ctx context.Context, mig Migration) error {
+	return m.g.Transact(ctx, func(txg *tgw.Gateway) error {
+		if err := run(ctx, txg.Tx(), mig.UpFunc, mig.Up); err != nil {
+			return err
+		}
+		return txg.CreateContext(ctx, &record{Version: mig.Version, Name: mig.Name})
+	})
+}
+
+// down reverts mig and removes its record
+func (m *Migrator) down(ctx context.Context, mig Migration) error {
+
+	if mig.DownFunc == nil && mig.Down == "" {
+		return ErrNoDown
+	}
+
+	return m.g.Transact(ctx, func(txg *tgw.Gateway) error {
+		if err := run(ctx, txg.Tx(), mig.DownFunc, mig.Down); err != nil {
+			return err
+		}
+		return txg.DeleteContext(ctx, &record{Version: mig.Version})
+	})
+}
+
+// lockConn is a connection able to hold a session lock
+type lockConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// lock takes the lock serializing migrations, GET_LOCK on MySQL and an
+// advisory lock on PostgreSQL, and returns the function releasing it. Other
+// databases are not locked. The lock is held by a connection of its own, or
+// the transaction migrations run in.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+
+	name := m.g.Dialect().Name()
+	if name != "mysql" && name != "postgres" {
+		return func() {}, nil
+	}
+
+	var conn lockConn
+	release := func() {}
+
+	switch c := m.dbconn.(type) {
+	case *sqlx.DB:
+		sc, err := c.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, release = sc, func() { _ = sc.Close() }
+	case lockConn:
+		conn = c
+	default:
+		return func() {}, nil
+	}
+
+	if name == "postgres" {
+		key := lockKey()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil {
+			release()
+			return nil, err
+		}
+		return func() {
+			_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+			release()
+		}, nil
+	}
+
+	// A negative timeout waits until the lock is free or ctx is done
+	var ok sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", Table).Scan(&ok); err != nil {
+		release()
+		return nil, err
+	}
+	if ok.Int64 != 1 {
+		release()
+		return nil, ErrLocked
+	}
+
+	return func() {
+		_ = conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", Table).Scan(&ok)
+		release()
+	}, nil
+}
+
+// lockKey returns the advisory lock key of the tracking table
+func lockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(Table))
+	return int64(h.Sum64())
+}
+
+// run runs fn or, without it, the sql statement q on tx
+func run(ctx context.Context, tx *sqlx.Tx, fn func(context.Context, *sqlx.Tx) error, q string) error {
+	if fn != nil {
+		return fn(ctx, tx)
+	}
+	if q == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, q)
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tgwotel traces the queries of table gateways with OpenTelemetry
+package tgwotel
+
+import (
+	"context"
+	"github.com/mrccnt/go-table-gateway"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer of this package
+const instrumentation = "github.com/mrccnt/go-table-gateway"
+
+// WithTracing makes a gateway emit a client span for every statement using
+// tracers of tp
+func WithTracing(tp trace.TracerProvider) tgw.Option {
+	return tgw.WithTracer(NewTracer(tp))
+}
+
+// NewTracer returns a tgw.Tracer creating spans with tracers of tp. Spans are
+// named like "select users" and carry the operation, table, statement and
+// affected rows.
+func NewTracer(tp trace.TracerProvider) tgw.Tracer {
+	return &tracer{t: tp.Tracer(instrumentation)}
+}
+
+// tracer implements tgw.Tracer
+type tracer struct {
+	t trace.Tracer
+}
+
+// StartQuery implements tgw.Tracer
+func (t *tracer) StartQuery(ctx context.Context, op, table, query string) (context.Context, tgw.QuerySpan) {
+	ctx, s := t.t.Start(ctx, op+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.operation", op),
+			attribute.String("db.sql.table", table),
+			attribute.String("db.statement", query),
+		),
+	)
+	return ctx, span{s: s}
+}
+
+// span implements tgw.QuerySpan
+type span struct {
+	s trace.Span
+}
+
+// End implements tgw.QuerySpan
+func (s span) End(rows int64, err error) {
+	if rows >= 0 {
+		s.s.SetAttributes(attribute.Int64("db.rows_affected", rows))
+	}
+	if err != nil {
+		s.s.RecordError(err)
+		s.s.SetStatus(codes.Error, err.Error())
+	}
+	s.s.End()
+}
@@ -0,0 +1,230 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tgwoutbox implements the transactional outbox pattern. Messages are
+// written to an outbox table in the same transaction as the entities they
+// describe and published afterwards by a Poller, so a message is sent if and
+// only if its change was committed, at least once.
+package tgwoutbox
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/mrccnt/go-table-gateway"
+	"time"
+)
+
+// Table is the default name of the outbox table
+const Table = "outbox"
+
+// Errors...
+var (
+	ErrNoTx      = errors.New("outbox messages must be added within a transaction")
+	ErrPublisher = errors.New("no publisher given")
+)
+
+// Message is published to Topic. Key may be used by the publisher for
+// partitioning.
+type Message struct {
+	Topic   string
+	Key     string
+	Payload []byte
+	Headers map[string]string
+}
+
+// Publisher sends messages to a broker
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc adapts a function to a Publisher
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish implements Publisher
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// record is a row of the outbox table
+type record struct {
+	ID           uint64            `db:"id" tgw:"primary"`
+	Topic        string            `db:"topic" tgw:"insert,type=VARCHAR(255)"`
+	MsgKey       string            `db:"msg_key" tgw:"insert,type=VARCHAR(255)"`
+	Payload      []byte            `db:"payload" tgw:"insert"`
+	Headers      map[string]string `db:"headers" tgw:"insert,json"`
+	CreatedAt    time.Time         `db:"created_at" tgw:"insert,created"`
+	DispatchedAt *time.Time        `db:"dispatched_at" tgw:"update"`
+	Attempts     int               `db:"attempts" tgw:"insert,update"`
+	LastError    string            `db:"last_error" tgw:"insert,update,type=TEXT"`
+}
+
+// Outbox writes and dispatches messages of an outbox table
+type Outbox struct {
+	g *tgw.Gateway
+}
+
+// New returns an Outbox on dbconn using the table named Table. Options
+// configure its gateway, use tgw.WithPrefix or tgw.WithSchema to move the
+// table.
+func New(dbconn sqlx.ExtContext, opts ...tgw.Option) (*Outbox, error) {
+
+	g, err := tgw.NewGateway(dbconn, Table, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Outbox{g: g}, nil
+}
+
+// CreateTable creates the outbox table if it does not exist
+func (o *Outbox) CreateTable(ctx context.Context) error {
+	return o.g.CreateTableContext(ctx, &record{})
+}
+
+// Add writes msgs to the outbox within the transaction txg is bound to
+func (o *Outbox) Add(ctx context.Context, txg *tgw.Gateway, msgs ...Message) error {
+
+	if txg.Tx() == nil {
+		return ErrNoTx
+	}
+
+	og := o.g.BindTx(txg.Tx())
+
+	for _, m := range msgs {
+		r := &record{Topic: m.Topic, MsgKey: m.Key, Payload: m.Payload, Headers: m.Headers}
+		if err := og.CreateContext(ctx, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateWithOutbox creates entity through gw and writes msgs to the outbox in
+// the same transaction. A gw bound to a transaction uses it, otherwise a new
+// one is started and committed.
+func (o *Outbox) CreateWithOutbox(ctx context.Context, gw *tgw.Gateway, entity interface{}, msgs ...Message) error {
+	return gw.Transact(ctx, func(txg *tgw.Gateway) error {
+		if err := txg.CreateContext(ctx, entity); err != nil {
+			return err
+		}
+		return o.Add(ctx, txg, msgs...)
+	})
+}
+
+// Dispatch publishes up to limit pending messages in the order they were
+// written and marks them dispatched. It stops at the first message failing to
+// publish to keep the order, records the failure and returns its error. The
+// number of published messages is returned in any case.
+func (o *Outbox) Dispatch(ctx context.Context, pub Publisher, limit int) (int, error) {
+
+	if pub == nil {
+		return 0, ErrPublisher
+	}
+
+	n := 0
+
+	var perr error
+
+	err := o.g.Transact(ctx, func(txg *tgw.Gateway) error {
+
+		//noinspection GoPreferNilSlice
+		rs := []record{}
+
+		// Locked rows keep concurrent pollers from sending them twice
+		err := txg.Lock(tgw.LockForUpdate).Query().
+			Where(tgw.Selectors{"dispatched_at": tgw.IsNull}).
+			OrderBy(tgw.Sorts{tgw.Asc("id")}).
+			Limit(limit).
+			AllContext(ctx, &rs)
+		if err != nil {
+			return err
+		}
+
+		for i := range rs {
+			r := &rs[i]
+			msg := Message{Topic: r.Topic, Key: r.MsgKey, Payload: r.Payload, Headers: r.Headers}
+			r.Attempts++
+			if perr = pub.Publish(ctx, msg); perr != nil {
+				r.LastError = perr.Error()
+				return txg.UpdateContext(ctx, r)
+			}
+			now := time.Now()
+			r.DispatchedAt = &now
+			r.LastError = ""
+			if err := txg.UpdateContext(ctx, r); err != nil {
+				return err
+			}
+			n++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return n, err
+	}
+
+	return n, perr
+}
+
+// Purge deletes messages dispatched before given time and returns their number
+func (o *Outbox) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return o.g.DeleteWhereContext(ctx, tgw.Selectors{"dispatched_at <": before})
+}
+
+// Poller dispatches pending messages periodically
+type Poller struct {
+	Outbox    *Outbox
+	Publisher Publisher
+	// Interval between polls when no message is pending, defaults to a second
+	Interval time.Duration
+	// BatchSize limits the messages dispatched per poll, defaults to 100
+	BatchSize int
+	// OnError is called with errors of failed polls, which are retried
+	OnError func(error)
+}
+
+// Run polls until ctx is done and returns its error. Full batches are
+// followed by the next poll right away.
+func (p *Poller) Run(ctx context.Context) error {
+
+	interval := p.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	size := p.BatchSize
+	if size <= 0 {
+		size = 100
+	}
+
+	for {
+		n, err := p.Outbox.Dispatch(ctx, p.Publisher, size)
+		if err != nil && p.OnError != nil && ctx.Err() == nil {
+			p.OnError(err)
+		}
+
+		if err == nil && n == size {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
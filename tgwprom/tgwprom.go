@@ -0,0 +1,91 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tgwprom exports the queries of table gateways as Prometheus metrics
+package tgwprom
+
+import (
+	"github.com/mrccnt/go-table-gateway"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Collector is a tgw.Observer counting queries and errors and recording query
+// latencies per table and operation. Register it with a prometheus.Registerer
+// and pass it to tgw.WithObserver.
+type Collector struct {
+	queries  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// compile time check of the implemented interfaces
+var (
+	_ tgw.Observer         = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// NewCollector returns a Collector with metrics named like
+// namespace_queries_total. Latencies are bucketed by prometheus.DefBuckets if
+// buckets is empty.
+func NewCollector(namespace string, buckets ...float64) *Collector {
+
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	labels := []string{"table", "op"}
+
+	return &Collector{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "queries_total",
+			Help:      "Number of queries run by table gateways.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of queries run by table gateways which failed.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of queries run by table gateways.",
+			Buckets:   buckets,
+		}, labels),
+	}
+}
+
+// ObserveQuery implements tgw.Observer
+func (c *Collector) ObserveQuery(op string, table string, d time.Duration, err error) {
+	c.queries.WithLabelValues(table, op).Inc()
+	c.duration.WithLabelValues(table, op).Observe(d.Seconds())
+	if err != nil {
+		c.errors.WithLabelValues(table, op).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.queries.Describe(ch)
+	c.errors.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.queries.Collect(ch)
+	c.errors.Collect(ch)
+	c.duration.Collect(ch)
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timeout returns a copy of the gateway limiting the duration of every single
+// query to d, overriding WithTimeout for the calls made on it, like
+// g.Timeout(time.Second).Select(...). A zero duration means no limit.
+func (g *Gateway) Timeout(d time.Duration) *Gateway {
+	tg := *g
+	tg.timeout = d
+	if d < 0 {
+		tg.timeout = 0
+	}
+	return &tg
+}
+
+// timeoutHint returns the optimizer hint passing the timeout of the gateway
+// to MySQL, so the server aborts a SELECT itself even if the client does not
+// cancel it in time. It is empty for other dialects or without timeout.
+func (g *Gateway) timeoutHint() string {
+
+	if g.timeout <= 0 || g.dialect.Name() != "mysql" {
+		return ""
+	}
+
+	ms := g.timeout.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+
+	return fmt.Sprintf("MAX_EXECUTION_TIME(%d)", ms)
+}
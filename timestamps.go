@@ -0,0 +1,100 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// serverNow is the sql expression writing the current time of the database
+const serverNow = "CURRENT_TIMESTAMP"
+
+// WithServerTime fills columns tagged created or updated with the current
+// time of the database instead of the client. The fields of written entities
+// are not touched then and have to be read back if needed.
+func WithServerTime() Option {
+	return func(g *Gateway) error {
+		g.srvtime = true
+		return nil
+	}
+}
+
+// stamp prepares the created and updated columns of entity for writing. On
+// creation both are set, otherwise only the updated column. Client side the
+// fields are set to the current time, server side a copy of destcfg is
+// returned listing the columns to fill by the database.
+func (g *Gateway) stamp(dest interface{}, destcfg *tabMeta, create bool) *tabMeta {
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	if create && destcfg.Created != "" {
+		cols = append(cols, destcfg.Created)
+	}
+	if destcfg.Updated != "" {
+		cols = append(cols, destcfg.Updated)
+	}
+
+	if len(cols) == 0 {
+		return destcfg
+	}
+
+	if g.srvtime {
+		m := *destcfg
+		m.NowCols = cols
+		return &m
+	}
+
+	now := time.Now()
+	r := reflect.ValueOf(dest).Elem()
+	for _, col := range cols {
+		setTime(r.FieldByIndex(destcfg.Fields[col]), now)
+	}
+
+	return destcfg
+}
+
+// nowValues replaces the named values of columns filled by the database with
+// its current time
+func nowValues(cols, vals []string, destcfg *tabMeta) []string {
+	for i, col := range cols {
+		if inArray(col, destcfg.NowCols) {
+			vals[i] = serverNow
+		}
+	}
+	return vals
+}
+
+// nowSet replaces the assignments of columns filled by the database with its
+// current time
+func nowSet(cols, set []string, destcfg *tabMeta) []string {
+	for i, col := range cols {
+		if inArray(col, destcfg.NowCols) {
+			set[i] = fmt.Sprintf("`%s` = %s", col, serverNow)
+		}
+	}
+	return set
+}
+
+// setTime stores t in field f if it holds a time.Time or *time.Time
+func setTime(f reflect.Value, t time.Time) {
+	switch f.Interface().(type) {
+	case time.Time:
+		f.Set(reflect.ValueOf(t))
+	case *time.Time:
+		f.Set(reflect.ValueOf(&t))
+	}
+}
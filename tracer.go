@@ -0,0 +1,54 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Tracer starts a span for every statement a gateway runs. The op is one of
+// create, read, update, delete, select or count, query is the final sql. The
+// returned context is passed on to the database driver. Implementations must
+// be safe for concurrent use, see package tgwotel for OpenTelemetry.
+type Tracer interface {
+	StartQuery(ctx context.Context, op, table, query string) (context.Context, QuerySpan)
+}
+
+// QuerySpan is a span started by a Tracer. End is called once the statement
+// finished with the number of affected rows of writes, -1 for reads.
+type QuerySpan interface {
+	End(rows int64, err error)
+}
+
+// WithTracer sets the tracer starting a span for every statement
+func WithTracer(t Tracer) Option {
+	return func(g *Gateway) error {
+		g.tracer = t
+		return nil
+	}
+}
+
+// rowsAffected returns the affected rows of res or -1 if unknown
+func rowsAffected(res sql.Result) int64 {
+	if res == nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
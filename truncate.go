@@ -0,0 +1,83 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithDeleteAll allows Truncate and DeleteAll, which remove all rows of the
+// gateways table, as well as DeleteWhere and UpdateWhere without conditions.
+// They fail with ErrNotAllowed otherwise.
+func WithDeleteAll() Option {
+	return func(g *Gateway) error {
+		g.deleteAll = true
+		return nil
+	}
+}
+
+// Truncate removes all rows of the gateways table, e.g. for test teardown.
+// SQLite, transactions, which MySQL would commit implicitly, and gateways
+// scoped to a tenant use DELETE instead, as does a failing TRUNCATE.
+func (g *Gateway) Truncate() error {
+	return g.TruncateContext(context.Background())
+}
+
+// TruncateContext is like Truncate but runs with given context
+func (g *Gateway) TruncateContext(ctx context.Context) error {
+
+	if !g.deleteAll {
+		return ErrNotAllowed
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return err
+	}
+
+	if g.dialect.Name() != "sqlite" && g.tx == nil && g.tenant == nil {
+		tctx, cancel := g.context(ctx)
+		_, err := g.exec(tctx, opDelete, table, fmt.Sprintf("TRUNCATE TABLE %s", quoteTable(table)))
+		cancel()
+		if err == nil {
+			g.changedTable(opDelete, table)
+			return nil
+		}
+	}
+
+	// Truncate removes rows of soft delete tables instead of marking them
+	hg := *g
+	hg.softCol = ""
+	_, err = hg.DeleteWhereContext(ctx, nil)
+
+	return err
+}
+
+// DeleteAll deletes all rows of the gateways table matching params, all rows
+// if params is empty, and returns their number
+func (g *Gateway) DeleteAll(params Selectors) (int64, error) {
+	return g.DeleteAllContext(context.Background(), params)
+}
+
+// DeleteAllContext is like DeleteAll but runs with given context
+func (g *Gateway) DeleteAllContext(ctx context.Context, params Selectors) (int64, error) {
+
+	if !g.deleteAll {
+		return 0, ErrNotAllowed
+	}
+
+	return g.DeleteWhereContext(ctx, params)
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestDeleteAll checks that writes hitting every row need WithDeleteAll
+func TestDeleteAll(t *testing.T) {
+
+	tests := []struct {
+		name string
+		op   func(g *Gateway) error
+		rows int
+	}{
+		{"truncate", func(g *Gateway) error {
+			return g.Truncate()
+		}, 0},
+		{"delete all", func(g *Gateway) error {
+			_, err := g.DeleteAll(nil)
+			return err
+		}, 0},
+		{"delete where nil", func(g *Gateway) error {
+			_, err := g.DeleteWhere(nil)
+			return err
+		}, 0},
+		{"delete where empty", func(g *Gateway) error {
+			_, err := g.DeleteWhere(Selectors{})
+			return err
+		}, 0},
+		{"delete where empty raw", func(g *Gateway) error {
+			_, err := g.DeleteWhere(Raw(""))
+			return err
+		}, 0},
+		{"update where nil", func(g *Gateway) error {
+			_, err := g.UpdateWhere(map[string]interface{}{"name": "x"}, nil)
+			return err
+		}, 2},
+	}
+
+	for _, tc := range tests {
+		for _, allowed := range []bool{false, true} {
+			name := tc.name
+			if allowed {
+				name += " allowed"
+			}
+			t.Run(name, func(t *testing.T) {
+				var opts []Option
+				if allowed {
+					opts = append(opts, WithDeleteAll())
+				}
+
+				db := testDB(t, testUsers)
+				g := testGateway(t, db, "users", opts...)
+				testCreate(t, g, &testUser{Name: "a"}, &testUser{Name: "b"})
+
+				err := tc.op(g)
+				if !allowed {
+					if !errors.Is(err, ErrNotAllowed) {
+						t.Fatalf("err = %v, want ErrNotAllowed", err)
+					}
+					if n := testCount(t, db, "users", "name IN ('a', 'b')"); n != 2 {
+						t.Errorf("%d rows left untouched, want 2", n)
+					}
+					return
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := testCount(t, db, "users", "1 = 1"); n != tc.rows {
+					t.Errorf("%d rows left, want %d", n, tc.rows)
+				}
+			})
+		}
+	}
+}
+
+// TestDeleteAllConditions checks that conditions limiting the rows do not need
+// WithDeleteAll
+func TestDeleteAllConditions(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		params Condition
+		n      int64
+	}{
+		{"selector", Selectors{"name": "a"}, 1},
+		{"empty or", Or(), 0},
+		{"raw", Raw("name = ?", "b"), 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := testGateway(t, testDB(t, testUsers), "users")
+			testCreate(t, g, &testUser{Name: "a"}, &testUser{Name: "b"})
+			if n, err := g.DeleteWhere(tc.params); err != nil || n != tc.n {
+				t.Fatalf("DeleteWhere() = %d, %v, want %d", n, err, tc.n)
+			}
+		})
+	}
+}
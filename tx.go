@@ -0,0 +1,157 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+)
+
+// BeginTx starts a transaction and returns a gateway bound to it. Finish it by
+// calling Commit or Rollback on the returned gateway.
+func (g *Gateway) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Gateway, error) {
+
+	if g.tx != nil {
+		return nil, ErrTxActive
+	}
+
+	tx, err := g.begin(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	openQueue(tx)
+
+	return g.BindTx(tx), nil
+}
+
+// txBeginner is implemented by connections able to start transactions other
+// than *sqlx.DB
+type txBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// begin starts a transaction on the gateways connection
+func (g *Gateway) begin(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	if g.dbx != nil {
+		return g.dbx.BeginTxx(ctx, opts)
+	}
+	if b, ok := g.ext.(txBeginner); ok {
+		return b.BeginTxx(ctx, opts)
+	}
+	return nil, ErrNoBegin
+}
+
+// BindTx returns a copy of the gateway running all its operations on tx. This
+// allows to use several gateways within one transaction. If tx was started by
+// a gateway, change events are queued until it is committed through any of
+// the gateways bound to it.
+func (g *Gateway) BindTx(tx *sqlx.Tx) *Gateway {
+	txg := *g
+	txg.ext = tx
+	txg.tx = tx
+	txg.changes = txQueue(tx)
+	return &txg
+}
+
+// Tx returns the transaction the gateway is bound to or nil
+func (g *Gateway) Tx() *sqlx.Tx {
+	return g.tx
+}
+
+// Commit commits the transaction the gateway is bound to
+func (g *Gateway) Commit() error {
+	if g.tx == nil {
+		return ErrNoTx
+	}
+	q := closeQueue(g.tx)
+	if err := g.tx.Commit(); err != nil {
+		q.drop()
+		return err
+	}
+	q.flush()
+	return nil
+}
+
+// Rollback aborts the transaction the gateway is bound to
+func (g *Gateway) Rollback() error {
+	if g.tx == nil {
+		return ErrNoTx
+	}
+	closeQueue(g.tx).drop()
+	return g.tx.Rollback()
+}
+
+// WithTx runs fn inside a transaction. The gateway handed to fn runs all its
+// operations on the transaction, which is committed if fn returns nil and
+// rolled back if fn returns an error or panics. Calling WithTx on a gateway
+// already bound to a transaction runs fn within a savepoint of that
+// transaction, so failing fn only undoes its own writes.
+func (g *Gateway) WithTx(fn func(txg *Gateway) error) error {
+	return g.Transact(context.Background(), fn)
+}
+
+// Transact is like WithTx but starts the transaction with given context
+func (g *Gateway) Transact(ctx context.Context, fn func(tx *Gateway) error) error {
+	return g.transact(ctx, nil, fn)
+}
+
+// transact runs fn inside a new transaction started with given options
+func (g *Gateway) transact(ctx context.Context, opts *sql.TxOptions, fn func(txg *Gateway) error) error {
+
+	if g.tx != nil {
+		return g.nested(ctx, fn)
+	}
+
+	return g.retry(ctx, func() error {
+		return g.transactOnce(ctx, opts, fn)
+	})
+}
+
+// transactOnce is a single attempt of transact
+func (g *Gateway) transactOnce(ctx context.Context, opts *sql.TxOptions, fn func(txg *Gateway) error) (err error) {
+
+	tx, err := g.begin(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	openQueue(tx)
+	txg := g.BindTx(tx)
+
+	defer func() {
+		if p := recover(); p != nil {
+			closeQueue(tx)
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(txg); err != nil {
+		closeQueue(tx)
+		_ = tx.Rollback()
+		return err
+	}
+
+	q := closeQueue(tx)
+	if err = tx.Commit(); err != nil {
+		q.drop()
+		return err
+	}
+	q.flush()
+
+	return nil
+}
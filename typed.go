@@ -0,0 +1,182 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+)
+
+// errStopIteration ends the iteration of rows when the consumer stops
+var errStopIteration = errors.New("iteration stopped")
+
+// TypedGateway is a type safe gateway for entities of type T
+type TypedGateway[T any] struct {
+	g *Gateway
+}
+
+// New returns a new TypedGateway for entities of type T. The struct tags of T
+// are checked on construction.
+func New[T any](dbconn sqlx.ExtContext, table string, opts ...Option) (*TypedGateway[T], error) {
+
+	if _, err := parseMeta(new(T)); err != nil {
+		return nil, err
+	}
+
+	g, err := NewGateway(dbconn, table, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedGateway[T]{g: g}, nil
+}
+
+// Gateway returns the underlying untyped gateway
+func (t *TypedGateway[T]) Gateway() *Gateway {
+	return t.g
+}
+
+// Create writes entity to database
+func (t *TypedGateway[T]) Create(e *T) error {
+	return t.g.Create(e)
+}
+
+// CreateContext is like Create but runs with given context
+func (t *TypedGateway[T]) CreateContext(ctx context.Context, e *T) error {
+	return t.g.CreateContext(ctx, e)
+}
+
+// Read returns the entity with given primary key
+func (t *TypedGateway[T]) Read(id interface{}) (*T, error) {
+	return t.ReadContext(context.Background(), id)
+}
+
+// ReadContext is like Read but runs with given context
+func (t *TypedGateway[T]) ReadContext(ctx context.Context, id interface{}) (*T, error) {
+
+	e := new(T)
+
+	destcfg, err := parseMeta(e)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setPriVal(e, destcfg, id); err != nil {
+		return nil, err
+	}
+
+	if err := t.g.ReadContext(ctx, e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Update updates entity in database
+func (t *TypedGateway[T]) Update(e *T) error {
+	return t.g.Update(e)
+}
+
+// UpdateContext is like Update but runs with given context
+func (t *TypedGateway[T]) UpdateContext(ctx context.Context, e *T) error {
+	return t.g.UpdateContext(ctx, e)
+}
+
+// Patch updates only the columns in changes of the entity with given primary
+// key
+func (t *TypedGateway[T]) Patch(id interface{}, changes map[string]interface{}) error {
+	return t.PatchContext(context.Background(), id, changes)
+}
+
+// PatchContext is like Patch but runs with given context
+func (t *TypedGateway[T]) PatchContext(ctx context.Context, id interface{}, changes map[string]interface{}) error {
+	return t.g.PatchContext(ctx, new(T), id, changes)
+}
+
+// Delete removes entity from database
+func (t *TypedGateway[T]) Delete(e *T) error {
+	return t.g.Delete(e)
+}
+
+// DeleteContext is like Delete but runs with given context
+func (t *TypedGateway[T]) DeleteContext(ctx context.Context, e *T) error {
+	return t.g.DeleteContext(ctx, e)
+}
+
+// Select returns all entities matching params
+func (t *TypedGateway[T]) Select(params Condition, orderby Orderer) ([]T, error) {
+	return t.SelectContext(context.Background(), params, orderby)
+}
+
+// SelectContext is like Select but runs with given context
+func (t *TypedGateway[T]) SelectContext(ctx context.Context, params Condition, orderby Orderer) ([]T, error) {
+
+	//noinspection GoPreferNilSlice
+	dest := []T{}
+
+	if err := t.g.SelectContext(ctx, &dest, params, orderby); err != nil {
+		return nil, err
+	}
+
+	return dest, nil
+}
+
+// SelectChan streams all entities matching params through the returned
+// channel, reading the next row only after the previous one was received.
+// The error channel yields the final error, if any, once the entity channel
+// is closed. Cancelling ctx stops the query.
+func (t *TypedGateway[T]) SelectChan(ctx context.Context, params Condition, orderby Orderer) (<-chan T, <-chan error) {
+
+	out := make(chan T)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(out)
+		e := new(T)
+		errc <- t.g.SelectEachContext(ctx, e, params, orderby, func(interface{}) error {
+			select {
+			case out <- *e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	return out, errc
+}
+
+// Iterate returns an iterator over all entities matching params, usable with
+// range over func. Iteration stops at the first error, which is yielded with
+// a zero entity.
+func (t *TypedGateway[T]) Iterate(ctx context.Context, params Condition, orderby Orderer) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		e := new(T)
+		stopped := false
+		err := t.g.SelectEachContext(ctx, e, params, orderby, func(interface{}) error {
+			if !yield(*e, nil) {
+				stopped = true
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && !stopped {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
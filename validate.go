@@ -0,0 +1,104 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Validator is implemented by entities checking themselves before they are
+// created or updated
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned by writes of entities failing validation. It
+// matches ErrValidation and unwraps to the error of the validator.
+type ValidationError struct {
+	Entity string
+	Err    error
+}
+
+// Error implements error
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrValidation.Error(), e.Entity, e.Err)
+}
+
+// Is matches ErrValidation
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Unwrap returns the error of the validator
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// WithValidation adds fn to the checks entities have to pass before they are
+// created or updated, after their Validate method if they implement
+// Validator. Fn may wrap libraries like go-playground/validator by calling
+// its StructCtx. Writes not taking entities like Patch or UpdateWhere are not
+// validated.
+func WithValidation(fn func(ctx context.Context, dest interface{}) error) Option {
+	return func(g *Gateway) error {
+		if fn == nil {
+			return ErrOption
+		}
+		g.validators = append(append([]func(context.Context, interface{}) error{}, g.validators...), fn)
+		return nil
+	}
+}
+
+// validate checks the enum columns of entity dest and runs its validators. It
+// returns a *ValidationError for the first failing check.
+func (g *Gateway) validate(ctx context.Context, dest interface{}) error {
+
+	if destcfg, err := parseMeta(dest); err == nil {
+		if err := checkEnums(dest, destcfg); err != nil {
+			return &ValidationError{Entity: entityName(dest), Err: err}
+		}
+	}
+
+	if v, ok := dest.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return &ValidationError{Entity: entityName(dest), Err: err}
+		}
+	}
+
+	for _, fn := range g.validators {
+		if err := fn(ctx, dest); err != nil {
+			return &ValidationError{Entity: entityName(dest), Err: err}
+		}
+	}
+
+	return nil
+}
+
+// validateAll runs the checks of all given entities
+func (g *Gateway) validateAll(ctx context.Context, elems []interface{}) error {
+	for _, e := range elems {
+		if err := g.validate(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entityName returns the type name of the entity dest points to
+func entityName(dest interface{}) string {
+	return baseType(reflect.TypeOf(dest)).String()
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"database/sql"
+	"reflect"
+)
+
+// checkVersion verifies that the update of a versioned entity hit a row and
+// increments the version field of entity accordingly
+func checkVersion(res sql.Result, dest interface{}, destcfg *tabMeta) error {
+
+	if destcfg.Version == "" {
+		return nil
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrStaleObject
+	}
+
+	f := reflect.ValueOf(dest).Elem().FieldByIndex(destcfg.Fields[destcfg.Version])
+	if isSigned(f.Kind()) {
+		f.SetInt(f.Int() + 1)
+	} else if isInteger(f.Kind()) {
+		f.SetUint(f.Uint() + 1)
+	}
+
+	return nil
+}
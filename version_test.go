@@ -0,0 +1,108 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"errors"
+	"testing"
+)
+
+// testVersioned is an entity with a version column
+type testVersioned struct {
+	ID      int64  `db:"id" tgw:"primary"`
+	Name    string `db:"name" tgw:"insert,update"`
+	Version int    `db:"version" tgw:"insert,update,version"`
+}
+
+// TestOptimisticLocking checks that writes of outdated versions fail with
+// ErrStaleObject while current ones increment the version
+func TestOptimisticLocking(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		write   func(g *Gateway, stale *testVersioned) error
+		err     error
+		version int
+	}{
+		{"update", func(g *Gateway, v *testVersioned) error {
+			return g.Update(v)
+		}, ErrStaleObject, 0},
+		{"update partial", func(g *Gateway, v *testVersioned) error {
+			return g.UpdatePartial(v, "name")
+		}, ErrStaleObject, 0},
+		{"update columns", func(g *Gateway, v *testVersioned) error {
+			return g.UpdateColumns(v, "name")
+		}, ErrStaleObject, 0},
+		{"current version", func(g *Gateway, v *testVersioned) error {
+			if err := g.Read(v); err != nil {
+				return err
+			}
+			v.Name = "y"
+			return g.Update(v)
+		}, nil, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+
+			db := testDB(t, "CREATE TABLE versioned (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, version INTEGER)")
+			g := testGateway(t, db, "versioned")
+
+			a := testVersioned{Name: "a"}
+			testCreate(t, g, &a)
+			b := a
+
+			a.Name = "x"
+			if err := g.Update(&a); err != nil || a.Version != 1 {
+				t.Fatalf("Update() = %v, version %d", err, a.Version)
+			}
+
+			b.Name = "y"
+			if err := tc.write(g, &b); !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if b.Version != tc.version {
+				t.Errorf("version = %d, want %d", b.Version, tc.version)
+			}
+
+			want := "x"
+			if tc.err == nil {
+				want = "y"
+			}
+			r := testVersioned{ID: a.ID}
+			if err := g.Read(&r); err != nil || r.Name != want {
+				t.Errorf("Read() = %v, name %q, want %q", err, r.Name, want)
+			}
+		})
+	}
+}
+
+// TestOptimisticLockingDeleted checks that updating a removed versioned
+// entity fails with ErrStaleObject
+func TestOptimisticLockingDeleted(t *testing.T) {
+
+	db := testDB(t, "CREATE TABLE versioned (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT, version INTEGER)")
+	g := testGateway(t, db, "versioned")
+
+	v := testVersioned{Name: "a"}
+	testCreate(t, g, &v)
+	if err := g.Delete(&testVersioned{ID: v.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Update(&v); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("Update() = %v, want ErrStaleObject", err)
+	}
+}
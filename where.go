@@ -0,0 +1,266 @@
+// Copyright 2019 Marco Conti
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tgw
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Count returns the number of rows of the gateways table matching params,
+// skipping soft deleted rows, see WithSoftDeleteColumn
+func (g *Gateway) Count(params Condition) (int64, error) {
+	return g.CountContext(context.Background(), params)
+}
+
+// CountContext is like Count but runs with given context
+func (g *Gateway) CountContext(ctx context.Context, params Condition) (int64, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return 0, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return 0, err
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return 0, err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteTable(table)) + where
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	var n int64
+	if err := g.get(ctx, opCount, table, &n, q, args...); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Exists checks if any row of the gateways table matches params
+func (g *Gateway) Exists(params Condition) (bool, error) {
+	return g.ExistsContext(context.Background(), params)
+}
+
+// ExistsContext is like Exists but runs with given context
+func (g *Gateway) ExistsContext(ctx context.Context, params Condition) (bool, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return false, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return false, err
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return false, err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s%s)", quoteTable(table), where)
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	var ok bool
+	if err := g.get(ctx, opCount, table, &ok, q, args...); err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+// Pluck selects the values of a single column of all rows of the gateways
+// table matching params into the slice dest points to, like a *[]int64
+func (g *Gateway) Pluck(column string, dest interface{}, params Condition) error {
+	return g.PluckContext(context.Background(), column, dest, params)
+}
+
+// PluckContext is like Pluck but runs with given context
+func (g *Gateway) PluckContext(ctx context.Context, column string, dest interface{}, params Condition) error {
+
+	if err := checkCondition(params, nil); err != nil {
+		return err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return err
+	}
+
+	if !validIdent(column) {
+		return ErrIdentifier
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf("SELECT `%s` FROM %s", column, quoteTable(table)) + where
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	return g.selectRows(ctx, opSelect, table, dest, q, args...)
+}
+
+// DeleteWhere deletes all rows of the gateways table matching params and
+// returns the number of affected rows. Rows of tables with a soft delete
+// column, see WithSoftDeleteColumn, are marked deleted unless they are already.
+// Empty params fail with ErrNotAllowed unless the gateway was created
+// WithDeleteAll.
+func (g *Gateway) DeleteWhere(params Condition) (int64, error) {
+	return g.DeleteWhereContext(context.Background(), params)
+}
+
+// DeleteWhereContext is like DeleteWhere but runs with given context
+func (g *Gateway) DeleteWhereContext(ctx context.Context, params Condition) (int64, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return 0, err
+	}
+
+	if err := g.allRows(params); err != nil {
+		return 0, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return 0, err
+	}
+
+	params, err = g.scope(params, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	where, args := whereClause(params)
+	q := fmt.Sprintf("DELETE FROM %s", quoteTable(table)) + where
+
+	if g.softCol != "" {
+		q = fmt.Sprintf("UPDATE %s SET `%s` = ?", quoteTable(table), g.softCol) + withoutDeleted(where, g.softCol)
+		args = append([]interface{}{time.Now()}, args...)
+	}
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opDelete, table, q, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	g.changedTable(opDelete, table)
+
+	return res.RowsAffected()
+}
+
+// UpdateWhere sets given columns on all rows of the gateways table matching
+// params and returns the number of affected rows. Values may be an Expr or Raw
+// to compute them in sql. Soft deleted rows are skipped unless the gateway is
+// unscoped. Empty params fail with ErrNotAllowed unless the gateway was
+// created WithDeleteAll.
+func (g *Gateway) UpdateWhere(set map[string]interface{}, params Condition) (int64, error) {
+	return g.UpdateWhereContext(context.Background(), set, params)
+}
+
+// UpdateWhereContext is like UpdateWhere but runs with given context
+func (g *Gateway) UpdateWhereContext(ctx context.Context, set map[string]interface{}, params Condition) (int64, error) {
+
+	if err := checkCondition(params, nil); err != nil {
+		return 0, err
+	}
+
+	if err := g.allRows(params); err != nil {
+		return 0, err
+	}
+
+	table, err := g.defaultTable()
+	if err != nil {
+		return 0, err
+	}
+
+	//noinspection GoPreferNilSlice
+	cols := []string{}
+	for k := range set {
+		cols = append(cols, k)
+	}
+
+	if len(cols) == 0 || !validIdent(cols...) {
+		return 0, ErrIdentifier
+	}
+
+	sort.Strings(cols)
+
+	//noinspection GoPreferNilSlice
+	assigns := []string{}
+
+	//noinspection GoPreferNilSlice
+	args := []interface{}{}
+
+	for _, col := range cols {
+		v, vargs := valueSQL(set[col])
+		assigns = append(assigns, fmt.Sprintf("`%s` = %s", col, v))
+		args = append(args, vargs...)
+	}
+
+	params, err = g.readScope(params)
+	if err != nil {
+		return 0, err
+	}
+
+	where, wargs := whereClause(params)
+	q := fmt.Sprintf(
+		"UPDATE %s SET %s",
+		quoteTable(table),
+		strings.Join(assigns, ","),
+	) + where
+
+	ctx, cancel := g.context(ctx)
+	defer cancel()
+
+	res, err := g.exec(ctx, opUpdate, table, q, append(args, wargs...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	g.changedTable(opUpdate, table)
+
+	return res.RowsAffected()
+}
+
+// allRows returns ErrNotAllowed if params match every row and the gateway was
+// not created WithDeleteAll
+func (g *Gateway) allRows(params Condition) error {
+	if where, _ := whereClause(params); where == "" && !g.deleteAll {
+		return ErrNotAllowed
+	}
+	return nil
+}